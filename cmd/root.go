@@ -2,7 +2,10 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"runtime/pprof"
+	"strconv"
+	"strings"
 
 	"os"
 
@@ -60,20 +63,145 @@ func RootCmd() *cobra.Command {
 	return rootCmd
 }
 
+// Keywords of -z
+func applyKeyword(opts *linker.LinkerInputs, keyword string) error {
+	switch keyword {
+	case "text":
+		opts.NoText = false
+	case "notext":
+		opts.NoText = true
+	case "now":
+		opts.BindNow = true
+	case "lazy":
+		opts.BindNow = false
+	case "origin":
+		opts.Origin = true
+	case "nodelete":
+		opts.NoDelete = true
+	case "defs":
+		opts.NoUndefined = true
+	case "undefs":
+		opts.NoUndefined = false
+	case "relro":
+		opts.NoRelro = false
+	case "norelro":
+		opts.NoRelro = true
+	case "separate-code":
+		opts.NoSeparateCode = false
+	case "noseparate-code":
+		opts.NoSeparateCode = true
+	case "execstack":
+		opts.ExecStack = true
+		opts.NoExecStack = false
+	case "noexecstack":
+		opts.ExecStack = false
+		opts.NoExecStack = true
+	case "pack-relative-relocs":
+		opts.PackRelativeRelocs = true
+	case "nopack-relative-relocs":
+		opts.PackRelativeRelocs = false
+	case "force-ibt":
+		opts.ForceIBT = true
+	default:
+		if size, found := strings.CutPrefix(keyword, "stack-size="); found {
+			value, err := strconv.ParseUint(size, 0, 64)
+			if err != nil {
+				return fmt.Errorf("invalid stack size: %s", size)
+			}
+			opts.StackSize = value
+			return nil
+		}
+
+		if report, found := strings.CutPrefix(keyword, "cet-report="); found {
+			opts.CETReport = report
+			return nil
+		}
+
+		return fmt.Errorf("unknown -z keyword: %s", keyword)
+	}
+
+	return nil
+}
+
 func linkerCmd() *cobra.Command {
 	opts := linker.LinkerInputs{}
+	keywords := []string{}
+	staticPIE := false
+	disableNewDTags := false
+	noAsNeeded := false
+	packDynRelocs := ""
 	linkerCmd := &cobra.Command{
 		Use:   "link",
 		Short: "Link input files",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, keyword := range keywords {
+				if err := applyKeyword(&opts, keyword); err != nil {
+					return err
+				}
+			}
+
+			switch packDynRelocs {
+			case "":
+			case "relr":
+				opts.PackRelativeRelocs = true
+			case "none":
+				opts.PackRelativeRelocs = false
+			default:
+				return fmt.Errorf("unknown --pack-dyn-relocs format: %s", packDynRelocs)
+			}
+
+			if disableNewDTags {
+				opts.EnableNewDTags = false
+			}
+
+			if noAsNeeded {
+				opts.AsNeeded = false
+			}
+
+			if staticPIE {
+				opts.PIE = true
+				opts.Static = true
+			}
+
 			opts.Filenames = args[:]
-			linker.Link(opts)
-			return nil
+			_, err := linker.Link(opts)
+			return err
 		},
 	}
 
-	//rootCmd.PersistentFlags()
+	linkerCmd.Flags().BoolVar(&opts.Shared, "shared", false, "produce a shared object")
+	linkerCmd.Flags().BoolVar(&opts.PIE, "pie", false, "produce a position independent executable")
+	linkerCmd.Flags().BoolVar(&opts.Static, "static", false, "do not use a dynamic loader, shared libraries are rejected")
+	linkerCmd.Flags().BoolVar(&staticPIE, "static-pie", false, "produce a position independent executable that relocates itself, same as --static --pie")
+	linkerCmd.Flags().StringVar(&opts.SOName, "soname", "", "DT_SONAME of the shared object")
+	linkerCmd.Flags().StringVar(&opts.VersionScript, "version-script", "", "version script that selects and versions the exported symbols")
+	linkerCmd.Flags().BoolVar(&opts.NoUndefinedVersion, "no-undefined-version", false, "fail if a global pattern of the version script matches no symbol")
+	linkerCmd.Flags().BoolVar(&opts.ExportDynamic, "export-dynamic", false, "export all the definitions of an executable")
+	linkerCmd.Flags().StringVar(&opts.DynamicList, "dynamic-list", "", "file listing the exported symbols of an executable, or the ones of a shared object that can be interposed")
+	linkerCmd.Flags().BoolVar(&opts.Symbolic, "Bsymbolic", false, "bind the references of a shared object to its own definitions")
+	linkerCmd.Flags().BoolVar(&opts.SymbolicFunctions, "Bsymbolic-functions", false, "bind the references of a shared object to its own functions")
+	linkerCmd.Flags().StringSliceVar(&opts.ExcludeLibs, "exclude-libs", []string{}, "archives whose definitions are not exported, ALL for every archive")
+	linkerCmd.Flags().StringVar(&opts.HashStyle, "hash-style", linker.HASH_STYLE_BOTH, "hash tables of the dynamic symbols, sysv, gnu or both")
+	linkerCmd.Flags().StringArrayVar(&opts.RPath, "rpath", []string{}, "library search path of the output, can be given several times")
+	linkerCmd.Flags().BoolVar(&opts.EnableNewDTags, "enable-new-dtags", false, "record the run path in DT_RUNPATH instead of DT_RPATH")
+	linkerCmd.Flags().BoolVar(&disableNewDTags, "disable-new-dtags", false, "record the run path in DT_RPATH, the default")
+	linkerCmd.Flags().BoolVar(&opts.AsNeeded, "as-needed", false, "only record the shared libraries that resolve a reference in DT_NEEDED")
+	linkerCmd.Flags().BoolVar(&noAsNeeded, "no-as-needed", false, "record all the shared libraries in DT_NEEDED, the default")
+	linkerCmd.Flags().BoolVar(&opts.NoRosegment, "no-rosegment", false, "map the read-only data in the executable segment")
+	linkerCmd.Flags().StringVar(&opts.BuildID, "build-id", linker.BUILD_ID_NONE, "compute .note.gnu.build-id with fast, md5, sha1, uuid, 0x<hex> or none")
+	linkerCmd.Flags().Lookup("build-id").NoOptDefVal = linker.BUILD_ID_SHA1
+	linkerCmd.Flags().BoolVar(&opts.EhFrameHdr, "eh-frame-hdr", false, "add .eh_frame_hdr, the search table of the unwind information")
+	linkerCmd.Flags().BoolVar(&opts.GCSections, "gc-sections", false, "only link the sections that are reachable from the entry point and the exported symbols")
+	linkerCmd.Flags().BoolVar(&opts.PrintGCSections, "print-gc-sections", false, "list the sections removed by --gc-sections")
+	linkerCmd.Flags().StringArrayVarP(&opts.Undefined, "undefined", "u", []string{}, "add an undefined reference to the symbol, can be given several times")
+	linkerCmd.Flags().StringArrayVar(&opts.RequireDefined, "require-defined", []string{}, "add an undefined reference to the symbol and fail if it is not defined")
+	linkerCmd.Flags().StringVar(&opts.ICF, "icf", linker.ICF_NONE, "fold the identical sections, none, safe (the ones whose address is not taken) or all")
+	linkerCmd.Flags().BoolVar(&opts.PrintICFSections, "print-icf-sections", false, "list the sections folded by --icf")
+	linkerCmd.Flags().IntVarP(&opts.Optimize, "optimize", "O", 0, "optimization level, -O2 merges the strings that end another one")
+	linkerCmd.Flags().StringVar(&packDynRelocs, "pack-dyn-relocs", "", "relr to pack the relative relocations in .relr.dyn, or none")
+	linkerCmd.Flags().StringArrayVarP(&keywords, "keyword", "z", []string{}, "linker keyword, text, notext, now, lazy, origin, nodelete, defs, undefs, relro, norelro, separate-code, noseparate-code, execstack, noexecstack, stack-size=N, pack-relative-relocs, nopack-relative-relocs, force-ibt or cet-report=none|warn|error")
+	linkerCmd.Flags().StringVar(&opts.DynamicLinker, "dynamic-linker", linker.DefaultDynamicLinker, "path of the dynamic loader of the executable")
 
 	return linkerCmd
 }
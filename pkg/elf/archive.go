@@ -0,0 +1,88 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const ArchiveMagic = "!<arch>\n"
+
+var InvalidArchiveErr = errors.New("Invalid archive")
+
+// A static library, the relocatable objects it holds are only linked in if they define a
+// symbol that is still undefined
+type Archive struct {
+	Filename string
+	Members  []*ELF64
+}
+
+func IsArchive(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(ArchiveMagic))
+	n, _ := file.Read(magic)
+	return n == len(magic) && string(magic) == ArchiveMagic
+}
+
+// Parses the relocatable members of a System V (GNU) archive, the symbol table is not used as
+// the symbols of the members are parsed anyway
+func NewArchive(filename string) (*Archive, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(ArchiveMagic)) {
+		return nil, fmt.Errorf("%w: %s", InvalidArchiveErr, filename)
+	}
+
+	archive := &Archive{Filename: filename}
+	longNames := []byte{}
+
+	for offset := len(ArchiveMagic); offset+60 <= len(data); {
+		header := data[offset : offset+60]
+		name := strings.TrimRight(string(header[0:16]), " ")
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil || offset+60+size > len(data) {
+			return nil, fmt.Errorf("%w: bad member header in %s", InvalidArchiveErr, filename)
+		}
+
+		content := data[offset+60 : offset+60+size]
+		// members are aligned to 2 bytes
+		offset += 60 + size + size%2
+
+		switch {
+		case name == "/" || name == "/SYM64/":
+			continue
+		case name == "//":
+			longNames = content
+			continue
+		case strings.HasPrefix(name, "/"):
+			start, err := strconv.Atoi(name[1:])
+			if err != nil || start >= len(longNames) {
+				return nil, fmt.Errorf("%w: bad long name in %s", InvalidArchiveErr, filename)
+			}
+			name = string(longNames[start:])
+			name = name[:strings.Index(name+"\n", "\n")]
+		}
+		name = strings.TrimSuffix(name, "/")
+
+		member, err := ParseELF(fmt.Sprintf("%s(%s)", filename, name), content)
+		if err != nil {
+			return nil, err
+		}
+		member.Archive = filepath.Base(filename)
+		archive.Members = append(archive.Members, member)
+	}
+
+	return archive, nil
+}
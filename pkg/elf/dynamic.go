@@ -0,0 +1,153 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/andreistan26/golink/pkg/helpers"
+)
+
+const (
+	// .gnu.version index of local and unversioned global symbols
+	VER_NDX_LOCAL  = 0
+	VER_NDX_GLOBAL = 1
+
+	// set on the version definition named after the shared object itself
+	VER_FLG_BASE = 0x1
+
+	// the symbol is not bound by references without an explicit version
+	VERSYM_HIDDEN = 0x8000
+)
+
+var NoDynamicSymbolsErr = errors.New("Shared object has no dynamic symbol table.")
+
+type DynamicEntry struct {
+	Tag   int64
+	Value uint64
+}
+
+func (elf *ELF64) findSectionByType(shType SHT_TYPE) *Section {
+	for _, section := range elf.Sections {
+		if section.SectionEntry.ShType == shType {
+			return section
+		}
+	}
+
+	return nil
+}
+
+// Parses the .dynamic entries, the dynamic symbols and their versions of a shared object
+func (elf *ELF64) ParseDynamic() error {
+	dynsym := elf.findSectionByType(SHT_DYNSYM)
+	if dynsym == nil {
+		return fmt.Errorf("%w: %s", NoDynamicSymbolsErr, elf.Filename)
+	}
+
+	if dynamic := elf.findSectionByType(SHT_DYNAMIC); dynamic != nil {
+		dynstr := elf.Sections[dynamic.SectionEntry.ShLink].Data
+		for offset := uint64(0); offset+0x10 <= uint64(len(dynamic.Data)); offset += 0x10 {
+			entry := DynamicEntry{
+				Tag:   int64(binary.LittleEndian.Uint64(dynamic.Data[offset : offset+0x8])),
+				Value: binary.LittleEndian.Uint64(dynamic.Data[offset+0x8 : offset+0x10]),
+			}
+
+			if entry.Tag == DT_NULL {
+				break
+			}
+
+			switch entry.Tag {
+			case DT_SONAME:
+				elf.SOName = helpers.GetString(dynstr[entry.Value:])
+			case DT_NEEDED:
+				elf.Needed = append(elf.Needed, helpers.GetString(dynstr[entry.Value:]))
+			}
+
+			elf.Dynamic = append(elf.Dynamic, entry)
+		}
+	}
+
+	dynstr := elf.Sections[dynsym.SectionEntry.ShLink].Data
+	for offset := uint64(0); offset+0x18 <= uint64(len(dynsym.Data)); offset += 0x18 {
+		symbol := &Symbol{}
+		symbol.BaseSymbol = &ELF64Sym{
+			StName:  binary.LittleEndian.Uint32(dynsym.Data[offset : offset+0x04]),
+			StInfo:  dynsym.Data[offset+0x04],
+			StOther: dynsym.Data[offset+0x05],
+			StShNdx: binary.LittleEndian.Uint16(dynsym.Data[offset+0x06 : offset+0x08]),
+			StValue: binary.LittleEndian.Uint64(dynsym.Data[offset+0x08 : offset+0x10]),
+			StSize:  binary.LittleEndian.Uint64(dynsym.Data[offset+0x10 : offset+0x18]),
+		}
+
+		symbol.Name = helpers.GetString(dynstr[symbol.BaseSymbol.StName:])
+		elf.DynamicSymbols = append(elf.DynamicSymbols, symbol)
+	}
+
+	elf.parseSymbolVersions()
+
+	return nil
+}
+
+// Versions are referenced by their index in .gnu.version, the names come from the definitions
+// of this object (.gnu.version_d) and the ones it needs from its dependencies (.gnu.version_r)
+func (elf *ELF64) parseSymbolVersions() {
+	versym := elf.findSectionByType(SHT_GNU_versym)
+	if versym == nil {
+		return
+	}
+
+	versionNames := make(map[uint16]string)
+
+	if verdef := elf.findSectionByType(SHT_GNU_verdef); verdef != nil {
+		strtab := elf.Sections[verdef.SectionEntry.ShLink].Data
+		data := verdef.Data
+		for offset := uint64(0); offset+0x14 <= uint64(len(data)); {
+			flags := binary.LittleEndian.Uint16(data[offset+0x2:])
+			ndx := binary.LittleEndian.Uint16(data[offset+0x4:])
+			aux := binary.LittleEndian.Uint32(data[offset+0xc:])
+			next := binary.LittleEndian.Uint32(data[offset+0x10:])
+
+			// the first auxiliary entry holds the name of the version
+			if flags&VER_FLG_BASE == 0 {
+				versionNames[ndx] = helpers.GetString(strtab[binary.LittleEndian.Uint32(data[offset+uint64(aux):]):])
+				elf.VersionDefinitions = append(elf.VersionDefinitions, versionNames[ndx])
+			}
+
+			if next == 0 {
+				break
+			}
+			offset += uint64(next)
+		}
+	}
+
+	if verneed := elf.findSectionByType(SHT_GNU_verneed); verneed != nil {
+		strtab := elf.Sections[verneed.SectionEntry.ShLink].Data
+		data := verneed.Data
+		for offset := uint64(0); offset+0x10 <= uint64(len(data)); {
+			count := binary.LittleEndian.Uint16(data[offset+0x2:])
+			aux := offset + uint64(binary.LittleEndian.Uint32(data[offset+0x8:]))
+			next := binary.LittleEndian.Uint32(data[offset+0xc:])
+
+			for i := uint16(0); i < count && aux+0x10 <= uint64(len(data)); i++ {
+				ndx := binary.LittleEndian.Uint16(data[aux+0x6:])
+				versionNames[ndx] = helpers.GetString(strtab[binary.LittleEndian.Uint32(data[aux+0x8:]):])
+				aux += uint64(binary.LittleEndian.Uint32(data[aux+0xc:]))
+			}
+
+			if next == 0 {
+				break
+			}
+			offset += uint64(next)
+		}
+	}
+
+	for idx, symbol := range elf.DynamicSymbols {
+		if uint64(2*idx+2) > uint64(len(versym.Data)) {
+			break
+		}
+
+		ndx := binary.LittleEndian.Uint16(versym.Data[2*idx:])
+		symbol.HiddenVersion = ndx&VERSYM_HIDDEN != 0
+		symbol.Version = versionNames[ndx&^VERSYM_HIDDEN]
+	}
+}
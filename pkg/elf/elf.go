@@ -36,11 +36,16 @@ const (
 	STT_FUNC               // 2
 	STT_SECTION            // 3
 	STT_FILE               // 4
+	STT_COMMON             // 5
+	STT_TLS                // 6
 
 	STT_LOOS   STT = 10
 	STT_HIOS   STT = 12
 	STT_LOPROC STT = 13
 	STT_HIPROC STT = 15
+
+	// symbol value is the address of a resolver returning the address of the implementation
+	STT_GNU_IFUNC STT = 10
 )
 
 type STB byte
@@ -55,6 +60,14 @@ const (
 	STB_HIPROC STB = 15   // 15
 )
 
+// Symbol visibility, the low bits of st_other
+const (
+	STV_DEFAULT   = 0
+	STV_INTERNAL  = 1
+	STV_HIDDEN    = 2
+	STV_PROTECTED = 3
+)
+
 const (
 	EI_MAG0       = 0
 	EI_MAG1       = 1
@@ -128,25 +141,35 @@ const (
 	SHT_REL                      // 9
 	SHT_SHLIB                    // 10
 	SHT_DYNSYM                   // 11
+	SHT_GROUP    SHT_TYPE = 17   // section group, the sections are linked in or discarded together
+	SHT_RELR     SHT_TYPE = 19   // packed relative relocations
 	SHT_LOOS     SHT_TYPE = 0x60000000
 	SHT_HIOS     SHT_TYPE = 0x6FFFFFFF
 	SHT_LOPROC   SHT_TYPE = 0x70000000
 	SHT_HIPROC   SHT_TYPE = 0x70000000
+
+	SHT_GNU_HASH    SHT_TYPE = 0x6FFFFFF6
+	SHT_GNU_verdef  SHT_TYPE = 0x6FFFFFFD // versions defined by a shared object
+	SHT_GNU_verneed SHT_TYPE = 0x6FFFFFFE // versions required from its dependencies
+	SHT_GNU_versym  SHT_TYPE = 0x6FFFFFFF // version index of each dynamic symbol
+
+	SHT_LLVM_ADDRSIG SHT_TYPE = 0x6FFF4C03 // indices of the symbols whose address is taken
 )
 
 type SHT_FLAGS uint64
 
 const (
-	SHF_WRITE            SHT_FLAGS = 1 << iota //0x1
-	SHF_ALLOC                                  // 0x2
-	SHF_EXECINSTR                              // 0x4
-	SHF_MERGE                                  // 0x10
-	SHF_STRINGS                                // 0x20
-	SHF_INFO_LINK                              // 0x40
-	SHF_LINK_ORDER                             // 0x80
-	SHF_OS_NONCONFORMING                       // 0x100
-	SHF_GROUP                                  // 0x200
-	SHF_TLS                                    // 0x400
+	SHF_WRITE            SHT_FLAGS = 0x1
+	SHF_ALLOC            SHT_FLAGS = 0x2
+	SHF_EXECINSTR        SHT_FLAGS = 0x4
+	SHF_MERGE            SHT_FLAGS = 0x10
+	SHF_STRINGS          SHT_FLAGS = 0x20
+	SHF_INFO_LINK        SHT_FLAGS = 0x40
+	SHF_LINK_ORDER       SHT_FLAGS = 0x80
+	SHF_OS_NONCONFORMING SHT_FLAGS = 0x100
+	SHF_GROUP            SHT_FLAGS = 0x200
+	SHF_TLS              SHT_FLAGS = 0x400
+	SHF_GNU_RETAIN       SHT_FLAGS = 0x200000
 
 	SHF_MASKOS   SHT_FLAGS = 0x0F000000
 	SHF_MASKPROC SHT_FLAGS = 0xF0000000
@@ -160,10 +183,16 @@ const (
 	PT_NOTE    = 4
 	PT_SHLIB   = 5
 	PT_PHDR    = 6
+	PT_TLS     = 7
 	PT_LOOS    = 0x60000000
 	PT_HIOS    = 0x6FFFFFFF
 	PT_LOPROC  = 0x70000000
 	PT_HIPROC  = 0x7FFFFFFF
+
+	PT_GNU_EH_FRAME = 0x6474E550 // .eh_frame_hdr
+	PT_GNU_STACK    = 0x6474E551 // permissions of the stack
+	PT_GNU_RELRO    = 0x6474E552 // read-only once relocated
+	PT_GNU_PROPERTY = 0x6474E553 // .note.gnu.property of the program
 )
 
 const (
@@ -176,14 +205,98 @@ const (
 
 // Hopefully the only ones that matter
 const (
-	R_X86_64_NONE     = 0  // none none
-	R_X86_64_64       = 1  // word64 S + A
-	R_X86_64_PC32     = 2  // word32 S + A - P
-	R_X86_64_GOT32    = 3  // word32 G + A
-	R_X86_64_PLT32    = 4  // word32 L + A - P
-	R_X86_64_PC64     = 24 // word64 S + A - P
-	R_X86_64_GOTOFF64 = 25 // word64 S + A - GOT
-	R_X86_64_GOTPC32  = 26 // word32 GOT + A - P
+	R_X86_64_NONE            = 0  // none none
+	R_X86_64_64              = 1  // word64 S + A
+	R_X86_64_PC32            = 2  // word32 S + A - P
+	R_X86_64_GOT32           = 3  // word32 G + A
+	R_X86_64_PLT32           = 4  // word32 L + A - P
+	R_X86_64_COPY            = 5  // none, copy the symbol at runtime
+	R_X86_64_GLOB_DAT        = 6  // word64 S
+	R_X86_64_JUMP_SLOT       = 7  // word64 S
+	R_X86_64_RELATIVE        = 8  // word64 B + A
+	R_X86_64_GOTPCREL        = 9  // word32 G + GOT + A - P
+	R_X86_64_32              = 10 // word32 S + A
+	R_X86_64_32S             = 11 // word32 S + A
+	R_X86_64_DTPMOD64        = 16 // word64 module id
+	R_X86_64_DTPOFF64        = 17 // word64 offset in the TLS block
+	R_X86_64_TPOFF64         = 18 // word64 offset from the thread pointer
+	R_X86_64_TLSGD           = 19 // word32 GOT entry pair for GD, PC relative
+	R_X86_64_TLSLD           = 20 // word32 GOT entry pair for LD, PC relative
+	R_X86_64_DTPOFF32        = 21 // word32 offset in the TLS block
+	R_X86_64_GOTTPOFF        = 22 // word32 GOT entry for the TP offset, PC relative
+	R_X86_64_TPOFF32         = 23 // word32 offset from the thread pointer
+	R_X86_64_PC64            = 24 // word64 S + A - P
+	R_X86_64_GOTOFF64        = 25 // word64 S + A - GOT
+	R_X86_64_GOTPC32         = 26 // word32 GOT + A - P
+	R_X86_64_GOTPC32_TLSDESC = 34 // word32 GOT entry for the TLS descriptor, PC relative
+	R_X86_64_TLSDESC_CALL    = 35 // none, marks the call through the TLS descriptor
+	R_X86_64_TLSDESC         = 36 // word64 x 2 TLS descriptor
+	R_X86_64_IRELATIVE       = 37 // word64 indirect (B + A)()
+	R_X86_64_GOTPCRELX       = 41 // word32 G + GOT + A - P, relaxable
+	R_X86_64_REX_GOTPCRELX   = 42 // word32 G + GOT + A - P, relaxable with REX prefix
+)
+
+// Tags of the .dynamic entries
+const (
+	DT_NULL         = 0
+	DT_NEEDED       = 1
+	DT_PLTRELSZ     = 2
+	DT_PLTGOT       = 3
+	DT_HASH         = 4
+	DT_STRTAB       = 5
+	DT_SYMTAB       = 6
+	DT_RELA         = 7
+	DT_RELASZ       = 8
+	DT_RELAENT      = 9
+	DT_STRSZ        = 10
+	DT_SYMENT       = 11
+	DT_INIT         = 12
+	DT_FINI         = 13
+	DT_SONAME       = 14
+	DT_RPATH        = 15
+	DT_SYMBOLIC     = 16
+	DT_REL          = 17
+	DT_RELSZ        = 18
+	DT_RELENT       = 19
+	DT_PLTREL       = 20
+	DT_DEBUG        = 21
+	DT_TEXTREL      = 22
+	DT_JMPREL       = 23
+	DT_BIND_NOW     = 24
+	DT_INIT_ARRAY   = 25
+	DT_FINI_ARRAY   = 26
+	DT_INIT_ARRAYSZ = 27
+	DT_FINI_ARRAYSZ = 28
+	DT_RUNPATH      = 29
+	DT_FLAGS        = 30
+	DT_RELRSZ       = 35
+	DT_RELR         = 36
+	DT_RELRENT      = 37
+	DT_GNU_HASH     = 0x6FFFFEF5
+	DT_VERSYM       = 0x6FFFFFF0
+	DT_RELACOUNT    = 0x6FFFFFF9
+	DT_FLAGS_1      = 0x6FFFFFFB
+	DT_VERDEF       = 0x6FFFFFFC
+	DT_VERDEFNUM    = 0x6FFFFFFD
+	DT_VERNEED      = 0x6FFFFFFE
+	DT_VERNEEDNUM   = 0x6FFFFFFF
+)
+
+// DT_FLAGS values
+const (
+	DF_ORIGIN     = 0x1
+	DF_SYMBOLIC   = 0x2
+	DF_TEXTREL    = 0x4
+	DF_BIND_NOW   = 0x8
+	DF_STATIC_TLS = 0x10
+)
+
+// DT_FLAGS_1 values
+const (
+	DF_1_NOW      = 0x1
+	DF_1_NODELETE = 0x8
+	DF_1_ORIGIN   = 0x80
+	DF_1_PIE      = 0x08000000
 )
 
 var (
@@ -403,6 +516,10 @@ func (elf64Shdr ELF64Shdr) IsWritable() bool {
 	return (elf64Shdr.ShFlags & SHF_WRITE) != 0
 }
 
+func (elf64Shdr ELF64Shdr) IsTLS() bool {
+	return (elf64Shdr.ShFlags & SHF_TLS) != 0
+}
+
 // Section header entries
 type ELF64Shdr struct {
 	ShName  uint32    // offset to the section name relative to section name table
@@ -437,6 +554,8 @@ type Relocation struct {
 	Addend     uint64
 	isRela     bool
 	SymbolName string
+	// the referenced symbol, relocations against section symbols have no name
+	Symbol *Symbol
 }
 
 func (relocation Relocation) GetSym() uint32 {
@@ -461,6 +580,11 @@ type ELF64Phdr struct {
 type Symbol struct {
 	BaseSymbol *ELF64Sym
 	Name       string
+
+	// version of a dynamic symbol, empty if it is not versioned
+	Version string
+	// a hidden version is not the default one, only references to name@version bind to it
+	HiddenVersion bool
 }
 
 type Section struct {
@@ -474,12 +598,22 @@ type Section struct {
 type ELF64 struct {
 	Filename string
 	File     *os.File
+	// archive that the object was extracted from, empty if it was given as a file
+	Archive string
 
 	Header      ELF64Ehdr
 	PhdrEntries []ELF64Phdr
 
 	Symbols  []*Symbol
 	Sections []*Section
+
+	// shared objects only, filled from .dynamic and .dynsym
+	Dynamic        []DynamicEntry
+	DynamicSymbols []*Symbol
+	SOName         string
+	Needed         []string
+	// versions defined by .gnu.version_d, the base version excluded
+	VersionDefinitions []string
 }
 
 func (header *ELF64Ehdr) FillIdentExecutable() {
@@ -519,8 +653,11 @@ func (elf *ELF64) ParseShdr(elfDump []byte) error {
 
 		sectionName := helpers.GetString(elfDump[off+uint64(entry.ShName):])
 
+		// SHT_NOBITS sections (.bss, .tbss) occupy no space in the file, they are zero filled
 		entryData := make([]byte, entry.ShSize)
-		copy(entryData, elfDump[entry.ShOff:entry.ShOff+entry.ShSize])
+		if entry.ShType != SHT_NOBITS {
+			copy(entryData, elfDump[entry.ShOff:entry.ShOff+entry.ShSize])
+		}
 		section := &Section{
 			SectionEntry: entry,
 			Data:         entryData,
@@ -611,7 +748,8 @@ func (elf *ELF64) ParseRelocations() {
 				currentEnt.Addend = binary.LittleEndian.Uint64(relSection.Data[relEntOff+0x10 : relEntOff+0x18])
 			}
 
-			currentEnt.SymbolName = elf.Symbols[currentEnt.GetSym()].Name
+			currentEnt.Symbol = elf.Symbols[currentEnt.GetSym()]
+			currentEnt.SymbolName = currentEnt.Symbol.Name
 			refSection.Relocations = append(refSection.Relocations, currentEnt)
 		}
 	}
@@ -625,6 +763,14 @@ func (sym ELF64Sym) GetBinding() STB {
 	return STB(sym.StInfo&0xf0) >> 4
 }
 
+func (sym *ELF64Sym) SetBinding(binding STB) {
+	sym.StInfo = byte(binding)<<4 | sym.StInfo&0x0f
+}
+
+func (sym ELF64Sym) GetVisibility() byte {
+	return sym.StOther & 0x3
+}
+
 func NewELF(filepath string) (*ELF64, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -637,13 +783,23 @@ func NewELF(filepath string) (*ELF64, error) {
 		return nil, err
 	}
 
+	elf, err := ParseELF(filepath, buffer)
+	if err != nil {
+		return nil, err
+	}
+	elf.File = file
+
+	return elf, nil
+}
+
+// Parses an ELF file that is already in memory, like the members of an archive
+func ParseELF(filename string, buffer []byte) (*ELF64, error) {
 	elf := &ELF64{
-		Filename: filepath,
-		File:     file,
+		Filename: filename,
 	}
 
 	// Parse ELF header
-	err = elf.Header.Parse(buffer)
+	err := elf.Header.Parse(buffer)
 	if err != nil {
 		return nil, err
 	}
@@ -654,6 +810,16 @@ func NewELF(filepath string) (*ELF64, error) {
 		return nil, err
 	}
 
+	// Shared objects are only used for their dynamic symbols
+	if elf.Header.Type == ET_DYN {
+		err = elf.ParseDynamic()
+		if err != nil {
+			return nil, err
+		}
+
+		return elf, nil
+	}
+
 	// Parse Symbol Table
 	elf.ParseSymTable(buffer)
 	if err != nil {
@@ -665,9 +831,37 @@ func NewELF(filepath string) (*ELF64, error) {
 	return elf, nil
 }
 
-func (elf *ELF64) SortSections() {
+// The null section comes first, then the allocated sections grouped by permissions: read-only data,
+// code, the TLS template (.tdata followed by .tbss) so it is contiguous at the start of the
+// writable part, the other sections that are read-only once relocated, the rest of the writable
+// sections with .bss last as it takes no space in the file. Sections that are not loaded (string
+// tables) are at the end.
+func (elf *ELF64) SortSections(isRelro func(*Section) bool) {
+	rank := func(section *Section) int {
+		entry := section.SectionEntry
+		switch {
+		case entry.ShType == SHT_NULL:
+			return 0
+		case entry.ShFlags&SHF_ALLOC == 0:
+			return 8
+		case !entry.IsWritable() && entry.ShFlags&SHF_EXECINSTR == 0:
+			return 1
+		case !entry.IsWritable():
+			return 2
+		case entry.IsTLS() && entry.ShType != SHT_NOBITS:
+			return 3
+		case entry.IsTLS():
+			return 4
+		case isRelro(section):
+			return 5
+		case entry.ShType == SHT_NOBITS:
+			return 7
+		}
+		return 6
+	}
+
 	sort.SliceStable(elf.Sections, func(i, j int) bool {
-		return !elf.Sections[i].SectionEntry.IsWritable() && elf.Sections[j].SectionEntry.IsWritable()
+		return rank(elf.Sections[i]) < rank(elf.Sections[j])
 	})
 }
 
@@ -721,45 +915,29 @@ func (shdr *ELF64Shdr) Serialize() []byte {
 	return buffer
 }
 
+// Sections are written at their offset, the gaps left by alignment are zero filled
 func (elf *ELF64) WriteELF() error {
-	// clear the file if it exists
-	file, err := os.OpenFile(elf.Filename, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, os.FileMode(int(0777)))
-	file, err = os.OpenFile(elf.Filename, os.O_APPEND|os.O_EXCL|os.O_RDWR, os.FileMode(int(0777)))
-	if err != nil {
-		return err
-	}
+	size := elf.Header.ShOff + uint64(len(elf.Sections))*0x40
+	buffer := make([]byte, size)
 
-	// Write header
-	_, err = file.Write(elf.Header.Serialize())
-	if err != nil {
-		log.Errorf("Error when writing serialized header: %v\n", err.Error())
-	}
+	copy(buffer, elf.Header.Serialize())
 
-	// Write Program Header Table
 	for idx, phdr := range elf.PhdrEntries {
-		_, err = file.Write(phdr.Serialize())
-		if err != nil {
-			log.Errorf("Error when writing serialized pheader[%d]: %v\n", idx, err.Error())
-		}
+		copy(buffer[elf.Header.PhOff+uint64(idx)*0x38:], phdr.Serialize())
 	}
 
-	// Write Section Entries
-	for idx, section := range elf.Sections {
-		_, err = file.Write(section.Data)
-		if err != nil {
-			log.Errorf("Error when writing data of section[%d]: %v\n", idx, err.Error())
+	for _, section := range elf.Sections {
+		if section.SectionEntry.ShType == SHT_NOBITS {
+			continue
 		}
+		copy(buffer[section.SectionEntry.ShOff:], section.Data)
 	}
 
-	// Write Section Header Table
 	for idx, section := range elf.Sections {
-		_, err = file.Write(section.SectionEntry.Serialize())
-		if err != nil {
-			log.Errorf("Error when writing entry of section[%d]: %v\n", idx, err.Error())
-		}
+		copy(buffer[elf.Header.ShOff+uint64(idx)*0x40:], section.SectionEntry.Serialize())
 	}
 
-	return nil
+	return os.WriteFile(elf.Filename, buffer, os.FileMode(int(0777)))
 }
 
 func (elf *ELF64) String() string {
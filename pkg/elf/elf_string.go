@@ -13,27 +13,30 @@ func _() {
 	_ = x[STT_FUNC-2]
 	_ = x[STT_SECTION-3]
 	_ = x[STT_FILE-4]
+	_ = x[STT_COMMON-5]
+	_ = x[STT_TLS-6]
 	_ = x[STT_LOOS-10]
 	_ = x[STT_HIOS-12]
 	_ = x[STT_LOPROC-13]
 	_ = x[STT_HIPROC-15]
+	_ = x[STT_GNU_IFUNC-10]
 }
 
 const (
-	_STT_name_0 = "STT_NOTYPESTT_OBJECTSTT_FUNCSTT_SECTIONSTT_FILE"
+	_STT_name_0 = "STT_NOTYPESTT_OBJECTSTT_FUNCSTT_SECTIONSTT_FILESTT_COMMONSTT_TLS"
 	_STT_name_1 = "STT_LOOS"
 	_STT_name_2 = "STT_HIOSSTT_LOPROC"
 	_STT_name_3 = "STT_HIPROC"
 )
 
 var (
-	_STT_index_0 = [...]uint8{0, 10, 20, 28, 39, 47}
+	_STT_index_0 = [...]uint8{0, 10, 20, 28, 39, 47, 57, 64}
 	_STT_index_2 = [...]uint8{0, 8, 18}
 )
 
 func (i STT) String() string {
 	switch {
-	case i <= 4:
+	case i <= 6:
 		return _STT_name_0[_STT_index_0[i]:_STT_index_0[i+1]]
 	case i == 10:
 		return _STT_name_1
@@ -99,11 +102,11 @@ const _ElfClass_name = "ELFCLASS32ELFCLASS64"
 var _ElfClass_index = [...]uint8{0, 10, 20}
 
 func (i ElfClass) String() string {
-	i -= 1
-	if i >= ElfClass(len(_ElfClass_index)-1) {
-		return "ElfClass(" + strconv.FormatInt(int64(i+1), 10) + ")"
+	idx := int(i) - 1
+	if i < 1 || idx >= len(_ElfClass_index)-1 {
+		return "ElfClass(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _ElfClass_name[_ElfClass_index[i]:_ElfClass_index[i+1]]
+	return _ElfClass_name[_ElfClass_index[idx]:_ElfClass_index[idx+1]]
 }
 func _() {
 	// An "invalid array index" compiler error signifies that the constant values have changed.
@@ -118,11 +121,11 @@ const _ElfData_name = "ELFDATA2LSBELFDATA2MSB"
 var _ElfData_index = [...]uint8{0, 11, 22}
 
 func (i ElfData) String() string {
-	i -= 1
-	if i >= ElfData(len(_ElfData_index)-1) {
-		return "ElfData(" + strconv.FormatInt(int64(i+1), 10) + ")"
+	idx := int(i) - 1
+	if i < 1 || idx >= len(_ElfData_index)-1 {
+		return "ElfData(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _ElfData_name[_ElfData_index[i]:_ElfData_index[i+1]]
+	return _ElfData_name[_ElfData_index[idx]:_ElfData_index[idx+1]]
 }
 func _() {
 	// An "invalid array index" compiler error signifies that the constant values have changed.
@@ -210,32 +213,51 @@ func _() {
 	_ = x[SHT_REL-9]
 	_ = x[SHT_SHLIB-10]
 	_ = x[SHT_DYNSYM-11]
+	_ = x[SHT_GROUP-17]
+	_ = x[SHT_RELR-19]
 	_ = x[SHT_LOOS-1610612736]
 	_ = x[SHT_HIOS-1879048191]
 	_ = x[SHT_LOPROC-1879048192]
 	_ = x[SHT_HIPROC-1879048192]
+	_ = x[SHT_GNU_HASH-1879048182]
+	_ = x[SHT_GNU_verdef-1879048189]
+	_ = x[SHT_GNU_verneed-1879048190]
+	_ = x[SHT_GNU_versym-1879048191]
+	_ = x[SHT_LLVM_ADDRSIG-1879002115]
 }
 
 const (
 	_SHT_TYPE_name_0 = "SHT_NULLSHT_PROGBITSSHT_SYMTABSHT_STRTABSHT_RELASHT_HASHSHT_DYNAMICSHT_NOTESHT_NOBITSSHT_RELSHT_SHLIBSHT_DYNSYM"
-	_SHT_TYPE_name_1 = "SHT_LOOS"
-	_SHT_TYPE_name_2 = "SHT_HIOSSHT_LOPROC"
+	_SHT_TYPE_name_1 = "SHT_GROUP"
+	_SHT_TYPE_name_2 = "SHT_RELR"
+	_SHT_TYPE_name_3 = "SHT_LOOS"
+	_SHT_TYPE_name_4 = "SHT_LLVM_ADDRSIG"
+	_SHT_TYPE_name_5 = "SHT_GNU_HASH"
+	_SHT_TYPE_name_6 = "SHT_GNU_verdefSHT_GNU_verneedSHT_HIOSSHT_LOPROC"
 )
 
 var (
 	_SHT_TYPE_index_0 = [...]uint8{0, 8, 20, 30, 40, 48, 56, 67, 75, 85, 92, 101, 111}
-	_SHT_TYPE_index_2 = [...]uint8{0, 8, 18}
+	_SHT_TYPE_index_6 = [...]uint8{0, 14, 29, 37, 47}
 )
 
 func (i SHT_TYPE) String() string {
 	switch {
 	case i <= 11:
 		return _SHT_TYPE_name_0[_SHT_TYPE_index_0[i]:_SHT_TYPE_index_0[i+1]]
-	case i == 1610612736:
+	case i == 17:
 		return _SHT_TYPE_name_1
-	case 1879048191 <= i && i <= 1879048192:
-		i -= 1879048191
-		return _SHT_TYPE_name_2[_SHT_TYPE_index_2[i]:_SHT_TYPE_index_2[i+1]]
+	case i == 19:
+		return _SHT_TYPE_name_2
+	case i == 1610612736:
+		return _SHT_TYPE_name_3
+	case i == 1879002115:
+		return _SHT_TYPE_name_4
+	case i == 1879048182:
+		return _SHT_TYPE_name_5
+	case 1879048189 <= i && i <= 1879048192:
+		i -= 1879048189
+		return _SHT_TYPE_name_6[_SHT_TYPE_index_6[i]:_SHT_TYPE_index_6[i+1]]
 	default:
 		return "SHT_TYPE(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
@@ -247,32 +269,34 @@ func _() {
 	_ = x[SHF_WRITE-1]
 	_ = x[SHF_ALLOC-2]
 	_ = x[SHF_EXECINSTR-4]
-	_ = x[SHF_MERGE-8]
-	_ = x[SHF_STRINGS-16]
-	_ = x[SHF_INFO_LINK-32]
-	_ = x[SHF_LINK_ORDER-64]
-	_ = x[SHF_OS_NONCONFORMING-128]
-	_ = x[SHF_GROUP-256]
-	_ = x[SHF_TLS-512]
+	_ = x[SHF_MERGE-16]
+	_ = x[SHF_STRINGS-32]
+	_ = x[SHF_INFO_LINK-64]
+	_ = x[SHF_LINK_ORDER-128]
+	_ = x[SHF_OS_NONCONFORMING-256]
+	_ = x[SHF_GROUP-512]
+	_ = x[SHF_TLS-1024]
+	_ = x[SHF_GNU_RETAIN-2097152]
 	_ = x[SHF_MASKOS-251658240]
 	_ = x[SHF_MASKPROC-4026531840]
 }
 
-const _SHT_FLAGS_name = "SHF_WRITESHF_ALLOCSHF_EXECINSTRSHF_MERGESHF_STRINGSSHF_INFO_LINKSHF_LINK_ORDERSHF_OS_NONCONFORMINGSHF_GROUPSHF_TLSSHF_MASKOSSHF_MASKPROC"
+const _SHT_FLAGS_name = "SHF_WRITESHF_ALLOCSHF_EXECINSTRSHF_MERGESHF_STRINGSSHF_INFO_LINKSHF_LINK_ORDERSHF_OS_NONCONFORMINGSHF_GROUPSHF_TLSSHF_GNU_RETAINSHF_MASKOSSHF_MASKPROC"
 
 var _SHT_FLAGS_map = map[SHT_FLAGS]string{
 	1:          _SHT_FLAGS_name[0:9],
 	2:          _SHT_FLAGS_name[9:18],
 	4:          _SHT_FLAGS_name[18:31],
-	8:          _SHT_FLAGS_name[31:40],
-	16:         _SHT_FLAGS_name[40:51],
-	32:         _SHT_FLAGS_name[51:64],
-	64:         _SHT_FLAGS_name[64:78],
-	128:        _SHT_FLAGS_name[78:98],
-	256:        _SHT_FLAGS_name[98:107],
-	512:        _SHT_FLAGS_name[107:114],
-	251658240:  _SHT_FLAGS_name[114:124],
-	4026531840: _SHT_FLAGS_name[124:136],
+	16:         _SHT_FLAGS_name[31:40],
+	32:         _SHT_FLAGS_name[40:51],
+	64:         _SHT_FLAGS_name[51:64],
+	128:        _SHT_FLAGS_name[64:78],
+	256:        _SHT_FLAGS_name[78:98],
+	512:        _SHT_FLAGS_name[98:107],
+	1024:       _SHT_FLAGS_name[107:114],
+	2097152:    _SHT_FLAGS_name[114:128],
+	251658240:  _SHT_FLAGS_name[128:138],
+	4026531840: _SHT_FLAGS_name[138:150],
 }
 
 func (i SHT_FLAGS) String() string {
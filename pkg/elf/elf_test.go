@@ -218,6 +218,49 @@ func TestRelocationsParsing(t *testing.T) {
 	}
 }
 
+func TestSharedObjectParsing(t *testing.T) {
+	elf, err := NewELF("../../data/sample_shared_lib.so")
+	assert.Truef(t, err == nil, "parsing failed: %v", err)
+
+	assert.Truef(t, elf.Header.Type == ET_DYN, "wrong type got=%v", elf.Header.Type)
+	assert.Truef(t, elf.SOName == "libsample.so.1", "wrong soname got=%s", elf.SOName)
+	assert.Truef(t, len(elf.Needed) == 0, "the library has no dependencies")
+
+	type version struct {
+		version string
+		hidden  bool
+	}
+
+	refVersions := map[version]bool{
+		{"LIB_1.0", true}:  false, // lib_func@LIB_1.0
+		{"LIB_2.0", false}: false, // lib_func@@LIB_2.0
+	}
+
+	for _, symbol := range elf.DynamicSymbols {
+		switch symbol.Name {
+		case "lib_func":
+			refVersions[version{symbol.Version, symbol.HiddenVersion}] = true
+		case "lib_var":
+			assert.Truef(t, symbol.Version == "LIB_1.0" && !symbol.HiddenVersion, "wrong version for lib_var got=%s", symbol.Version)
+		}
+	}
+
+	for ref, found := range refVersions {
+		assert.Truef(t, found, "lib_func with version %v not found", ref)
+	}
+
+	other, err := NewELF("../../data/sample_shared_lib_other.so")
+	assert.Truef(t, err == nil, "parsing failed: %v", err)
+	assert.Truef(t, other.SOName == "", "the library has no soname")
+	assert.Truef(t, reflect.DeepEqual(other.Needed, []string{"libsample.so.1"}), "wrong DT_NEEDED got=%v", other.Needed)
+
+	for _, symbol := range other.DynamicSymbols {
+		if symbol.Name == "lib_func" {
+			assert.Truef(t, symbol.Version == "LIB_2.0", "needed version not found got=%s", symbol.Version)
+		}
+	}
+}
+
 func findSectionByName(name string, elf *ELF64) *Section {
 	for _, section := range elf.Sections {
 		if section.Name == name {
@@ -226,3 +269,16 @@ func findSectionByName(name string, elf *ELF64) *Section {
 	}
 	return nil
 }
+
+func TestArchiveParsing(t *testing.T) {
+	assert.True(t, IsArchive("../../data/libarchive.a"), "libarchive.a should be an archive")
+	assert.False(t, IsArchive("../../data/sample_relocatable_elf64.o"), "an object is not an archive")
+
+	archive, err := NewArchive("../../data/libarchive.a")
+	assert.Truef(t, err == nil, "parsing failed: %v", err)
+	assert.Truef(t, len(archive.Members) == 3, "expected 3 members got=%d", len(archive.Members))
+
+	member := archive.Members[0]
+	assert.Truef(t, member.Filename == "../../data/libarchive.a(arch_b.o)", "wrong member name got=%s", member.Filename)
+	assert.Truef(t, member.Archive == "libarchive.a", "wrong archive of the member got=%s", member.Archive)
+}
@@ -0,0 +1,53 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// flag of the groups of which the output keeps a single copy, found by the signature
+const GRP_COMDAT = 0x1
+
+var InvalidGroupErr = errors.New("Invalid section group")
+
+// A SHT_GROUP section, a flag word followed by the indices of the member sections. The
+// signature is the name of the symbol given by sh_info, or the name of its section for a
+// section symbol.
+type Group struct {
+	Signature string
+	Flags     uint32
+	Sections  []*Section
+}
+
+func (elf *ELF64) Groups() ([]*Group, error) {
+	groups := []*Group{}
+	for _, section := range elf.Sections {
+		entry := section.SectionEntry
+		if entry.ShType != SHT_GROUP {
+			continue
+		}
+
+		if len(section.Data) < 4 || len(section.Data)%4 != 0 || int(entry.ShInfo) >= len(elf.Symbols) {
+			return nil, fmt.Errorf("%w: %s in %s", InvalidGroupErr, section.Name, elf.Filename)
+		}
+
+		symbol := elf.Symbols[entry.ShInfo]
+		group := &Group{Signature: symbol.Name, Flags: binary.LittleEndian.Uint32(section.Data)}
+		if symbol.BaseSymbol.GetType() == STT_SECTION && int(symbol.BaseSymbol.StShNdx) < len(elf.Sections) {
+			group.Signature = elf.Sections[symbol.BaseSymbol.StShNdx].Name
+		}
+
+		for offset := 4; offset < len(section.Data); offset += 4 {
+			index := binary.LittleEndian.Uint32(section.Data[offset:])
+			if int(index) >= len(elf.Sections) {
+				return nil, fmt.Errorf("%w: %s in %s", InvalidGroupErr, section.Name, elf.Filename)
+			}
+			group.Sections = append(group.Sections, elf.Sections[index])
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
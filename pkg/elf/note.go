@@ -0,0 +1,137 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/andreistan26/golink/pkg/helpers"
+)
+
+const (
+	// unique identifier of the output, .note.gnu.build-id
+	NT_GNU_BUILD_ID = 3
+	// type of the notes of .note.gnu.property
+	NT_GNU_PROPERTY_TYPE_0 = 5
+
+	// x86 features that every input supports, the output only keeps the common ones
+	GNU_PROPERTY_X86_FEATURE_1_AND   = 0xc0000002
+	GNU_PROPERTY_X86_FEATURE_1_IBT   = 0x1
+	GNU_PROPERTY_X86_FEATURE_1_SHSTK = 0x2
+)
+
+var InvalidNoteErr = errors.New("Invalid note")
+
+type Note struct {
+	Name string
+	Type uint32
+	Desc []byte
+}
+
+// A program property, the meaning of its data depends on the type
+type GNUProperty struct {
+	Type uint32
+	Data []byte
+}
+
+// Notes are a name and a descriptor, each padded to the alignment of the section
+func ParseNotes(data []byte, align uint64) ([]Note, error) {
+	if align < 4 {
+		align = 4
+	}
+
+	notes := []Note{}
+	for offset := uint64(0); offset+0xc <= uint64(len(data)); {
+		nameSize := uint64(binary.LittleEndian.Uint32(data[offset:]))
+		descSize := uint64(binary.LittleEndian.Uint32(data[offset+0x4:]))
+		noteType := binary.LittleEndian.Uint32(data[offset+0x8:])
+
+		nameOffset := offset + 0xc
+		descOffset := alignUp(nameOffset+nameSize, align)
+		if descOffset+descSize > uint64(len(data)) {
+			return nil, InvalidNoteErr
+		}
+
+		notes = append(notes, Note{
+			Name: helpers.GetString(data[nameOffset : nameOffset+nameSize]),
+			Type: noteType,
+			Desc: data[descOffset : descOffset+descSize],
+		})
+
+		offset = alignUp(descOffset+descSize, align)
+	}
+
+	return notes, nil
+}
+
+// Parses the properties of the .note.gnu.property sections of the object, the properties of
+// the same type are merged by the caller
+func (elf *ELF64) GNUProperties() ([]GNUProperty, error) {
+	properties := []GNUProperty{}
+	for _, section := range elf.Sections {
+		if section.SectionEntry.ShType != SHT_NOTE || section.Name != ".note.gnu.property" {
+			continue
+		}
+
+		notes, err := ParseNotes(section.Data, section.SectionEntry.ShAddrAlign)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s in %s", err, section.Name, elf.Filename)
+		}
+
+		for _, note := range notes {
+			if note.Name != "GNU" || note.Type != NT_GNU_PROPERTY_TYPE_0 {
+				continue
+			}
+
+			// each property is padded to 8 bytes
+			for offset := uint64(0); offset+0x8 <= uint64(len(note.Desc)); {
+				propertyType := binary.LittleEndian.Uint32(note.Desc[offset:])
+				size := uint64(binary.LittleEndian.Uint32(note.Desc[offset+0x4:]))
+				if offset+0x8+size > uint64(len(note.Desc)) {
+					return nil, fmt.Errorf("%w: %s in %s", InvalidNoteErr, section.Name, elf.Filename)
+				}
+
+				properties = append(properties, GNUProperty{
+					Type: propertyType,
+					Data: note.Desc[offset+0x8 : offset+0x8+size],
+				})
+				offset = alignUp(offset+0x8+size, 8)
+			}
+		}
+	}
+
+	return properties, nil
+}
+
+// Serializes the properties in a single NT_GNU_PROPERTY_TYPE_0 note, aligned to 8 bytes
+func GNUPropertyNote(properties []GNUProperty) []byte {
+	desc := []byte{}
+	for _, property := range properties {
+		header := make([]byte, 0x8)
+		binary.LittleEndian.PutUint32(header, property.Type)
+		binary.LittleEndian.PutUint32(header[0x4:], uint32(len(property.Data)))
+		desc = append(desc, header...)
+		desc = append(desc, property.Data...)
+		desc = append(desc, make([]byte, alignUp(uint64(len(desc)), 8)-uint64(len(desc)))...)
+	}
+
+	return NoteBytes("GNU", NT_GNU_PROPERTY_TYPE_0, desc)
+}
+
+// Serializes a note, the name and the descriptor are padded to 4 bytes
+func NoteBytes(name string, noteType uint32, desc []byte) []byte {
+	nameSize := uint64(len(name) + 1)
+
+	note := make([]byte, 0xc+alignUp(nameSize, 4))
+	binary.LittleEndian.PutUint32(note, uint32(nameSize))
+	binary.LittleEndian.PutUint32(note[0x4:], uint32(len(desc)))
+	binary.LittleEndian.PutUint32(note[0x8:], noteType)
+	copy(note[0xc:], name)
+
+	note = append(note, desc...)
+	return append(note, make([]byte, alignUp(uint64(len(note)), 4)-uint64(len(note)))...)
+}
+
+func alignUp(value, align uint64) uint64 {
+	return (value + align - 1) &^ (align - 1)
+}
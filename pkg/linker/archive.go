@@ -0,0 +1,58 @@
+package linker
+
+import (
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/helpers"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+// Links in the members of the archive that define a symbol referenced by the inputs given
+// before it. A member can reference symbols of the following ones, so the members are scanned
+// again until no more are needed.
+func (linker *Linker) addArchive(archive *elf.Archive) error {
+	loaded := make([]bool, len(archive.Members))
+
+	for changed := true; changed; {
+		changed = false
+		for idx, member := range archive.Members {
+			if loaded[idx] || !linker.isNeededMember(member) {
+				continue
+			}
+
+			log.Debugf("Loading archive member %s", member.Filename)
+			if err := linker.addObject(member); err != nil {
+				return err
+			}
+			loaded[idx] = true
+			changed = true
+		}
+	}
+
+	return nil
+}
+
+// Weak references do not pull members out of archives
+func (linker *Linker) isNeededMember(member *elf.ELF64) bool {
+	for _, symbol := range member.Symbols {
+		binding := symbol.BaseSymbol.GetBinding()
+		if symbol.BaseSymbol.StShNdx == elf.SHN_UNDEF || (binding != elf.STB_GLOBAL && binding != elf.STB_WEAK) {
+			continue
+		}
+
+		if _, undefined := linker.UndefinedSymbols[symbol.Name]; undefined && linker.Symbols[symbol.Name].SymbolType != SYM_WEAK {
+			return true
+		}
+	}
+
+	return false
+}
+
+// --exclude-libs keeps the definitions of the listed archives, or of all of them, out of .dynsym
+func (linker *Linker) isExcludedLibrary(objFile *elf.ELF64) bool {
+	if objFile.Archive == "" {
+		return false
+	}
+
+	excluded := linker.LinkerInputs.ExcludeLibs
+	return helpers.Find[string](excluded, "ALL") != -1 || helpers.Find[string](excluded, objFile.Archive) != -1
+}
@@ -0,0 +1,91 @@
+package linker
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveMembers(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_archmain.o",
+		"../../data/libarchive.a",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// arch_b comes before arch_a in the archive but is only referenced by it
+	for _, name := range []string{"arch_a", "arch_b"} {
+		_, err := l.resolveSymbol(name)
+		assert.Truef(t, err == nil, "the member defining %s should be loaded", name)
+	}
+	_, found := l.Symbols["arch_unused"]
+	assert.Truef(t, !found, "the member defining arch_unused is not needed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 5, "wrong exit code: %v", err)
+
+	// the archive has to follow the references
+	_, err = Link(LinkerInputs{Filenames: []string{filenames[1], filenames[0]}, ExecutableName: filepath.Join(dir, "b.out")})
+	assert.ErrorIs(t, err, UndefinedSymbolErr)
+}
+
+func TestExcludeLibs(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_archmain.o", "../../data/libarchive.a"},
+		ExecutableName: filepath.Join(dir, "libarch.so"),
+		Shared:         true,
+	}
+
+	for _, test := range []struct {
+		excludeLibs []string
+		exported    bool
+	}{
+		{nil, true},
+		{[]string{"ALL"}, false},
+		{[]string{"libarchive.a"}, false},
+		{[]string{"libother.a"}, true},
+	} {
+		inputs.ExcludeLibs = test.excludeLibs
+		l, err := Link(inputs)
+		assert.Truef(t, err == nil, "link failed: %v", err)
+
+		for _, name := range []string{"arch_a", "arch_b"} {
+			assert.Truef(t, (l.dynamicSymbolIndex(name) != 0) == test.exported, "%s exported with %v", name, test.excludeLibs)
+		}
+		assert.Truef(t, l.dynamicSymbolIndex("_start") != 0, "the definitions of objects are exported")
+	}
+}
+
+func TestWeakDefinitions(t *testing.T) {
+	dir := t.TempDir()
+
+	// the weak value of the member comes after the strong one of the object and is dropped
+	for _, filenames := range [][]string{
+		{"../../data/sample_relocatable_weakmain.o", "../../data/libweak.a"},
+		{"../../data/libweak.a", "../../data/sample_relocatable_weakmain.o", "../../data/libweak.a"},
+	} {
+		l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+		assert.Truef(t, err == nil, "%v: link failed: %v", filenames, err)
+		router := l.Symbols["value"]
+		assert.Truef(t, router.DefinedSymbol.Elf.Filename == filenames[len(filenames)-2], "%v: the strong value should be kept", filenames)
+
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		err = cmd.Run()
+		assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 7, "%v: wrong exit code: %v", filenames, err)
+	}
+
+	_, err := Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_weakmain.o", "../../data/sample_relocatable_weakdup.o", "../../data/libweak.a"},
+		ExecutableName: filepath.Join(dir, "b.out"),
+	})
+	assert.ErrorIs(t, err, DuplicateSymbolErr)
+	assert.Truef(t, err != nil && strings.Contains(err.Error(), "sample_relocatable_weakmain.o and ../../data/sample_relocatable_weakdup.o"), "the error should name both files: %v", err)
+}
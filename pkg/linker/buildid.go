@@ -0,0 +1,130 @@
+package linker
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"os"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/elf"
+)
+
+const (
+	BUILD_ID_NONE = "none"
+	BUILD_ID_FAST = "fast"
+	BUILD_ID_MD5  = "md5"
+	BUILD_ID_SHA1 = "sha1"
+	BUILD_ID_UUID = "uuid"
+)
+
+var InvalidBuildIDErr = errors.New("Invalid --build-id style")
+
+// offset of the descriptor in the build ID note, after the header and the "GNU" name
+const buildIDDescOffset = 0x10
+
+// The hash of the output for fast, md5 and sha1, nil for the other styles
+func buildIDHash(style string) hash.Hash {
+	switch style {
+	case BUILD_ID_FAST:
+		return fnv.New64a()
+	case BUILD_ID_MD5:
+		return md5.New()
+	case BUILD_ID_SHA1:
+		return sha1.New()
+	}
+
+	return nil
+}
+
+// Returns the build ID that is known before the output is written, the random one of uuid or
+// the one given in hex, and a zero filled one of the size of the hash otherwise
+func buildIDValue(style string) ([]byte, error) {
+	if digest := buildIDHash(style); digest != nil {
+		return make([]byte, digest.Size()), nil
+	}
+
+	if style == BUILD_ID_UUID {
+		uuid := make([]byte, 16)
+		if _, err := rand.Read(uuid); err != nil {
+			return nil, err
+		}
+		// random UUID, version 4 and variant 1
+		uuid[6] = uuid[6]&0x0f | 0x40
+		uuid[8] = uuid[8]&0x3f | 0x80
+		return uuid, nil
+	}
+
+	if value, found := strings.CutPrefix(style, "0x"); found {
+		id, err := hex.DecodeString(value)
+		if err != nil || len(id) == 0 {
+			return nil, fmt.Errorf("%w: %s", InvalidBuildIDErr, style)
+		}
+		return id, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", InvalidBuildIDErr, style)
+}
+
+// Adds .note.gnu.build-id, that has its own PT_NOTE
+func (linker *Linker) createBuildID() error {
+	style := linker.LinkerInputs.BuildID
+	if style == "" || style == BUILD_ID_NONE {
+		return nil
+	}
+
+	id, err := buildIDValue(style)
+	if err != nil {
+		return err
+	}
+
+	linker.BuildID = linker.addSyntheticSection(".note.gnu.build-id", elf.SHT_NOTE, elf.SHF_ALLOC, 4, 0)
+	linker.BuildID.Data = elf.NoteBytes("GNU", elf.NT_GNU_BUILD_ID, id)
+	linker.BuildID.SectionEntry.ShSize = uint64(len(linker.BuildID.Data))
+
+	return nil
+}
+
+func (linker *Linker) buildIDSegment() []elf.ELF64Phdr {
+	if linker.BuildID == nil {
+		return nil
+	}
+
+	return []elf.ELF64Phdr{sectionSegment(elf.PT_NOTE, elf.PF_R, linker.BuildID)}
+}
+
+// The hash styles are computed over the written output while the descriptor is still zero, so
+// the same inputs always get the same build ID, and patched in place
+func (linker *Linker) fillBuildID() error {
+	if linker.BuildID == nil {
+		return nil
+	}
+
+	digest := buildIDHash(linker.LinkerInputs.BuildID)
+	if digest == nil {
+		return nil
+	}
+
+	output, err := os.ReadFile(linker.Executable.Filename)
+	if err != nil {
+		return err
+	}
+
+	digest.Write(output)
+	id := digest.Sum(nil)
+	copy(linker.BuildID.Data[buildIDDescOffset:], id)
+
+	file, err := os.OpenFile(linker.Executable.Filename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteAt(id, int64(linker.BuildID.SectionEntry.ShOff+buildIDDescOffset))
+	return err
+}
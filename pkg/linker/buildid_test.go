@@ -0,0 +1,69 @@
+package linker
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildID(t *testing.T, l *Linker) []byte {
+	output, err := os.ReadFile(l.Executable.Filename)
+	assert.Truef(t, err == nil, "reading the output failed: %v", err)
+
+	entry := l.BuildID.SectionEntry
+	notes, err := elf.ParseNotes(output[entry.ShOff:entry.ShOff+entry.ShSize], entry.ShAddrAlign)
+	assert.Truef(t, err == nil && len(notes) == 1, "parsing the note failed: %v", err)
+	assert.Truef(t, notes[0].Name == "GNU" && notes[0].Type == elf.NT_GNU_BUILD_ID, "wrong note got=%v", notes[0])
+
+	for _, phdr := range l.Executable.PhdrEntries {
+		if phdr.Type == elf.PT_NOTE && phdr.Offset == entry.ShOff {
+			assert.Truef(t, phdr.FileSz == entry.ShSize, "the PT_NOTE should only cover the build ID")
+			return notes[0].Desc
+		}
+	}
+	assert.Truef(t, false, "the build ID should have its own PT_NOTE")
+
+	return notes[0].Desc
+}
+
+func TestBuildID(t *testing.T) {
+	objects := []string{
+		"../../data/sample_relocatable_symbols.o",
+		"../../data/sample_relocatable_symbols_defs.o",
+	}
+	link := func(style string) *Linker {
+		l, err := Link(LinkerInputs{Filenames: objects, ExecutableName: filepath.Join(t.TempDir(), "a.out"), BuildID: style})
+		assert.Truef(t, err == nil, "%s: link failed: %v", style, err)
+		return l
+	}
+
+	for style, size := range map[string]int{BUILD_ID_FAST: 8, BUILD_ID_MD5: 16, BUILD_ID_SHA1: 20, BUILD_ID_UUID: 16} {
+		id := buildID(t, link(style))
+		assert.Truef(t, len(id) == size, "%s: wrong build ID size got=%d", style, len(id))
+		assert.Truef(t, !bytes.Equal(id, make([]byte, size)), "%s: the build ID was not filled", style)
+	}
+
+	// the hash is the one of the output with a zero build ID, so it does not depend on the run
+	l := link(BUILD_ID_SHA1)
+	id := buildID(t, l)
+	assert.Truef(t, bytes.Equal(id, buildID(t, link(BUILD_ID_SHA1))), "the sha1 build ID should be deterministic")
+	output, _ := os.ReadFile(l.Executable.Filename)
+	offset := l.BuildID.SectionEntry.ShOff + buildIDDescOffset
+	copy(output[offset:], make([]byte, len(id)))
+	sum := sha1.Sum(output)
+	assert.Truef(t, bytes.Equal(id, sum[:]), "the build ID should be the sha1 of the output")
+
+	id = buildID(t, link("0xdeadbeef01"))
+	assert.Truef(t, bytes.Equal(id, []byte{0xde, 0xad, 0xbe, 0xef, 0x01}), "wrong explicit build ID got=%x", id)
+
+	assert.Truef(t, link(BUILD_ID_NONE).BuildID == nil, "--build-id=none should not emit a note")
+
+	_, err := Link(LinkerInputs{Filenames: objects, ExecutableName: filepath.Join(t.TempDir(), "a.out"), BuildID: "0xzz"})
+	assert.Truef(t, errors.Is(err, InvalidBuildIDErr), "wrong error got=%v", err)
+}
@@ -0,0 +1,51 @@
+package linker
+
+import (
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+// Inline functions and template instantiations are emitted in a COMDAT group by every object
+// that uses them. Only the first group of each signature is linked in, the sections of the
+// later copies are discarded with their relocations, and the global symbols they define become
+// references, so they are bound to the kept copy.
+func (linker *Linker) discardDuplicateGroups(objFile *elf.ELF64) error {
+	groups, err := objFile.Groups()
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if group.Flags&elf.GRP_COMDAT == 0 {
+			continue
+		}
+
+		if kept, found := linker.comdatGroups[group.Signature]; found {
+			log.Debugf("Discarding group %s of %s, kept in %s", group.Signature, objFile.Filename, kept.Filename)
+			for _, section := range group.Sections {
+				linker.discardedSections[section] = struct{}{}
+			}
+			continue
+		}
+
+		linker.comdatGroups[group.Signature] = objFile
+	}
+
+	for _, symbol := range objFile.Symbols {
+		index := symbol.BaseSymbol.StShNdx
+		if symbol.IsLocal() || index == elf.SHN_UNDEF || symbol.BaseSymbol.IsSpecialSection() ||
+			int(index) >= len(objFile.Sections) || !linker.isDiscarded(objFile.Sections[index]) {
+			continue
+		}
+
+		symbol.BaseSymbol.StShNdx = elf.SHN_UNDEF
+		symbol.BaseSymbol.StValue = 0
+	}
+
+	return nil
+}
+
+func (linker *Linker) isDiscarded(section *elf.Section) bool {
+	_, found := linker.discardedSections[section]
+	return found
+}
@@ -0,0 +1,53 @@
+package linker
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComdatGroups(t *testing.T) {
+	objects := []string{
+		"../../data/sample_relocatable_comdat_a.o",
+		"../../data/sample_relocatable_comdat_b.o",
+	}
+	discarded := func(l *Linker, objFile *elf.ELF64) []string {
+		names := []string{}
+		for _, section := range objFile.Sections {
+			if l.isDiscarded(section) {
+				names = append(names, section.Name)
+			}
+		}
+		return names
+	}
+
+	// either object can come first, the other one uses its copies
+	for _, order := range [][]string{objects, {objects[1], objects[0]}} {
+		dir := t.TempDir()
+		l, err := Link(LinkerInputs{Filenames: order, ExecutableName: filepath.Join(dir, "a.out")})
+		assert.Truef(t, err == nil, "%v: link failed: %v", order, err)
+
+		first, second := l.InputObjects[0], l.InputObjects[1]
+		assert.Truef(t, len(discarded(l, first)) == 0, "%v: the first groups should be kept", order)
+		assert.Truef(t, len(discarded(l, second)) == 4, "%v: the groups found in both objects should be discarded with their relocations got=%v", order, discarded(l, second))
+		for _, name := range []string{"_Z7counterv", "_ZZ7countervE5value", "_Z5twiceIiET_S0_"} {
+			router := l.Symbols[name]
+			assert.Truef(t, router.DefinedSymbol != nil && router.DefinedSymbol.Elf == first, "%v: %s should be defined by the kept group", order, name)
+		}
+
+		// the static variable of counter is shared
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		err = cmd.Run()
+		assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 21, "%v: wrong exit code: %v", order, err)
+	}
+
+	objFile, err := elf.NewELF(objects[1])
+	assert.Truef(t, err == nil, "parsing failed: %v", err)
+	groups, err := objFile.Groups()
+	assert.Truef(t, err == nil && len(groups) == 3, "wrong groups got=%v err=%v", groups, err)
+	assert.Truef(t, groups[1].Signature == "_Z7counterv" && groups[1].Flags == elf.GRP_COMDAT, "wrong group got=%v", groups[1])
+	assert.Truef(t, len(groups[1].Sections) == 2 && groups[1].Sections[0].Name == ".text._Z7counterv", "wrong members")
+}
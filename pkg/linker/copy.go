@@ -0,0 +1,75 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andreistan26/golink/pkg/elf"
+)
+
+var CopyRelocationErr = errors.New("Can not copy the symbol of a shared library")
+
+// Position dependent code of an executable accesses the data objects of shared libraries as if
+// they were linked in. The objects are copied into the executable instead, R_X86_64_COPY tells
+// the dynamic loader to initialize the copy with the data of the library. The executable exports
+// the copy and its aliases, the references of the libraries are then bound to it too.
+func (linker *Linker) addCopyRelocation(name string) error {
+	shared := linker.Symbols[name].SharedSymbol
+	library := shared.Library.Elf
+	symbol := shared.Symbol.BaseSymbol
+
+	if symbol.StSize == 0 || int(symbol.StShNdx) >= len(library.Sections) {
+		return fmt.Errorf("%w: %s has no size", CopyRelocationErr, name)
+	}
+
+	// the alignment of the object is the one of its address in the library
+	librarySection := library.Sections[symbol.StShNdx].SectionEntry
+	align := max(librarySection.ShAddrAlign, 1)
+	for symbol.StValue%align != 0 {
+		align /= 2
+	}
+
+	section := linker.copySection(!librarySection.IsWritable())
+	offset := alignUp(section.SectionEntry.ShSize, align)
+	section.SectionEntry.ShSize = offset + symbol.StSize
+	section.SectionEntry.ShAddrAlign = max(section.SectionEntry.ShAddrAlign, align)
+
+	for _, alias := range library.DynamicSymbols {
+		if alias.BaseSymbol.StShNdx != symbol.StShNdx || alias.BaseSymbol.StValue != symbol.StValue ||
+			shared.Library.exports[alias.Name] != alias {
+			continue
+		}
+
+		// a definition of the inputs takes precedence over the alias
+		if router, found := linker.Symbols[alias.Name]; found && router.DefinedSymbol != nil {
+			continue
+		}
+
+		copied := linker.defineSyntheticSymbol(alias.Name, section, offset, alias.BaseSymbol.GetType())
+		copied.BaseSymbol.StInfo = alias.BaseSymbol.StInfo
+		copied.BaseSymbol.StSize = alias.BaseSymbol.StSize
+		linker.addDynamicSymbol(alias.Name)
+	}
+
+	linker.addDynamicRelocation(&DynamicRelocation{
+		Section: section, Offset: offset, Type: elf.R_X86_64_COPY, SymbolName: name,
+	})
+
+	return nil
+}
+
+// Copies of read-only objects are kept apart from the writable ones, so that they can be
+// protected once they are initialized
+func (linker *Linker) copySection(readOnly bool) *elf.Section {
+	name := ".dynbss"
+	if readOnly {
+		name = ".bss.rel.ro"
+	}
+
+	section, found := linker.Executable.MappedSections[name]
+	if !found {
+		section = linker.addSyntheticSection(name, elf.SHT_NOBITS, elf.SHF_ALLOC|elf.SHF_WRITE, 8, 0)
+	}
+
+	return section
+}
@@ -0,0 +1,59 @@
+package linker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyRelocations(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_copymain.o",
+		"../../data/sample_shared_lib_data.so",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	copies := make(map[string]*DynamicRelocation)
+	for _, relocation := range l.DynamicRelocations {
+		if relocation.Type == elf.R_X86_64_COPY {
+			copies[relocation.SymbolName] = relocation
+		}
+	}
+	assert.Truef(t, len(copies) == 2, "lib_counter and lib_const should be copied got=%d", len(copies))
+	assert.Truef(t, copies["lib_counter"].Section.Name == ".dynbss", "lib_counter is writable")
+	assert.Truef(t, copies["lib_const"].Section.Name == ".bss.rel.ro", "lib_const is read-only")
+
+	// the copy is defined by the executable with the size of the object, the alias shares it
+	counter, err := l.resolveSymbol("lib_counter")
+	assert.Truef(t, err == nil, "lib_counter should be defined by the executable")
+	alias, err := l.resolveSymbol("lib_counter_alias")
+	assert.Truef(t, err == nil, "lib_counter_alias should be defined by the executable")
+	assert.Truef(t, l.GetSymbolVirtAddress(counter) == l.GetSymbolVirtAddress(alias), "the alias should resolve to the copy")
+	assert.Truef(t, counter.BaseSymbol.StSize == 4, "wrong size of the copy")
+	assert.Truef(t, l.dynamicSymbolIndex("lib_counter_alias") != 0, "the alias should be exported")
+
+	constant, _ := l.resolveSymbol("lib_const")
+	assert.Truef(t, l.GetSymbolVirtAddress(constant)%8 == 0, "the copy should keep the alignment of the object")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile("../../data/sample_shared_lib_data.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libdata.so"), library, 0755) == nil, "writing the library failed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+
+	// the library reads the counter incremented by the executable through the alias
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 5+10+9, "wrong exit code: %v", err)
+}
@@ -0,0 +1,1170 @@
+package linker
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Names of the builtin types of the Itanium C++ ABI mangling
+var builtinTypes = map[byte]string{
+	'v': "void", 'w': "wchar_t", 'b': "bool", 'c': "char", 'a': "signed char", 'h': "unsigned char",
+	's': "short", 't': "unsigned short", 'i': "int", 'j': "unsigned int", 'l': "long", 'm': "unsigned long",
+	'x': "long long", 'y': "unsigned long long", 'n': "__int128", 'o': "unsigned __int128",
+	'f': "float", 'd': "double", 'e': "long double", 'g': "__float128", 'z': "...",
+}
+
+// The builtin types that start with D
+var extendedBuiltinTypes = map[byte]string{
+	'd': "decimal64", 'e': "decimal128", 'f': "decimal32", 'h': "half", 'i': "char32_t", 's': "char16_t",
+	'u': "char8_t", 'a': "auto", 'c': "decltype(auto)", 'n': "decltype(nullptr)",
+}
+
+// Suffixes of the integer literals of template arguments, the other types are printed as a cast
+var literalSuffixes = map[string]string{
+	"int": "", "unsigned int": "u", "long": "l", "unsigned long": "ul", "long long": "ll", "unsigned long long": "ull",
+}
+
+// Abbreviations of the std components, expanded the way c++filt does
+var standardSubstitutions = map[byte]string{
+	'a': "std::allocator", 'b': "std::basic_string",
+	's': "std::basic_string<char, std::char_traits<char>, std::allocator<char> >",
+	'i': "std::basic_istream<char, std::char_traits<char> >",
+	'o': "std::basic_ostream<char, std::char_traits<char> >",
+	'd': "std::basic_iostream<char, std::char_traits<char> >",
+}
+
+// Operator names, the ones that are words are separated from "operator" by a space
+var operatorNames = map[string]string{
+	"nw": "new", "na": "new[]", "dl": "delete", "da": "delete[]", "aw": "co_await",
+	"ps": "+", "ng": "-", "ad": "&", "de": "*", "co": "~", "pl": "+", "mi": "-", "ml": "*", "dv": "/",
+	"rm": "%", "an": "&", "or": "|", "eo": "^", "aS": "=", "pL": "+=", "mI": "-=", "mL": "*=", "dV": "/=",
+	"rM": "%=", "aN": "&=", "oR": "|=", "eO": "^=", "ls": "<<", "rs": ">>", "lS": "<<=", "rS": ">>=",
+	"eq": "==", "ne": "!=", "lt": "<", "gt": ">", "le": "<=", "ge": ">=", "ss": "<=>", "nt": "!",
+	"aa": "&&", "oo": "||", "pp": "++", "mm": "--", "cm": ",", "pm": "->*", "pt": "->", "cl": "()",
+	"ix": "[]", "qu": "?",
+}
+
+// Demangles the C++ names that extern "C++" patterns of version scripts are matched against,
+// the way c++filt prints them. The functions, variables and special names of the Itanium C++
+// ABI are supported, with templates, operators and substitutions. Of the expressions of template
+// arguments only the template parameters, literals and names are, the other names fail.
+func demangle(name string) (string, bool) {
+	if !strings.HasPrefix(name, "_Z") {
+		return "", false
+	}
+
+	demangler := &demangler{data: name[2:]}
+	result, ok := demangler.encoding(false)
+	if !ok {
+		return "", false
+	}
+
+	// suffixes of the clones made by the compiler, like .cold or .isra.0
+	for demangler.peek() == '.' {
+		clone, ok := demangler.cloneSuffix()
+		if !ok {
+			return "", false
+		}
+		result += " [clone " + clone + "]"
+	}
+
+	if demangler.pos != len(demangler.data) {
+		return "", false
+	}
+
+	return result, true
+}
+
+// A demangled type. The pointers and references to function and array types are declarators
+// that go between the return or element type and the parameters or bounds.
+type cxxType struct {
+	// the whole type, or the return or element type
+	base string
+	// the pointers, references and pointers to member applied to a function or array type
+	declarator string
+	// the parameters of a function type, or the bounds of an array type, empty for the other types
+	suffix string
+	array  bool
+	// the types of an argument pack, printed one after the other
+	pack     bool
+	elements []*cxxType
+}
+
+func (t *cxxType) String() string {
+	switch {
+	case t.pack:
+		elements := []string{}
+		for _, element := range t.elements {
+			if element.String() != "" {
+				elements = append(elements, element.String())
+			}
+		}
+		return strings.Join(elements, ", ")
+	case t.suffix == "":
+		return t.base
+	case t.declarator == "":
+		return t.base + " " + t.suffix
+	case t.array:
+		return t.base + " (" + t.declarator + ") " + t.suffix
+	}
+
+	return t.base + " (" + t.declarator + ")" + t.suffix
+}
+
+// Applies a pointer, a reference or a qualifier to the type, or to each type of a pack
+func (t *cxxType) modify(modifier string) *cxxType {
+	if t.pack {
+		modified := &cxxType{pack: true}
+		for _, element := range t.elements {
+			modified.elements = append(modified.elements, element.modify(modifier))
+		}
+		return modified
+	}
+
+	modified := *t
+	outer := &modified.base
+	if t.suffix != "" {
+		outer = &modified.declarator
+	}
+
+	// a reference to a reference is a reference, an lvalue one unless both are rvalue references
+	if (modifier == "&" || modifier == "&&") && strings.HasSuffix(*outer, "&") {
+		if modifier == "&" && strings.HasSuffix(*outer, "&&") {
+			*outer = strings.TrimSuffix(*outer, "&")
+		}
+		return &modified
+	}
+
+	switch {
+	case t.suffix == "":
+		modified.base += modifier
+	case !t.array && t.declarator == "" && strings.HasPrefix(modifier, " "):
+		// the qualifiers of a member function type
+		modified.suffix += modifier
+	case t.array && t.declarator == "" && strings.HasPrefix(modifier, " "):
+		// and the ones of an array type qualify its elements
+		modified.base += modifier
+	default:
+		modified.declarator += modifier
+	}
+
+	return &modified
+}
+
+type demangler struct {
+	data string
+	pos  int
+	// components that later parts of the name refer to with S_ and S<n>_
+	substitutions []*cxxType
+	// the arguments of the last template of the name of the function, referred to with T_ and T<n>_
+	templateParams []*cxxType
+	// the nesting of types, the template arguments of the function are the ones of its name
+	typeDepth int
+}
+
+func (d *demangler) peek() byte {
+	return d.peekAt(0)
+}
+
+func (d *demangler) peekAt(offset int) byte {
+	if d.pos+offset >= len(d.data) {
+		return 0
+	}
+
+	return d.data[d.pos+offset]
+}
+
+func (d *demangler) consume(prefix string) bool {
+	if strings.HasPrefix(d.data[d.pos:], prefix) {
+		d.pos += len(prefix)
+		return true
+	}
+
+	return false
+}
+
+func (d *demangler) addSubstitution(name string) {
+	d.substitutions = append(d.substitutions, &cxxType{base: name})
+}
+
+// <number> ::= [n] <decimal digits>
+func (d *demangler) number() (int, bool) {
+	negative := d.consume("n")
+	start := d.pos
+	for d.peek() >= '0' && d.peek() <= '9' {
+		d.pos++
+	}
+
+	value, err := strconv.Atoi(d.data[start:d.pos])
+	if negative {
+		value = -value
+	}
+	return value, err == nil
+}
+
+// <seq-id> _, in base 36, the first one is the empty seq-id
+func (d *demangler) seqID() (int, bool) {
+	if d.consume("_") {
+		return 0, true
+	}
+
+	end := strings.IndexByte(d.data[d.pos:], '_')
+	if end == -1 {
+		return 0, false
+	}
+
+	value, err := strconv.ParseUint(d.data[d.pos:d.pos+end], 36, 32)
+	d.pos += end + 1
+	return int(value) + 1, err == nil
+}
+
+// <encoding> ::= <name> <bare-function-type> | <name> | <special-name>, the functions that
+// local names are nested in are printed without their return type
+func (d *demangler) encoding(local bool) (string, bool) {
+	if d.peek() == 'T' || d.peek() == 'G' {
+		return d.specialName()
+	}
+
+	name, ok := d.name()
+	if !ok {
+		return "", false
+	}
+
+	// variables have no parameter types
+	if d.pos == len(d.data) || d.peek() == 'E' || d.peek() == '.' {
+		return name.name, true
+	}
+
+	// the return type of the function templates comes first
+	returnType := ""
+	if name.template && !name.ctorDtorConv {
+		ret, ok := d.typeName()
+		if !ok {
+			return "", false
+		}
+		if !local {
+			returnType = ret.String() + " "
+		}
+	}
+
+	parameters, ok := d.parameters()
+	if !ok {
+		return "", false
+	}
+
+	return returnType + name.name + parameters + name.qualifiers, true
+}
+
+// The parameter types of a function, up to the end of the encoding
+func (d *demangler) parameters() (string, bool) {
+	parameters := []string{}
+	for d.pos < len(d.data) && d.peek() != 'E' && d.peek() != '.' {
+		parameter, ok := d.typeName()
+		if !ok {
+			return "", false
+		}
+		if parameter.String() != "" {
+			parameters = append(parameters, parameter.String())
+		}
+	}
+
+	if len(parameters) == 1 && parameters[0] == "void" {
+		parameters = nil
+	}
+
+	return "(" + strings.Join(parameters, ", ") + ")", true
+}
+
+// The names of vtables, typeinfo, thunks and guard variables
+func (d *demangler) specialName() (string, bool) {
+	for _, prefix := range []struct {
+		mangled, description string
+	}{
+		{"TV", "vtable for "}, {"TT", "VTT for "}, {"TI", "typeinfo for "}, {"TS", "typeinfo name for "},
+	} {
+		if d.consume(prefix.mangled) {
+			t, ok := d.typeName()
+			if !ok {
+				return "", false
+			}
+			return prefix.description + t.String(), true
+		}
+	}
+
+	for _, prefix := range []struct {
+		mangled, description string
+		offsets              int
+	}{
+		{"Th", "non-virtual thunk to ", 1}, {"Tv", "virtual thunk to ", 1}, {"Tc", "covariant return thunk to ", 2},
+		{"GTt", "transaction clone for ", 0}, {"GTn", "non-transaction clone for ", 0},
+	} {
+		if !d.consume(prefix.mangled) {
+			continue
+		}
+		for idx := 0; idx < prefix.offsets; idx++ {
+			if !d.callOffset(prefix.mangled == "Tc") {
+				return "", false
+			}
+		}
+		encoding, ok := d.encoding(false)
+		return prefix.description + encoding, ok
+	}
+
+	for _, prefix := range []struct {
+		mangled, description string
+	}{
+		{"GV", "guard variable for "}, {"TW", "TLS wrapper function for "}, {"TH", "TLS init function for "},
+	} {
+		if d.consume(prefix.mangled) {
+			name, ok := d.name()
+			if !ok {
+				return "", false
+			}
+			return prefix.description + name.name, true
+		}
+	}
+
+	switch {
+	case d.consume("GR"):
+		name, ok := d.name()
+		if !ok {
+			return "", false
+		}
+		index, ok := d.seqID()
+		return "reference temporary #" + strconv.Itoa(index) + " for " + name.name, ok
+	case d.consume("TC"):
+		derived, ok := d.typeName()
+		if !ok {
+			return "", false
+		}
+		if _, ok := d.number(); !ok || !d.consume("_") {
+			return "", false
+		}
+		base, ok := d.typeName()
+		if !ok {
+			return "", false
+		}
+		return "construction vtable for " + base.String() + "-in-" + derived.String(), true
+	}
+
+	return "", false
+}
+
+// <call-offset> ::= h <number> _ | v <number> _ <number> _, Th and Tv omit the h and the v
+func (d *demangler) callOffset(prefixed bool) bool {
+	virtual := d.peekAt(-1) == 'v'
+	if prefixed {
+		switch {
+		case d.consume("h"):
+			virtual = false
+		case d.consume("v"):
+			virtual = true
+		default:
+			return false
+		}
+	}
+
+	count := 1
+	if virtual {
+		count = 2
+	}
+	for idx := 0; idx < count; idx++ {
+		if _, ok := d.number(); !ok || !d.consume("_") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// .cold, .isra.0, .constprop.1 and the like
+func (d *demangler) cloneSuffix() (string, bool) {
+	start := d.pos
+	d.pos++
+	for c := d.peek(); c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'; c = d.peek() {
+		d.pos++
+	}
+	for d.peek() == '.' && d.peekAt(1) >= '0' && d.peekAt(1) <= '9' {
+		d.pos++
+		for d.peek() >= '0' && d.peek() <= '9' {
+			d.pos++
+		}
+	}
+
+	return d.data[start:d.pos], d.pos > start+1
+}
+
+type cxxName struct {
+	name string
+	// the cv and ref qualifiers of a member function
+	qualifiers string
+	// the name ends with template arguments
+	template bool
+	// constructors, destructors and conversion operators have no return type
+	ctorDtorConv bool
+}
+
+// <name> ::= <nested-name> | <unscoped-name> | <unscoped-template-name> <template-args> | <local-name>
+func (d *demangler) name() (*cxxName, bool) {
+	switch d.peek() {
+	case 'N':
+		return d.nestedName()
+	case 'Z':
+		return d.localName()
+	}
+
+	name := &cxxName{}
+	var ok bool
+	if d.peek() == 'S' && d.peekAt(1) != 't' {
+		var substitution *cxxType
+		if substitution, ok = d.substitution(); !ok || d.peek() != 'I' {
+			return nil, false
+		}
+		name.name = substitution.String()
+	} else {
+		if name.name, ok = d.unscopedName(name); !ok {
+			return nil, false
+		}
+		if d.peek() == 'I' {
+			d.addSubstitution(name.name)
+		}
+	}
+
+	if d.peek() == 'I' {
+		args, ok := d.templateArgs()
+		if !ok {
+			return nil, false
+		}
+		name.name = appendTemplateArgs(name.name, args)
+		name.template = true
+	}
+
+	return name, true
+}
+
+// <unscoped-name> ::= <unqualified-name> | St <unqualified-name>
+func (d *demangler) unscopedName(name *cxxName) (string, bool) {
+	prefix := ""
+	if d.consume("St") {
+		prefix = "std::"
+	}
+
+	unqualified, ok := d.unqualifiedName(nil, name)
+	return prefix + unqualified, ok
+}
+
+// <nested-name> ::= N [<CV-qualifiers>] [<ref-qualifier>] <prefix> <unqualified-name> E
+//
+//	| N [<CV-qualifiers>] [<ref-qualifier>] <template-prefix> <template-args> E
+func (d *demangler) nestedName() (*cxxName, bool) {
+	d.pos++
+	name := &cxxName{qualifiers: d.cvQualifiers()}
+	switch {
+	case d.consume("R"):
+		name.qualifiers += " &"
+	case d.consume("O"):
+		name.qualifiers += " &&"
+	}
+
+	components := []string{}
+	for !d.consume("E") {
+		if d.pos >= len(d.data) {
+			return nil, false
+		}
+
+		substituted := false
+		name.template = false
+		switch c := d.peek(); {
+		case c == 'S' && d.peekAt(1) != 't':
+			substitution, ok := d.substitution()
+			if !ok {
+				return nil, false
+			}
+			components = append(components, substitution.String())
+			substituted = true
+		case c == 'T':
+			param, ok := d.templateParam()
+			if !ok {
+				return nil, false
+			}
+			components = append(components, param.String())
+		case c == 'I':
+			if len(components) == 0 {
+				return nil, false
+			}
+			args, ok := d.templateArgs()
+			if !ok {
+				return nil, false
+			}
+			components[len(components)-1] = appendTemplateArgs(components[len(components)-1], args)
+			name.template = true
+		case c == 'M':
+			// the closure type of a lambda in a default member initializer
+			d.pos++
+			continue
+		default:
+			if c == 'S' {
+				d.pos += 2
+				components = append(components, "std")
+			}
+			unqualified, ok := d.unqualifiedName(components, name)
+			if !ok {
+				return nil, false
+			}
+			if c == 'S' {
+				components[len(components)-1] += "::" + unqualified
+			} else {
+				components = append(components, unqualified)
+			}
+		}
+
+		// every new prefix can be substituted, except the full name
+		if !substituted && d.peek() != 'E' {
+			d.addSubstitution(strings.Join(components, "::"))
+		}
+	}
+
+	name.name = strings.Join(components, "::")
+	return name, len(components) != 0
+}
+
+// <local-name> ::= Z <function encoding> E <entity name> [<discriminator>]
+//
+//	| Z <function encoding> E s [<discriminator>]
+func (d *demangler) localName() (*cxxName, bool) {
+	// the template parameters of the function are the ones its types refer to, even when the
+	// local name is itself a type
+	d.pos++
+	typeDepth, templateParams := d.typeDepth, d.templateParams
+	d.typeDepth = 0
+	function, ok := d.encoding(true)
+	if d.typeDepth = typeDepth; typeDepth != 0 {
+		d.templateParams = templateParams
+	}
+	if !ok || !d.consume("E") {
+		return nil, false
+	}
+
+	if d.consume("s") {
+		return &cxxName{name: function + "::string literal"}, d.discriminator()
+	}
+
+	if d.consume("d") {
+		// a default argument, its number is not printed
+		if d.peek() != '_' {
+			if _, ok := d.number(); !ok {
+				return nil, false
+			}
+		}
+		if !d.consume("_") {
+			return nil, false
+		}
+	}
+
+	entity, ok := d.name()
+	if !ok {
+		return nil, false
+	}
+	entity.name = function + "::" + entity.name
+
+	return entity, d.discriminator()
+}
+
+// <discriminator> ::= _ <digit> | __ <number> _, it is not printed
+func (d *demangler) discriminator() bool {
+	switch {
+	case d.consume("__"):
+		_, ok := d.number()
+		return ok && d.consume("_")
+	case d.consume("_"):
+		_, ok := d.number()
+		return ok
+	}
+
+	return true
+}
+
+// <unqualified-name> ::= <operator-name> | <ctor-dtor-name> | <source-name> | <unnamed-type-name>
+// followed by the ABI tags
+func (d *demangler) unqualifiedName(previous []string, name *cxxName) (string, bool) {
+	var result string
+	var ok bool
+	c := d.peek()
+	switch {
+	case c >= '0' && c <= '9':
+		result, ok = d.sourceName()
+	case c == 'L':
+		// internal linkage
+		d.pos++
+		result, ok = d.sourceName()
+	case c == 'C' || c == 'D' && d.peekAt(1) >= '0' && d.peekAt(1) <= '9':
+		if len(previous) == 0 {
+			return "", false
+		}
+		name.ctorDtorConv = true
+		result, ok = d.ctorDtorName(previous[len(previous)-1])
+	case c == 'U':
+		result, ok = d.unnamedTypeName()
+	case c == 'D' && d.peekAt(1) == 'C':
+		// structured bindings
+		d.pos += 2
+		bindings := []string{}
+		for !d.consume("E") {
+			binding, ok := d.sourceName()
+			if !ok {
+				return "", false
+			}
+			bindings = append(bindings, binding)
+		}
+		result, ok = "["+strings.Join(bindings, ", ")+"]", len(bindings) != 0
+	case c >= 'a' && c <= 'z':
+		result, ok = d.operatorName(name)
+	}
+
+	for ok && d.peek() == 'B' {
+		d.pos++
+		var tag string
+		tag, ok = d.sourceName()
+		result += "[abi:" + tag + "]"
+	}
+
+	return result, ok
+}
+
+// <source-name> ::= <positive length number> <identifier>
+func (d *demangler) sourceName() (string, bool) {
+	start := d.pos
+	for d.peek() >= '0' && d.peek() <= '9' {
+		d.pos++
+	}
+
+	length, err := strconv.Atoi(d.data[start:d.pos])
+	if err != nil || d.pos+length > len(d.data) {
+		return "", false
+	}
+
+	name := d.data[d.pos : d.pos+length]
+	d.pos += length
+	if strings.HasPrefix(name, "_GLOBAL__N") {
+		return "(anonymous namespace)", true
+	}
+	return name, true
+}
+
+// Constructors and destructors are named after their class, without its template arguments
+func (d *demangler) ctorDtorName(class string) (string, bool) {
+	prefix := ""
+	if d.peek() == 'D' {
+		prefix = "~"
+	}
+	d.pos++
+
+	// the constructors inherited from a base class are mangled with its type
+	inherited := d.consume("I")
+	if d.peek() < '0' || d.peek() > '9' {
+		return "", false
+	}
+	d.pos++
+	if inherited {
+		if _, ok := d.typeName(); !ok {
+			return "", false
+		}
+	}
+
+	return prefix + unqualifiedClassName(class), true
+}
+
+func unqualifiedClassName(class string) string {
+	// the template arguments may have qualified names too
+	if strings.HasSuffix(class, ">") {
+		depth := 0
+		for idx := len(class) - 1; idx >= 0; idx-- {
+			if class[idx] == '>' {
+				depth++
+			} else if class[idx] == '<' {
+				depth--
+				if depth == 0 {
+					class = strings.TrimSuffix(class[:idx], " ")
+					break
+				}
+			}
+		}
+	}
+
+	// and the abi tags are not part of the name of the constructors
+	for strings.HasSuffix(class, "]") {
+		idx := strings.LastIndex(class, "[abi:")
+		if idx == -1 {
+			break
+		}
+		class = class[:idx]
+	}
+
+	if idx := strings.LastIndex(class, "::"); idx != -1 {
+		return class[idx+2:]
+	}
+	return class
+}
+
+// <unnamed-type-name> ::= Ut [<number>] _ | Ul <lambda-sig> E [<number>] _
+func (d *demangler) unnamedTypeName() (string, bool) {
+	var result string
+	switch {
+	case d.consume("Ut"):
+		result = "{unnamed type#"
+	case d.consume("Ul"):
+		parameters, ok := d.parameters()
+		if !ok || !d.consume("E") {
+			return "", false
+		}
+		result = "{lambda" + parameters + "#"
+	default:
+		return "", false
+	}
+
+	index := 1
+	if d.peek() != '_' {
+		number, ok := d.number()
+		if !ok {
+			return "", false
+		}
+		index = number + 2
+	}
+	if !d.consume("_") {
+		return "", false
+	}
+
+	return result + strconv.Itoa(index) + "}", true
+}
+
+// <operator-name>, including the conversion operators cv <type> and the literal operators li <source-name>
+func (d *demangler) operatorName(name *cxxName) (string, bool) {
+	switch {
+	case d.consume("cv"):
+		name.ctorDtorConv = true
+		t, ok := d.typeName()
+		if !ok {
+			return "", false
+		}
+		return "operator " + t.String(), true
+	case d.consume("li"):
+		suffix, ok := d.sourceName()
+		return "operator\"\" " + suffix, ok
+	case d.peek() == 'v' && d.peekAt(1) >= '0' && d.peekAt(1) <= '9':
+		d.pos += 2
+		vendor, ok := d.sourceName()
+		return "operator " + vendor, ok
+	}
+
+	if d.pos+2 > len(d.data) {
+		return "", false
+	}
+	operator, found := operatorNames[d.data[d.pos:d.pos+2]]
+	if !found {
+		return "", false
+	}
+	d.pos += 2
+
+	if operator[0] >= 'a' && operator[0] <= 'z' {
+		return "operator " + operator, true
+	}
+	return "operator" + operator, true
+}
+
+// <substitution> ::= S_ | S <seq-id> _ | Sa | Sb | Ss | Si | So | Sd
+func (d *demangler) substitution() (*cxxType, bool) {
+	if !d.consume("S") {
+		return nil, false
+	}
+
+	if name, found := standardSubstitutions[d.peek()]; found {
+		d.pos++
+		return &cxxType{base: name}, true
+	}
+
+	index, ok := d.seqID()
+	if !ok || index >= len(d.substitutions) {
+		return nil, false
+	}
+
+	return d.substitutions[index], true
+}
+
+// <template-param> ::= T_ | T <number> _
+func (d *demangler) templateParam() (*cxxType, bool) {
+	if !d.consume("T") {
+		return nil, false
+	}
+
+	index, ok := 0, true
+	if d.peek() != '_' {
+		index, ok = d.number()
+		index++
+	}
+	if !ok || !d.consume("_") || index >= len(d.templateParams) {
+		return nil, false
+	}
+
+	return d.templateParams[index], true
+}
+
+// <template-args> ::= I <template-arg>+ E, the arguments of the function name are the ones
+// that its template parameters refer to
+func (d *demangler) templateArgs() ([]*cxxType, bool) {
+	if !d.consume("I") {
+		return nil, false
+	}
+
+	args := []*cxxType{}
+	for !d.consume("E") {
+		arg, ok := d.templateArg()
+		if !ok {
+			return nil, false
+		}
+		args = append(args, arg)
+	}
+
+	if d.typeDepth == 0 {
+		d.templateParams = args
+	}
+
+	return args, true
+}
+
+// <template-arg> ::= <type> | <expr-primary> | J <template-arg>* E | X <expression> E
+func (d *demangler) templateArg() (*cxxType, bool) {
+	switch d.peek() {
+	case 'L':
+		return d.literal()
+	case 'J', 'I':
+		// an argument pack, older compilers mangle it with I
+		d.pos++
+		pack := &cxxType{pack: true}
+		for !d.consume("E") {
+			arg, ok := d.templateArg()
+			if !ok {
+				return nil, false
+			}
+			pack.elements = append(pack.elements, arg)
+		}
+		return pack, true
+	}
+
+	d.typeDepth++
+	defer func() { d.typeDepth-- }()
+	if d.consume("X") {
+		expression, ok := d.expression()
+		return expression, ok && d.consume("E")
+	}
+	return d.typeName()
+}
+
+// <expression> ::= <template-param> | <expr-primary> | sr <type> <simple-id> | <simple-id>,
+// the other expressions are not supported
+func (d *demangler) expression() (*cxxType, bool) {
+	switch c := d.peek(); {
+	case c == 'T':
+		return d.templateParam()
+	case c == 'L':
+		return d.literal()
+	case c >= '0' && c <= '9':
+		return d.simpleID()
+	case d.consume("sr"):
+		scope, ok := d.typeName()
+		if !ok {
+			return nil, false
+		}
+		id, ok := d.simpleID()
+		if !ok {
+			return nil, false
+		}
+		return &cxxType{base: scope.String() + "::" + id.String()}, true
+	}
+
+	return nil, false
+}
+
+// <simple-id> ::= <source-name> [<template-args>], it is not a candidate
+func (d *demangler) simpleID() (*cxxType, bool) {
+	name, ok := d.sourceName()
+	if !ok {
+		return nil, false
+	}
+	if d.peek() != 'I' {
+		return &cxxType{base: name}, true
+	}
+
+	args, ok := d.templateArgs()
+	if !ok {
+		return nil, false
+	}
+	return &cxxType{base: appendTemplateArgs(name, args)}, true
+}
+
+// <expr-primary> ::= L <type> <value> E | L <mangled-name> E
+func (d *demangler) literal() (*cxxType, bool) {
+	d.pos++
+	if d.consume("_Z") {
+		d.typeDepth++
+		encoding, ok := d.encoding(false)
+		d.typeDepth--
+		return &cxxType{base: encoding}, ok && d.consume("E")
+	}
+
+	d.typeDepth++
+	t, ok := d.typeName()
+	d.typeDepth--
+	if !ok {
+		return nil, false
+	}
+
+	end := strings.IndexByte(d.data[d.pos:], 'E')
+	if end == -1 {
+		return nil, false
+	}
+	value := d.data[d.pos : d.pos+end]
+	d.pos += end + 1
+	if strings.HasPrefix(value, "n") {
+		value = "-" + value[1:]
+	}
+
+	typeName := t.String()
+	switch {
+	case typeName == "bool" && value == "0":
+		return &cxxType{base: "false"}, true
+	case typeName == "bool" && value == "1":
+		return &cxxType{base: "true"}, true
+	case typeName == "decltype(nullptr)" && value == "":
+		return &cxxType{base: "nullptr"}, true
+	}
+
+	if suffix, found := literalSuffixes[typeName]; found {
+		return &cxxType{base: value + suffix}, true
+	}
+	return &cxxType{base: "(" + typeName + ")" + value}, true
+}
+
+func appendTemplateArgs(name string, args []*cxxType) string {
+	rendered := []string{}
+	for _, arg := range args {
+		if arg.String() != "" {
+			rendered = append(rendered, arg.String())
+		}
+	}
+
+	// << and >> are not tokens of the name
+	if strings.HasSuffix(name, "<") {
+		name += " "
+	}
+	result := name + "<" + strings.Join(rendered, ", ")
+	if strings.HasSuffix(result, ">") {
+		result += " "
+	}
+
+	return result + ">"
+}
+
+// <CV-qualifiers> ::= [r] [V] [K], printed after the type they qualify
+func (d *demangler) cvQualifiers() string {
+	restrict, volatile, constant := d.consume("r"), d.consume("V"), d.consume("K")
+
+	qualifiers := ""
+	if constant {
+		qualifiers += " const"
+	}
+	if volatile {
+		qualifiers += " volatile"
+	}
+	if restrict {
+		qualifiers += " restrict"
+	}
+
+	return qualifiers
+}
+
+// <type>, the types that are not builtin types or substitutions are substitution candidates
+func (d *demangler) typeName() (*cxxType, bool) {
+	c := d.peek()
+	if name, found := builtinTypes[c]; found {
+		d.pos++
+		return &cxxType{base: name}, true
+	}
+	if name, found := extendedBuiltinTypes[d.peekAt(1)]; c == 'D' && found {
+		d.pos += 2
+		return &cxxType{base: name}, true
+	}
+
+	var result *cxxType
+	var ok bool
+	switch c {
+	case 'r', 'V', 'K':
+		// the qualifiers of a member function type apply to this, the unqualified function
+		// type is not a candidate
+		qualifiers := d.cvQualifiers()
+		if d.peek() == 'F' {
+			result, ok = d.functionType()
+		} else {
+			result, ok = d.typeName()
+		}
+		if ok {
+			result = result.modify(qualifiers)
+		}
+	case 'P', 'R', 'O':
+		d.pos++
+		if result, ok = d.typeName(); ok {
+			result = result.modify(map[byte]string{'P': "*", 'R': "&", 'O': "&&"}[c])
+		}
+	case 'F':
+		result, ok = d.functionType()
+	case 'A':
+		result, ok = d.arrayType()
+	case 'M':
+		d.pos++
+		var class, member *cxxType
+		if class, ok = d.typeName(); ok {
+			if member, ok = d.typeName(); ok {
+				if member.suffix != "" {
+					result = member.modify(class.String() + "::*")
+				} else {
+					result = member.modify(" " + class.String() + "::*")
+				}
+			}
+		}
+	case 'T':
+		// a template template parameter and its arguments are both candidates
+		if result, ok = d.templateParam(); ok && d.peek() == 'I' {
+			d.substitutions = append(d.substitutions, result)
+			var args []*cxxType
+			if args, ok = d.templateArgs(); ok {
+				result = &cxxType{base: appendTemplateArgs(result.String(), args)}
+			}
+		}
+	case 'S':
+		if d.peekAt(1) != 't' {
+			if result, ok = d.substitution(); !ok || d.peek() != 'I' {
+				return result, ok
+			}
+			var args []*cxxType
+			if args, ok = d.templateArgs(); ok {
+				result = &cxxType{base: appendTemplateArgs(result.String(), args)}
+			}
+			break
+		}
+		fallthrough
+	case 'N', 'Z', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		d.typeDepth++
+		var name *cxxName
+		name, ok = d.name()
+		d.typeDepth--
+		if ok {
+			result = &cxxType{base: name.name}
+		}
+	case 'D':
+		d.pos++
+		switch {
+		case d.consume("p"):
+			// a pack expansion, the pack is printed inline
+			result, ok = d.typeName()
+		case d.consume("v"):
+			var count int
+			if count, ok = d.number(); ok && d.consume("_") {
+				if result, ok = d.typeName(); ok {
+					result = &cxxType{base: result.String() + " __vector(" + strconv.Itoa(count) + ")"}
+				}
+			}
+		case d.consume("F"):
+			var bits int
+			if bits, ok = d.number(); ok && d.consume("_") {
+				return &cxxType{base: "_Float" + strconv.Itoa(bits)}, true
+			}
+		case d.peek() == 'x' || d.peek() == 'o' || d.peek() == 'O' || d.peek() == 'w':
+			// exception specifications of function types are not printed
+			return nil, false
+		}
+	case 'u':
+		d.pos++
+		var name string
+		if name, ok = d.sourceName(); ok {
+			result = &cxxType{base: name}
+		}
+	}
+
+	if !ok || result == nil {
+		return nil, false
+	}
+
+	d.substitutions = append(d.substitutions, result)
+	return result, true
+}
+
+// <function-type> ::= F [Y] <bare-function-type> [<ref-qualifier>] E
+func (d *demangler) functionType() (*cxxType, bool) {
+	d.pos++
+	d.consume("Y")
+
+	returnType, ok := d.typeName()
+	if !ok {
+		return nil, false
+	}
+
+	parameters := []string{}
+	qualifier := ""
+	for !d.consume("E") {
+		if d.consume("RE") {
+			qualifier = " &"
+			break
+		}
+		if d.consume("OE") {
+			qualifier = " &&"
+			break
+		}
+
+		parameter, ok := d.typeName()
+		if !ok {
+			return nil, false
+		}
+		if parameter.String() != "" {
+			parameters = append(parameters, parameter.String())
+		}
+	}
+
+	if len(parameters) == 1 && parameters[0] == "void" {
+		parameters = nil
+	}
+
+	return &cxxType{base: returnType.String(), suffix: "(" + strings.Join(parameters, ", ") + ")" + qualifier}, true
+}
+
+// <array-type> ::= A <number> _ <type> | A <template-param> _ <type> | A _ <type>
+func (d *demangler) arrayType() (*cxxType, bool) {
+	d.pos++
+	bound := ""
+	if d.peek() == 'T' {
+		// the bound of an array in a template is its parameter
+		param, ok := d.templateParam()
+		if !ok {
+			return nil, false
+		}
+		bound = param.String()
+	} else if d.peek() != '_' {
+		count, ok := d.number()
+		if !ok {
+			return nil, false
+		}
+		bound = strconv.Itoa(count)
+	}
+	if !d.consume("_") {
+		return nil, false
+	}
+
+	element, ok := d.typeName()
+	if !ok {
+		return nil, false
+	}
+
+	// the bounds of multidimensional arrays follow each other
+	if element.array && element.declarator == "" {
+		return &cxxType{base: element.base, suffix: "[" + bound + "]" + element.suffix, array: true}, true
+	}
+	return &cxxType{base: element.String(), suffix: "[" + bound + "]", array: true}, true
+}
@@ -0,0 +1,705 @@
+package linker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/helpers"
+)
+
+const DefaultDynamicLinker = "/lib64/ld-linux-x86-64.so.2"
+
+var (
+	ImportedSymbolRelocationErr = errors.New("Unsupported relocation against a symbol of a shared library.")
+	TextRelocationErr           = errors.New("Relocation requires a text relocation")
+)
+
+// The sections read by the dynamic loader, they are sized once the relocations are scanned
+// and filled once the layout is done
+type DynamicSections struct {
+	Interp  *elf.Section
+	DynSym  *elf.Section
+	DynStr  *elf.Section
+	Hash    *elf.Section // nil with --hash-style=gnu
+	GNUHash *elf.Section // nil with --hash-style=sysv
+	Section *elf.Section
+	Entries []elf.DynamicEntry
+	// nil if no imported symbol is versioned
+	Versions *SymbolVersions
+	// nil unless relative relocations are packed
+	Relr *RelrTable
+
+	strings map[string]uint32
+}
+
+func (dynamic *DynamicSections) addString(str string) uint32 {
+	if offset, found := dynamic.strings[str]; found {
+		return offset
+	}
+
+	offset := uint32(len(dynamic.DynStr.Data))
+	dynamic.DynStr.Data = append(dynamic.DynStr.Data, helpers.String2Bytes(str)...)
+	dynamic.DynStr.SectionEntry.ShSize = uint64(len(dynamic.DynStr.Data))
+	dynamic.strings[str] = offset
+
+	return offset
+}
+
+func (dynamic *DynamicSections) addEntry(tag int64, value uint64) {
+	dynamic.Entries = append(dynamic.Entries, elf.DynamicEntry{Tag: tag, Value: value})
+}
+
+// A relocation that is left for the dynamic loader, serialized in .rela.dyn
+type DynamicRelocation struct {
+	// section that holds the place to relocate
+	Section *elf.Section
+	Offset  uint64
+	Type    uint32
+
+	// symbol resolved by the dynamic loader, empty if the relocation is relative to this module
+	SymbolName string
+
+	// the addend is computed from the value of this symbol once the layout is done
+	AddendSymbol string
+	// same as AddendSymbol, for section symbols which can not be looked up by name
+	AddendSectionSymbol *elf.Symbol
+	Addend              uint64
+}
+
+func (linker *Linker) relaDyn() *elf.Section {
+	section, found := linker.Executable.MappedSections[".rela.dyn"]
+	if !found {
+		section = linker.addSyntheticSection(".rela.dyn", elf.SHT_RELA, elf.SHF_ALLOC, 8, 0x18)
+	}
+
+	return section
+}
+
+// Reserves the space of the relocation in .rela.dyn, this has to be done before the layout
+func (linker *Linker) addDynamicRelocation(relocation *DynamicRelocation) {
+	section := linker.relaDyn()
+	section.Data = append(section.Data, make([]byte, 0x18)...)
+	section.SectionEntry.ShSize = uint64(len(section.Data))
+
+	if relocation.SymbolName != "" {
+		linker.addDynamicSymbol(relocation.SymbolName)
+	}
+
+	linker.DynamicRelocations = append(linker.DynamicRelocations, relocation)
+}
+
+// Symbols that are referenced by dynamic relocations, in .dynsym order, the null symbol excluded
+func (linker *Linker) addDynamicSymbol(name string) {
+	if helpers.Find[string](linker.DynamicSymbols, name) == -1 {
+		linker.DynamicSymbols = append(linker.DynamicSymbols, name)
+	}
+}
+
+func (linker *Linker) dynamicSymbolIndex(name string) uint32 {
+	if name == "" {
+		return 0
+	}
+
+	return uint32(helpers.Find[string](linker.DynamicSymbols, name) + 1)
+}
+
+// The output needs the dynamic loader if it is a shared object or if it uses shared libraries
+func (linker *Linker) isDynamic() bool {
+	return linker.isPIC() || len(linker.Needed) != 0
+}
+
+// Returns true if the symbol is provided by another module at runtime, or if its definition
+// may be interposed by one
+func (linker *Linker) isImported(name string) bool {
+	router, found := linker.Symbols[name]
+	if found && router.DefinedSymbol == nil && router.SharedSymbol != nil {
+		return true
+	}
+
+	return linker.isPreemptible(name)
+}
+
+// The type of an imported symbol, the one of its definition if there is one. The loader runs
+// the resolver of a STT_GNU_IFUNC of another module, for this one it is a function.
+func (linker *Linker) importedSymbolType(name string) elf.STT {
+	router, found := linker.Symbols[name]
+	symbolType := elf.STT_NOTYPE
+	switch {
+	case !found:
+	case router.DefinedSymbol != nil:
+		symbolType = router.DefinedSymbol.Symbol.BaseSymbol.GetType()
+	case router.SharedSymbol != nil:
+		symbolType = router.SharedSymbol.Symbol.BaseSymbol.GetType()
+	case router.Reference != nil:
+		symbolType = router.Reference.Symbol.BaseSymbol.GetType()
+	}
+
+	if symbolType == elf.STT_GNU_IFUNC {
+		return elf.STT_FUNC
+	}
+
+	return symbolType
+}
+
+// References to symbols of other modules are resolved through the GOT, the PLT or dynamic
+// relocations of the place itself
+func (linker *Linker) scanImportedRelocation(section *elf.Section, relocation *elf.Relocation) error {
+	name := relocation.SymbolName
+
+	switch relocation.GetType() {
+	case elf.R_X86_64_GOTPCREL, elf.R_X86_64_GOTPCRELX, elf.R_X86_64_REX_GOTPCRELX:
+		entry, isNew := linker.got().Allocate(GOT_SYMBOL, name)
+		if isNew {
+			linker.addDynamicRelocation(&DynamicRelocation{
+				Section: linker.GOT.Section, Offset: entry.Offset, Type: elf.R_X86_64_GLOB_DAT, SymbolName: name,
+			})
+		}
+	case elf.R_X86_64_PLT32:
+		linker.allocatePLTEntry(name)
+	case elf.R_X86_64_PC32:
+		if !linker.LinkerInputs.Shared {
+			return linker.importAddress(name)
+		}
+
+		if linker.importedSymbolType(name) != elf.STT_FUNC {
+			return fmt.Errorf("%w: R_X86_64_PC32 against %s, recompile with -fPIC", NotPICErr, name)
+		}
+		linker.allocatePLTEntry(name)
+	case elf.R_X86_64_32, elf.R_X86_64_32S:
+		if linker.isPIC() {
+			return fmt.Errorf("%w: 32-bit absolute address of %s, recompile with -fPIC", NotPICErr, name)
+		}
+
+		return linker.importAddress(name)
+	case elf.R_X86_64_64:
+		// a text relocation is avoided by binding the address at link time
+		if !linker.isPIC() && !section.SectionEntry.IsWritable() {
+			return linker.importAddress(name)
+		}
+
+		return linker.addAbsoluteRelocation(section, relocation)
+	default:
+		return fmt.Errorf("%w: type %d against %s", ImportedSymbolRelocationErr, relocation.GetType(), name)
+	}
+
+	return nil
+}
+
+// Code of an executable that takes the address of an imported symbol expects it to be fixed at
+// link time. The data objects are copied into the executable, the functions get a canonical PLT
+// entry whose address is the one of the function for all the modules.
+func (linker *Linker) importAddress(name string) error {
+	switch linker.importedSymbolType(name) {
+	case elf.STT_OBJECT:
+		return linker.addCopyRelocation(name)
+	case elf.STT_FUNC:
+		linker.allocatePLTEntry(name).Canonical = true
+		return nil
+	}
+
+	return fmt.Errorf("%w: address of %s which is neither a function nor an object", ImportedSymbolRelocationErr, name)
+}
+
+// Creates .interp, .dynsym, .dynstr and .dynamic, this has to be called after the relocations
+// are scanned as they decide which symbols are dynamic
+func (linker *Linker) createDynamicSections() {
+	if !linker.isDynamic() {
+		return
+	}
+
+	dynamic := &DynamicSections{strings: make(map[string]uint32)}
+	linker.Dynamic = dynamic
+
+	if linker.gnuHashTable() {
+		linker.sortDynamicSymbols()
+	}
+
+	linker.packRelativeRelocations()
+
+	// a static PIE relocates itself, there is no interpreter
+	if !linker.LinkerInputs.Shared && !linker.LinkerInputs.Static {
+		interpreter := linker.LinkerInputs.DynamicLinker
+		if interpreter == "" {
+			interpreter = DefaultDynamicLinker
+		}
+
+		dynamic.Interp = linker.addSyntheticSection(".interp", elf.SHT_PROGBITS, elf.SHF_ALLOC, 1, 0)
+		dynamic.Interp.Data = helpers.String2Bytes(interpreter)
+		dynamic.Interp.SectionEntry.ShSize = uint64(len(dynamic.Interp.Data))
+	}
+
+	dynamic.DynSym = linker.addSyntheticSection(".dynsym", elf.SHT_DYNSYM, elf.SHF_ALLOC, 8, 0x18)
+	dynamic.DynSym.Data = make([]byte, 0x18*(len(linker.DynamicSymbols)+1))
+	dynamic.DynSym.SectionEntry.ShSize = uint64(len(dynamic.DynSym.Data))
+	// only the null symbol is local
+	dynamic.DynSym.SectionEntry.ShInfo = 1
+
+	dynamic.DynStr = linker.addSyntheticSection(".dynstr", elf.SHT_STRTAB, elf.SHF_ALLOC, 1, 0)
+	dynamic.DynStr.Data = []byte{0}
+	dynamic.DynStr.SectionEntry.ShSize = 1
+	for _, name := range linker.DynamicSymbols {
+		dynamic.addString(unversionedName(name))
+	}
+
+	for _, needed := range linker.Needed {
+		dynamic.addEntry(elf.DT_NEEDED, uint64(dynamic.addString(needed)))
+	}
+
+	if linker.LinkerInputs.SOName != "" {
+		dynamic.addEntry(elf.DT_SONAME, uint64(dynamic.addString(linker.LinkerInputs.SOName)))
+	}
+
+	if len(linker.LinkerInputs.RPath) != 0 {
+		rpath := strings.Join(linker.LinkerInputs.RPath, ":")
+		tag := int64(elf.DT_RPATH)
+		if linker.LinkerInputs.EnableNewDTags {
+			tag = elf.DT_RUNPATH
+		}
+		dynamic.addEntry(tag, uint64(dynamic.addString(rpath)))
+	}
+
+	if linker.sysvHashTable() {
+		dynamic.Hash = linker.addSyntheticSection(".hash", elf.SHT_HASH, elf.SHF_ALLOC, 8, 4)
+		dynamic.Hash.Data = make([]byte, sysvHashSize(len(linker.DynamicSymbols)+1))
+		dynamic.Hash.SectionEntry.ShSize = uint64(len(dynamic.Hash.Data))
+		dynamic.addEntry(elf.DT_HASH, 0)
+	}
+
+	if linker.gnuHashTable() {
+		defined := 0
+		for _, name := range linker.DynamicSymbols {
+			if linker.isDefinedDynamicSymbol(name) {
+				defined++
+			}
+		}
+
+		dynamic.GNUHash = linker.addSyntheticSection(".gnu.hash", elf.SHT_GNU_HASH, elf.SHF_ALLOC, 8, 0)
+		dynamic.GNUHash.Data = make([]byte, gnuHashSize(defined))
+		dynamic.GNUHash.SectionEntry.ShSize = uint64(len(dynamic.GNUHash.Data))
+		dynamic.addEntry(elf.DT_GNU_HASH, 0)
+	}
+
+	// the addresses are set by fillDynamicSections
+	dynamic.addEntry(elf.DT_STRTAB, 0)
+	dynamic.addEntry(elf.DT_SYMTAB, 0)
+	dynamic.addEntry(elf.DT_STRSZ, 0)
+	dynamic.addEntry(elf.DT_SYMENT, 0x18)
+
+	linker.createVersionSections()
+
+	if relaDyn, found := linker.Executable.MappedSections[".rela.dyn"]; found {
+		dynamic.addEntry(elf.DT_RELA, 0)
+		dynamic.addEntry(elf.DT_RELASZ, relaDyn.SectionEntry.ShSize)
+		dynamic.addEntry(elf.DT_RELAENT, 0x18)
+	}
+
+	// the constructors and destructors that the dynamic loader runs
+	if _, found := linker.Executable.MappedSections[".init_array"]; found {
+		dynamic.addEntry(elf.DT_INIT_ARRAY, 0)
+		dynamic.addEntry(elf.DT_INIT_ARRAYSZ, 0)
+	}
+	if _, found := linker.Executable.MappedSections[".fini_array"]; found {
+		dynamic.addEntry(elf.DT_FINI_ARRAY, 0)
+		dynamic.addEntry(elf.DT_FINI_ARRAYSZ, 0)
+	}
+
+	if dynamic.Relr != nil {
+		dynamic.addEntry(elf.DT_RELR, 0)
+		dynamic.addEntry(elf.DT_RELRSZ, dynamic.Relr.Section.SectionEntry.ShSize)
+		dynamic.addEntry(elf.DT_RELRENT, 8)
+	}
+
+	if linker.PLT != nil {
+		dynamic.addEntry(elf.DT_PLTGOT, 0)
+		dynamic.addEntry(elf.DT_PLTRELSZ, linker.PLT.RelaSection.SectionEntry.ShSize)
+		dynamic.addEntry(elf.DT_PLTREL, elf.DT_RELA)
+		dynamic.addEntry(elf.DT_JMPREL, 0)
+	}
+
+	if linker.DynamicFlags&elf.DF_TEXTREL != 0 {
+		dynamic.addEntry(elf.DT_TEXTREL, 0)
+	}
+
+	linker.setDynamicFlags()
+
+	if linker.DynamicFlags != 0 {
+		dynamic.addEntry(elf.DT_FLAGS, linker.DynamicFlags)
+	}
+
+	if linker.DynamicFlags1 != 0 {
+		dynamic.addEntry(elf.DT_FLAGS_1, linker.DynamicFlags1)
+	}
+
+	if !linker.LinkerInputs.Shared {
+		// filled by the dynamic loader for debuggers
+		dynamic.addEntry(elf.DT_DEBUG, 0)
+	}
+
+	dynamic.Section = linker.dynamicSection()
+	dynamic.Section.Data = make([]byte, 0x10*(len(dynamic.Entries)+1))
+	dynamic.Section.SectionEntry.ShSize = uint64(len(dynamic.Section.Data))
+}
+
+// The DT_FLAGS and DT_FLAGS_1 chosen by the inputs
+func (linker *Linker) setDynamicFlags() {
+	inputs := linker.LinkerInputs
+
+	if inputs.BindNow {
+		linker.DynamicFlags |= elf.DF_BIND_NOW
+		linker.DynamicFlags1 |= elf.DF_1_NOW
+	}
+
+	// $ORIGIN is expanded by the dynamic loader to the directory of the module
+	if inputs.Origin || strings.Contains(strings.Join(inputs.RPath, ":"), "$ORIGIN") {
+		linker.DynamicFlags |= elf.DF_ORIGIN
+		linker.DynamicFlags1 |= elf.DF_1_ORIGIN
+	}
+
+	if inputs.NoDelete {
+		linker.DynamicFlags1 |= elf.DF_1_NODELETE
+	}
+
+	if inputs.PIE {
+		linker.DynamicFlags1 |= elf.DF_1_PIE
+	}
+}
+
+// .dynamic is created before the other dynamic sections, _DYNAMIC has to be defined before
+// the undefined symbols are checked
+func (linker *Linker) dynamicSection() *elf.Section {
+	section, found := linker.Executable.MappedSections[".dynamic"]
+	if !found {
+		section = linker.addSyntheticSection(".dynamic", elf.SHT_DYNAMIC, elf.SHF_ALLOC|elf.SHF_WRITE, 8, 0x10)
+	}
+
+	return section
+}
+
+// Serializes .dynsym and .dynamic and links the dynamic sections together, this is called
+// after the layout is done
+func (linker *Linker) fillDynamicSections() error {
+	dynamic := linker.Dynamic
+	if dynamic == nil {
+		return nil
+	}
+
+	sectionIndex := func(section *elf.Section) uint32 {
+		return uint32(helpers.Find[*elf.Section](linker.Executable.Sections, section))
+	}
+
+	dynamic.DynSym.SectionEntry.ShLink = sectionIndex(dynamic.DynStr)
+	for _, hash := range []*elf.Section{dynamic.Hash, dynamic.GNUHash} {
+		if hash != nil {
+			hash.SectionEntry.ShLink = sectionIndex(dynamic.DynSym)
+		}
+	}
+	dynamic.Section.SectionEntry.ShLink = sectionIndex(dynamic.DynStr)
+	if relaDyn, found := linker.Executable.MappedSections[".rela.dyn"]; found {
+		relaDyn.SectionEntry.ShLink = sectionIndex(dynamic.DynSym)
+	}
+	if linker.PLT != nil {
+		linker.PLT.RelaSection.SectionEntry.ShLink = sectionIndex(dynamic.DynSym)
+		linker.PLT.RelaSection.SectionEntry.ShInfo = sectionIndex(linker.PLT.GOTPLT)
+	}
+	if versions := dynamic.Versions; versions != nil {
+		versions.VerSym.SectionEntry.ShLink = sectionIndex(dynamic.DynSym)
+		if versions.VerDef != nil {
+			versions.VerDef.SectionEntry.ShLink = sectionIndex(dynamic.DynStr)
+		}
+		if versions.VerNeed != nil {
+			versions.VerNeed.SectionEntry.ShLink = sectionIndex(dynamic.DynStr)
+		}
+	}
+
+	for idx, name := range linker.DynamicSymbols {
+		entry := dynamic.DynSym.Data[(idx+1)*0x18:]
+		binary.LittleEndian.PutUint32(entry, dynamic.strings[unversionedName(name)])
+
+		if router := linker.Symbols[name]; router != nil && router.DefinedSymbol != nil {
+			symbol := router.DefinedSymbol.Symbol
+			value := linker.GetSymbolVirtAddress(symbol)
+			if symbol.BaseSymbol.GetType() == elf.STT_TLS {
+				// the value of a TLS symbol is its offset in the TLS block
+				value -= linker.TLS.Vaddr
+			}
+
+			entry[0x4] = symbol.BaseSymbol.StInfo
+			entry[0x5] = symbol.BaseSymbol.StOther
+			binary.LittleEndian.PutUint16(entry[0x6:], symbol.BaseSymbol.StShNdx)
+			binary.LittleEndian.PutUint64(entry[0x8:], value)
+			binary.LittleEndian.PutUint64(entry[0x10:], symbol.BaseSymbol.StSize)
+			continue
+		}
+
+		// a weak reference may stay unresolved at runtime too
+		binding := elf.STB_GLOBAL
+		if router := linker.Symbols[name]; router != nil && router.SymbolType == SYM_WEAK {
+			binding = elf.STB_WEAK
+		}
+		entry[0x4] = byte(binding)<<4 | byte(linker.importedSymbolType(name))
+		// the references of the other modules are bound to the canonical PLT entry, the
+		// JUMP_SLOT of the entry itself is not
+		if linker.isCanonicalPLTEntry(name) {
+			address, _ := linker.pltAddress(name)
+			binary.LittleEndian.PutUint64(entry[0x8:], address)
+		}
+	}
+
+	names := []string{""}
+	for _, name := range linker.DynamicSymbols {
+		names = append(names, unversionedName(name))
+	}
+	if dynamic.Hash != nil {
+		fillSysvHash(dynamic.Hash.Data, names)
+	}
+	linker.fillRelr()
+	if dynamic.GNUHash != nil {
+		offset := 1
+		for offset < len(names) && !linker.isDefinedDynamicSymbol(linker.DynamicSymbols[offset-1]) {
+			offset++
+		}
+		fillGNUHash(dynamic.GNUHash.Data, names[offset:], offset)
+	}
+	linker.fillVersionSections()
+
+	for idx, entry := range dynamic.Entries {
+		switch entry.Tag {
+		case elf.DT_STRTAB:
+			entry.Value = linker.GetSectionVirtAddress(dynamic.DynStr)
+		case elf.DT_SYMTAB:
+			entry.Value = linker.GetSectionVirtAddress(dynamic.DynSym)
+		case elf.DT_STRSZ:
+			entry.Value = dynamic.DynStr.SectionEntry.ShSize
+		case elf.DT_RELA:
+			entry.Value = linker.GetSectionVirtAddress(linker.Executable.MappedSections[".rela.dyn"])
+		case elf.DT_INIT_ARRAY:
+			entry.Value = linker.GetSectionVirtAddress(linker.Executable.MappedSections[".init_array"])
+		case elf.DT_INIT_ARRAYSZ:
+			entry.Value = linker.Executable.MappedSections[".init_array"].SectionEntry.ShSize
+		case elf.DT_FINI_ARRAY:
+			entry.Value = linker.GetSectionVirtAddress(linker.Executable.MappedSections[".fini_array"])
+		case elf.DT_FINI_ARRAYSZ:
+			entry.Value = linker.Executable.MappedSections[".fini_array"].SectionEntry.ShSize
+		case elf.DT_RELR:
+			entry.Value = linker.GetSectionVirtAddress(dynamic.Relr.Section)
+		case elf.DT_PLTGOT:
+			entry.Value = linker.GetSectionVirtAddress(linker.PLT.GOTPLT)
+		case elf.DT_JMPREL:
+			entry.Value = linker.GetSectionVirtAddress(linker.PLT.RelaSection)
+		case elf.DT_HASH:
+			entry.Value = linker.GetSectionVirtAddress(dynamic.Hash)
+		case elf.DT_GNU_HASH:
+			entry.Value = linker.GetSectionVirtAddress(dynamic.GNUHash)
+		case elf.DT_VERSYM:
+			entry.Value = linker.GetSectionVirtAddress(dynamic.Versions.VerSym)
+		case elf.DT_VERDEF:
+			entry.Value = linker.GetSectionVirtAddress(dynamic.Versions.VerDef)
+		case elf.DT_VERNEED:
+			entry.Value = linker.GetSectionVirtAddress(dynamic.Versions.VerNeed)
+		}
+
+		dynamic.Entries[idx] = entry
+		binary.LittleEndian.PutUint64(dynamic.Section.Data[idx*0x10:], uint64(entry.Tag))
+		binary.LittleEndian.PutUint64(dynamic.Section.Data[idx*0x10+0x8:], entry.Value)
+	}
+
+	return nil
+}
+
+// In a shared object a symbol that is not defined by the inputs is provided by another module
+// at runtime, and an exported definition with default visibility can be interposed by the one
+// of a module that is loaded before, usually the executable
+func (linker *Linker) isPreemptible(name string) bool {
+	if !linker.LinkerInputs.Shared {
+		return false
+	}
+
+	router, found := linker.Symbols[name]
+	if !found || router.DefinedSymbol == nil {
+		return true
+	}
+
+	return linker.isExported(router) &&
+		router.DefinedSymbol.Symbol.BaseSymbol.GetVisibility() == elf.STV_DEFAULT &&
+		!linker.bindsLocally(name, router)
+}
+
+// -Bsymbolic binds the references of a shared object to its own definitions, -Bsymbolic-functions
+// only the ones to functions. With a dynamic list only the listed symbols can be interposed.
+func (linker *Linker) bindsLocally(name string, router *SymbolRouter) bool {
+	switch {
+	case linker.LinkerInputs.Symbolic:
+		return true
+	case linker.LinkerInputs.SymbolicFunctions && router.DefinedSymbol.Symbol.BaseSymbol.GetType() == elf.STT_FUNC:
+		return true
+	case linker.DynamicList != nil:
+		_, global, found := linker.DynamicList.assign(name)
+		return !found || !global
+	}
+
+	return false
+}
+
+// Definitions of the inputs that are visible to other modules, symbols defined by the linker
+// are not exported
+func (linker *Linker) isExported(router *SymbolRouter) bool {
+	if router.DefinedSymbol == nil || router.DefinedSymbol.Elf == nil || router.Local ||
+		linker.isExcludedLibrary(router.DefinedSymbol.Elf) {
+		return false
+	}
+
+	symbol := router.DefinedSymbol.Symbol.BaseSymbol
+	binding := symbol.GetBinding()
+	visibility := symbol.GetVisibility()
+
+	return (binding == elf.STB_GLOBAL || binding == elf.STB_WEAK) &&
+		(visibility == elf.STV_DEFAULT || visibility == elf.STV_PROTECTED)
+}
+
+// The exported definitions are added to .dynsym in the order of the output symbol table
+func (linker *Linker) exportSymbols() error {
+	if err := linker.readDynamicList(); err != nil {
+		return err
+	}
+
+	if linker.LinkerInputs.Shared && linker.LinkerInputs.Symbolic {
+		linker.DynamicFlags |= elf.DF_SYMBOLIC
+	}
+
+	for _, symbol := range linker.Executable.Symbols {
+		router, found := linker.Symbols[symbol.Name]
+		if found && router.DefinedSymbol != nil && router.DefinedSymbol.Symbol == symbol &&
+			linker.isExported(router) && linker.isDynamicExport(symbol.Name) {
+			// the versions of the definitions are defined by the version script
+			if symbol.Version != "" && linker.VersionScript == nil {
+				return fmt.Errorf("%w: %s of %s, there is no version script", UndefinedVersionErr, symbol.Version, symbol.Name)
+			}
+			linker.addDynamicSymbol(symbol.Name)
+		}
+	}
+
+	return nil
+}
+
+// The dynamic list is read once, --gc-sections needs it before the export
+func (linker *Linker) readDynamicList() error {
+	if linker.LinkerInputs.DynamicList == "" || linker.DynamicList != nil {
+		return nil
+	}
+
+	list, err := ReadVersionScript(linker.LinkerInputs.DynamicList)
+	if err != nil {
+		return err
+	}
+	linker.DynamicList = list
+
+	return nil
+}
+
+// A shared object exports all its global definitions. An executable exports the ones that the
+// shared libraries it is linked against reference, all of them with --export-dynamic, and the
+// ones of the dynamic list.
+func (linker *Linker) isDynamicExport(name string) bool {
+	if linker.LinkerInputs.Shared || linker.LinkerInputs.ExportDynamic {
+		return true
+	}
+
+	if linker.DynamicList != nil {
+		if _, global, found := linker.DynamicList.assign(name); found && global {
+			return true
+		}
+	}
+
+	for _, library := range linker.SharedLibraries {
+		if _, found := library.references[name]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Absolute addresses in a position independent output are only known at runtime, the place
+// is relocated by the dynamic loader. Places in read-only sections need text relocations,
+// which are only allowed with -z notext.
+func (linker *Linker) addAbsoluteRelocation(section *elf.Section, relocation *elf.Relocation) error {
+	if !section.SectionEntry.IsWritable() {
+		if !linker.LinkerInputs.NoText {
+			return fmt.Errorf("%w: R_X86_64_64 against %s in read-only section %s, recompile with -fPIC",
+				TextRelocationErr, relocation.SymbolName, section.Name)
+		}
+
+		linker.DynamicFlags |= elf.DF_TEXTREL
+	}
+
+	dynamicRelocation := &DynamicRelocation{
+		Section: section,
+		Offset:  relocation.Offset,
+		Addend:  relocation.Addend,
+	}
+
+	if isSectionRelocation(relocation) {
+		dynamicRelocation.Type = elf.R_X86_64_RELATIVE
+		dynamicRelocation.AddendSectionSymbol = relocation.Symbol
+	} else if linker.isImported(relocation.SymbolName) {
+		dynamicRelocation.Type = elf.R_X86_64_64
+		dynamicRelocation.SymbolName = relocation.SymbolName
+	} else {
+		dynamicRelocation.Type = elf.R_X86_64_RELATIVE
+		dynamicRelocation.AddendSymbol = relocation.SymbolName
+	}
+
+	linker.addDynamicRelocation(dynamicRelocation)
+
+	return nil
+}
+
+// Position independent outputs can be loaded at any address
+func (linker *Linker) isPIC() bool {
+	return linker.LinkerInputs.Shared || linker.LinkerInputs.PIE
+}
+
+// Serializes the dynamic relocations, this is called after the layout is done
+func (linker *Linker) fillDynamicRelocations() error {
+	if len(linker.DynamicRelocations) == 0 {
+		return nil
+	}
+
+	section := linker.relaDyn()
+	for idx, relocation := range linker.DynamicRelocations {
+		addend := relocation.Addend
+		if relocation.AddendSectionSymbol != nil {
+			addend += linker.GetSymbolVirtAddress(relocation.AddendSectionSymbol)
+		} else if relocation.AddendSymbol != "" {
+			symbol, err := linker.resolveSymbol(relocation.AddendSymbol)
+			if err != nil {
+				return err
+			}
+
+			S := linker.GetSymbolVirtAddress(symbol)
+			stub, isIFunc := linker.ipltStubAddress(relocation.AddendSymbol)
+			switch {
+			case relocation.Type == elf.R_X86_64_DTPOFF64 || relocation.Type == elf.R_X86_64_TPOFF64 ||
+				relocation.Type == elf.R_X86_64_TLSDESC:
+				// offset of the variable in the TLS block of this module
+				addend += S - linker.TLS.Vaddr
+			case relocation.Type == elf.R_X86_64_RELATIVE && isIFunc:
+				// the address of an indirect function is its stub, the resolver is only
+				// the addend of R_X86_64_IRELATIVE
+				addend += stub
+			default:
+				addend += S
+			}
+		}
+
+		entry := section.Data[idx*0x18:]
+		binary.LittleEndian.PutUint64(entry, linker.GetSectionVirtAddress(relocation.Section)+relocation.Offset)
+		binary.LittleEndian.PutUint64(entry[0x8:], uint64(linker.dynamicSymbolIndex(relocation.SymbolName))<<32|uint64(relocation.Type))
+		binary.LittleEndian.PutUint64(entry[0x10:], addend)
+	}
+
+	return nil
+}
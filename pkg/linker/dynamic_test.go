@@ -0,0 +1,465 @@
+package linker
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamicExecutable(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_dynmain.o",
+		"../../data/sample_shared_lib.so",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	phdrTypes := []uint32{}
+	for _, phdr := range l.Executable.PhdrEntries {
+		phdrTypes = append(phdrTypes, phdr.Type)
+	}
+	assert.Truef(t, len(phdrTypes) == int(l.Executable.Header.PhNum), "PhNum does not match the program headers")
+	assert.Truef(t, phdrTypes[0] == elf.PT_PHDR && phdrTypes[1] == elf.PT_INTERP, "PT_PHDR and PT_INTERP should come first got=%v", phdrTypes)
+
+	for _, phdr := range l.Executable.PhdrEntries {
+		if phdr.Type == elf.PT_LOAD {
+			assert.Truef(t, phdr.Vaddr%phdr.Align == phdr.Offset%phdr.Align, "PT_LOAD address and offset are not congruent")
+		}
+	}
+
+	interp := l.Executable.MappedSections[".interp"]
+	assert.Truef(t, string(interp.Data) == DefaultDynamicLinker+"\x00", "wrong interpreter got=%s", interp.Data)
+
+	// DT_NEEDED and the addresses of the dynamic sections
+	tags := make(map[int64]uint64)
+	for _, entry := range l.Dynamic.Entries {
+		tags[entry.Tag] = entry.Value
+	}
+	dynstr := l.Dynamic.DynStr
+	assert.Truef(t, string(dynstr.Data[tags[elf.DT_NEEDED]:tags[elf.DT_NEEDED]+15]) == "libsample.so.1\x00", "wrong DT_NEEDED")
+	assert.Truef(t, tags[elf.DT_JMPREL] == l.PLT.RelaSection.SectionEntry.ShAddr, "wrong DT_JMPREL")
+	assert.Truef(t, tags[elf.DT_PLTGOT] == l.PLT.GOTPLT.SectionEntry.ShAddr, "wrong DT_PLTGOT")
+
+	dynamicSymbol := l.GetSymbolVirtAddress(l.Symbols["_DYNAMIC"].DefinedSymbol.Symbol)
+	assert.Truef(t, dynamicSymbol == l.Dynamic.Section.SectionEntry.ShAddr, "_DYNAMIC should be the address of .dynamic")
+	assert.Truef(t, binary.LittleEndian.Uint64(l.PLT.GOTPLT.Data) == dynamicSymbol, ".got.plt should start with _DYNAMIC")
+
+	// the call goes through the PLT, whose slot initially points to the push of the entry
+	assert.Truef(t, len(l.PLT.Entries) == 1, "lib_func should have a PLT entry")
+	entry, _ := l.pltAddress("lib_func")
+	assert.Truef(t, binary.LittleEndian.Uint64(l.PLT.GOTPLT.Data[l.PLT.Entries[0].GOTOffset:]) == entry+6, "wrong lazy binding slot")
+
+	rela := l.PLT.RelaSection.Data
+	assert.Truef(t, binary.LittleEndian.Uint64(rela[0x8:]) == uint64(l.dynamicSymbolIndex("lib_func"))<<32|elf.R_X86_64_JUMP_SLOT, "wrong JUMP_SLOT")
+
+	relocationTypes := make(map[uint32]string)
+	for _, relocation := range l.DynamicRelocations {
+		relocationTypes[relocation.Type] = relocation.SymbolName
+	}
+	assert.Truef(t, relocationTypes[elf.R_X86_64_GLOB_DAT] == "lib_var", "the GOT entry of lib_var should be GLOB_DAT")
+	assert.Truef(t, relocationTypes[elf.R_X86_64_64] == "lib_var", "lib_var_ptr should be relocated at runtime")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile("../../data/sample_shared_lib.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libsample.so.1"), library, 0755) == nil, "writing the library failed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+
+	// lib_func(lib_var) twice plus local, the references need lib_func@@LIB_2.0 which adds lib_var
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 6+6+10, "wrong exit code: %v", err)
+}
+
+func TestSharedObjectOutput(t *testing.T) {
+	dir := t.TempDir()
+	library := filepath.Join(dir, "libmine.so")
+
+	l, err := Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_libmine.o"},
+		ExecutableName: library,
+		Shared:         true,
+		SOName:         "libmine.so",
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.Executable.Header.Type == elf.ET_DYN, "a shared object should be ET_DYN")
+
+	for _, phdr := range l.Executable.PhdrEntries {
+		if phdr.Type == elf.PT_LOAD {
+			assert.Truef(t, phdr.Vaddr == 0, "a shared object should be linked at address 0 got=%x", phdr.Vaddr)
+			break
+		}
+	}
+
+	tags := make(map[int64]uint64)
+	for _, entry := range l.Dynamic.Entries {
+		tags[entry.Tag] = entry.Value
+	}
+	dynstr := l.Dynamic.DynStr
+	assert.Truef(t, string(dynstr.Data[tags[elf.DT_SONAME]:tags[elf.DT_SONAME]+11]) == "libmine.so\x00", "wrong DT_SONAME")
+	assert.Truef(t, tags[elf.DT_HASH] == l.Dynamic.Hash.SectionEntry.ShAddr, "wrong DT_HASH")
+
+	// hidden definitions are not exported
+	for _, name := range []string{"counter", "counter_ptr", "get", "call_get"} {
+		assert.Truef(t, l.dynamicSymbolIndex(name) != 0, "%s should be exported", name)
+	}
+	assert.Truef(t, l.dynamicSymbolIndex("internal") == 0, "internal is hidden")
+
+	// exported symbols can be preempted, the static pointer is relocated relative to the base
+	relocationTypes := make(map[uint32]string)
+	for _, relocation := range l.DynamicRelocations {
+		relocationTypes[relocation.Type] = relocation.SymbolName
+	}
+	assert.Truef(t, relocationTypes[elf.R_X86_64_64] == "counter", "counter_ptr should be relocated against counter")
+	assert.Truef(t, relocationTypes[elf.R_X86_64_GLOB_DAT] == "counter_ptr", "the GOT entry of counter_ptr should be GLOB_DAT")
+	_, found := relocationTypes[elf.R_X86_64_RELATIVE]
+	assert.Truef(t, found, "hidden_ptr should be relocated relative to the base")
+	_, found = l.pltAddress("get")
+	assert.Truef(t, found, "get should be called through the PLT")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	_, err = Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_usemine.o", library},
+		ExecutableName: filepath.Join(dir, "a.out"),
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+
+	// call_get() returns counter + hidden_val
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 42, "wrong exit code: %v", err)
+}
+
+func TestSharedObjectTextRelocations(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_textrel.o"},
+		ExecutableName: filepath.Join(dir, "libtextrel.so"),
+		Shared:         true,
+	}
+
+	_, err := Link(inputs)
+	assert.ErrorIs(t, err, TextRelocationErr)
+
+	inputs.NoText = true
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.DynamicFlags&elf.DF_TEXTREL != 0, "DF_TEXTREL should be set")
+	assert.Truef(t, len(l.DynamicRelocations) == 1 && l.DynamicRelocations[0].Type == elf.R_X86_64_RELATIVE,
+		"the table should be relocated relative to the base")
+}
+
+func TestPositionIndependentExecutable(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_dynmain.o",
+		"../../data/sample_shared_lib.so",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out"), PIE: true})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.Executable.Header.Type == elf.ET_DYN, "a PIE should be ET_DYN")
+
+	start, _ := l.resolveSymbol("_start")
+	assert.Truef(t, l.Executable.Header.Entry == l.GetSymbolVirtAddress(start), "the entry should be _start")
+
+	phdrTypes := []uint32{}
+	for _, phdr := range l.Executable.PhdrEntries {
+		phdrTypes = append(phdrTypes, phdr.Type)
+	}
+	assert.Truef(t, phdrTypes[1] == elf.PT_INTERP && phdrTypes[2] == elf.PT_LOAD, "a PIE has an interpreter got=%v", phdrTypes)
+	assert.Truef(t, l.Executable.PhdrEntries[2].Vaddr == 0, "a PIE should be linked at address 0")
+
+	flags := uint64(0)
+	for _, entry := range l.Dynamic.Entries {
+		if entry.Tag == elf.DT_FLAGS_1 {
+			flags = entry.Value
+		}
+	}
+	assert.Truef(t, flags&elf.DF_1_PIE != 0, "DF_1_PIE should be set")
+
+	// the GOT entry of the local variable holds its address
+	relocationTypes := make(map[uint32]string)
+	for _, relocation := range l.DynamicRelocations {
+		relocationTypes[relocation.Type] = relocation.AddendSymbol
+	}
+	assert.Truef(t, relocationTypes[elf.R_X86_64_RELATIVE] != "", "local addresses should be relocated relative to the base")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile("../../data/sample_shared_lib.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libsample.so.1"), library, 0755) == nil, "writing the library failed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 6+6+10, "wrong exit code: %v", err)
+}
+
+func TestPositionIndependentWeakUndefined(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_weakpie.o"},
+		ExecutableName: filepath.Join(dir, "a.out"),
+		PIE:            true,
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the GOT slots and the pointer of the weak undefined symbols stay 0 wherever the output is loaded
+	assert.Truef(t, len(l.DynamicRelocations) == 0, "no dynamic relocation is needed got=%d", len(l.DynamicRelocations))
+	for _, name := range []string{"missing_var", "missing_func"} {
+		entry := l.GOT.Find(GOT_SYMBOL, name)
+		assert.Truef(t, entry != nil, "%s should have a GOT entry", name)
+		assert.Truef(t, entry != nil && binary.LittleEndian.Uint64(l.GOT.Section.Data[entry.Offset:]) == 0, "the GOT entry of %s should be 0", name)
+	}
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 1+2+4, "wrong exit code: %v", err)
+}
+
+func TestStaticPIE(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_static_pie.o"},
+		ExecutableName: filepath.Join(dir, "a.out"),
+		PIE:            true,
+		Static:         true,
+	}
+
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.Executable.Header.Type == elf.ET_DYN, "a static PIE should be ET_DYN")
+
+	hasDynamic := false
+	for _, phdr := range l.Executable.PhdrEntries {
+		assert.Truef(t, phdr.Type != elf.PT_INTERP, "a static PIE has no interpreter")
+		hasDynamic = hasDynamic || phdr.Type == elf.PT_DYNAMIC
+	}
+	assert.Truef(t, hasDynamic, "a static PIE finds its relocations through PT_DYNAMIC")
+
+	dynamicSymbol := l.GetSymbolVirtAddress(l.Symbols["_DYNAMIC"].DefinedSymbol.Symbol)
+	assert.Truef(t, dynamicSymbol == l.Dynamic.Section.SectionEntry.ShAddr, "_DYNAMIC should be the address of .dynamic")
+	assert.Truef(t, len(l.DynamicRelocations) == 1 && l.DynamicRelocations[0].Type == elf.R_X86_64_RELATIVE,
+		"the pointer to value should be relocated relative to the base")
+
+	// _start applies the RELATIVE relocations and exits with the value behind the pointer
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 7, "wrong exit code: %v", err)
+
+	inputs.Filenames = append(inputs.Filenames, "../../data/sample_shared_lib.so")
+	_, err = Link(inputs)
+	assert.ErrorIs(t, err, StaticLinkSharedLibraryErr)
+}
+
+func TestExecutableExports(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames: []string{
+			"../../data/sample_relocatable_callback_main.o",
+			"../../data/sample_shared_lib_callback.so",
+		},
+		ExecutableName: filepath.Join(dir, "a.out"),
+	}
+
+	// only the definitions that the library references are exported
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.dynamicSymbolIndex("exe_callback") != 0, "exe_callback is referenced by the library")
+	assert.Truef(t, l.dynamicSymbolIndex("exe_other") == 0, "exe_other is not referenced by the library")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err == nil {
+		library, err := os.ReadFile("../../data/sample_shared_lib_callback.so")
+		assert.Truef(t, err == nil, "%v", err)
+		assert.Truef(t, os.WriteFile(filepath.Join(dir, "libcallback.so"), library, 0755) == nil, "writing the library failed")
+
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+		err = cmd.Run()
+		assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 6, "wrong exit code: %v", err)
+	}
+
+	inputs.ExportDynamic = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.dynamicSymbolIndex("exe_other") != 0, "--export-dynamic exports every definition")
+
+	inputs.ExportDynamic = false
+	inputs.DynamicList = filepath.Join(dir, "dynamic.list")
+	assert.Truef(t, os.WriteFile(inputs.DynamicList, []byte("{ exe_other; };\n"), 0644) == nil, "writing the list failed")
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.dynamicSymbolIndex("exe_other") != 0, "exe_other is in the dynamic list")
+	assert.Truef(t, l.dynamicSymbolIndex("_start") == 0, "_start is not in the dynamic list")
+}
+
+func TestSymbolicBinding(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_libmine.o"},
+		ExecutableName: filepath.Join(dir, "libmine.so"),
+		Shared:         true,
+	}
+
+	relocationTypes := func(l *Linker) map[string]uint32 {
+		types := make(map[string]uint32)
+		for _, relocation := range l.DynamicRelocations {
+			if relocation.SymbolName != "" {
+				types[relocation.SymbolName] = relocation.Type
+			}
+		}
+		return types
+	}
+
+	// the definitions stay exported but the references bind to them
+	inputs.Symbolic = true
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.DynamicFlags&elf.DF_SYMBOLIC != 0, "DF_SYMBOLIC should be set")
+	assert.Truef(t, l.dynamicSymbolIndex("get") != 0 && l.dynamicSymbolIndex("counter") != 0, "the definitions should be exported")
+	_, found := l.pltAddress("get")
+	assert.Truef(t, !found, "get should be called directly")
+	assert.Truef(t, len(relocationTypes(l)) == 0, "the references should be relocated relative to the base")
+
+	// only the functions bind locally
+	inputs.Symbolic = false
+	inputs.SymbolicFunctions = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.DynamicFlags&elf.DF_SYMBOLIC == 0, "DF_SYMBOLIC should not be set")
+	_, found = l.pltAddress("get")
+	assert.Truef(t, !found, "get should be called directly")
+	assert.Truef(t, relocationTypes(l)["counter"] == elf.R_X86_64_64, "counter can still be interposed")
+
+	// only the listed symbols can be interposed
+	inputs.SymbolicFunctions = false
+	inputs.DynamicList = filepath.Join(dir, "dynamic.list")
+	assert.Truef(t, os.WriteFile(inputs.DynamicList, []byte("{ get; };\n"), 0644) == nil, "writing the list failed")
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	_, found = l.pltAddress("get")
+	assert.Truef(t, found, "get can be interposed")
+	_, found = relocationTypes(l)["counter"]
+	assert.Truef(t, !found, "counter binds locally")
+}
+
+func TestDynamicTags(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames: []string{
+			"../../data/sample_relocatable_dynmain.o",
+			"../../data/sample_shared_lib.so",
+		},
+		ExecutableName: filepath.Join(dir, "a.out"),
+		RPath:          []string{"$ORIGIN/lib", "/opt/lib"},
+		BindNow:        true,
+		NoDelete:       true,
+	}
+
+	tags := func(l *Linker) map[int64]uint64 {
+		tags := make(map[int64]uint64)
+		for _, entry := range l.Dynamic.Entries {
+			tags[entry.Tag] = entry.Value
+		}
+		return tags
+	}
+	dynamicString := func(l *Linker, offset uint64) string {
+		data := string(l.Dynamic.DynStr.Data[offset:])
+		return data[:strings.IndexByte(data, 0)]
+	}
+
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	rpath, found := tags(l)[elf.DT_RPATH]
+	assert.Truef(t, found && dynamicString(l, rpath) == "$ORIGIN/lib:/opt/lib", "wrong DT_RPATH")
+	_, found = tags(l)[elf.DT_RUNPATH]
+	assert.Truef(t, !found, "DT_RUNPATH needs --enable-new-dtags")
+	assert.Truef(t, tags(l)[elf.DT_FLAGS] == elf.DF_ORIGIN|elf.DF_BIND_NOW, "wrong DT_FLAGS got=%x", tags(l)[elf.DT_FLAGS])
+	assert.Truef(t, tags(l)[elf.DT_FLAGS_1] == elf.DF_1_NOW|elf.DF_1_ORIGIN|elf.DF_1_NODELETE, "wrong DT_FLAGS_1 got=%x", tags(l)[elf.DT_FLAGS_1])
+
+	inputs.EnableNewDTags = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	runpath, found := tags(l)[elf.DT_RUNPATH]
+	assert.Truef(t, found && dynamicString(l, runpath) == "$ORIGIN/lib:/opt/lib", "wrong DT_RUNPATH")
+	_, found = tags(l)[elf.DT_RPATH]
+	assert.Truef(t, !found, "DT_RPATH is replaced by DT_RUNPATH")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	// the library is found next to the executable without LD_LIBRARY_PATH
+	library, err := os.ReadFile("../../data/sample_shared_lib.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.Mkdir(filepath.Join(dir, "lib"), 0755) == nil, "creating the directory failed")
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "lib", "libsample.so.1"), library, 0755) == nil, "writing the library failed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 6+6+10, "wrong exit code: %v", err)
+}
+
+func TestCanonicalPLT(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_canonmain.o",
+		"../../data/sample_shared_lib_imports.so",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the functions whose address is taken are exported with the address of their entry
+	for _, name := range []string{"lib_plain", "lib_select"} {
+		assert.Truef(t, l.isCanonicalPLTEntry(name), "%s should have a canonical PLT entry", name)
+		entry, _ := l.pltAddress(name)
+		symbol := l.Dynamic.DynSym.Data[int(l.dynamicSymbolIndex(name))*0x18:]
+		assert.Truef(t, binary.LittleEndian.Uint64(symbol[0x8:]) == entry, "%s should be exported with the address of its entry", name)
+		assert.Truef(t, binary.LittleEndian.Uint16(symbol[0x6:]) == elf.SHN_UNDEF, "%s is still defined by the library", name)
+	}
+	assert.Truef(t, !l.isCanonicalPLTEntry("lib_plain_address"), "lib_plain_address is only called")
+	for _, relocation := range l.DynamicRelocations {
+		assert.Truef(t, relocation.Type != elf.R_X86_64_COPY, "%s should not be copied", relocation.SymbolName)
+	}
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile("../../data/sample_shared_lib_imports.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libimports.so"), library, 0755) == nil, "writing the library failed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+
+	// the addresses taken by the executable and by the library are equal, lib_select is called
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 1+2+4+3*10, "wrong exit code: %v", err)
+}
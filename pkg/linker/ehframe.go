@@ -0,0 +1,409 @@
+package linker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/helpers"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+// Encodings of the pointers of .eh_frame and .eh_frame_hdr, the low bits are the format and the
+// high bits what the value is relative to
+const (
+	DW_EH_PE_absptr  = 0x00
+	DW_EH_PE_udata2  = 0x02
+	DW_EH_PE_udata4  = 0x03
+	DW_EH_PE_udata8  = 0x04
+	DW_EH_PE_sdata2  = 0x0a
+	DW_EH_PE_sdata4  = 0x0b
+	DW_EH_PE_sdata8  = 0x0c
+	DW_EH_PE_pcrel   = 0x10
+	DW_EH_PE_datarel = 0x30
+)
+
+// version, the encodings of eh_frame_ptr, fde_count and the table, eh_frame_ptr and fde_count
+const ehFrameHdrHeaderSize = 12
+
+var (
+	InvalidEhFrameErr      = errors.New("Invalid .eh_frame")
+	UnsupportedEncodingErr = errors.New("Unsupported pointer encoding")
+)
+
+// A CIE or an FDE of an input .eh_frame, the FDEs describe the unwinding of a function and
+// share the initial instructions and the augmentation of their CIE
+type ehRecord struct {
+	// the whole record, starting with its length
+	data []byte
+	// offset in the input section
+	offset uint64
+	// relocations of the record, at offsets of the input section
+	relocations []*elf.Relocation
+	objFile     *elf.ELF64
+
+	// the CIE of an FDE, nil for CIEs
+	cie *ehRecord
+	// encoding of the pc_begin of the FDEs of a CIE
+	fdeEncoding byte
+	// the identical CIE that is kept in the output
+	canonical *ehRecord
+	used      bool
+
+	outputOffset uint64
+}
+
+func (record *ehRecord) isCIE() bool {
+	return record.cie == nil
+}
+
+// .eh_frame of the output, the CIEs that are identical are only kept once, and the FDEs of the
+// functions that are not linked in are dropped. .eh_frame_hdr is a table of the FDEs sorted by
+// the address of their function, that the unwinder finds through PT_GNU_EH_FRAME.
+type EhFrame struct {
+	Section *elf.Section
+	// .eh_frame_hdr, nil without --eh-frame-hdr
+	Header *elf.Section
+	FDEs   []*ehRecord
+}
+
+func readULEB128(data []byte, offset uint64) (uint64, uint64) {
+	value, shift := uint64(0), uint(0)
+	for offset < uint64(len(data)) {
+		b := data[offset]
+		offset++
+		value |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	return value, offset
+}
+
+// The size of a pointer in the given encoding
+func encodedPointerSize(encoding byte) (uint64, error) {
+	switch encoding & 0x0f {
+	case DW_EH_PE_absptr, DW_EH_PE_udata8, DW_EH_PE_sdata8:
+		return 8, nil
+	case DW_EH_PE_udata4, DW_EH_PE_sdata4:
+		return 4, nil
+	case DW_EH_PE_udata2, DW_EH_PE_sdata2:
+		return 2, nil
+	}
+
+	return 0, fmt.Errorf("%w: 0x%x", UnsupportedEncodingErr, encoding)
+}
+
+// Reads the pointer at the offset, addr is the address of the pointer for pcrel
+func readEncodedPointer(data []byte, offset uint64, encoding byte, addr uint64) (uint64, error) {
+	var value uint64
+	switch encoding & 0x0f {
+	case DW_EH_PE_absptr, DW_EH_PE_udata8, DW_EH_PE_sdata8:
+		value = binary.LittleEndian.Uint64(data[offset:])
+	case DW_EH_PE_udata4:
+		value = uint64(binary.LittleEndian.Uint32(data[offset:]))
+	case DW_EH_PE_sdata4:
+		value = uint64(int32(binary.LittleEndian.Uint32(data[offset:])))
+	case DW_EH_PE_udata2:
+		value = uint64(binary.LittleEndian.Uint16(data[offset:]))
+	case DW_EH_PE_sdata2:
+		value = uint64(int16(binary.LittleEndian.Uint16(data[offset:])))
+	default:
+		return 0, fmt.Errorf("%w: 0x%x", UnsupportedEncodingErr, encoding)
+	}
+
+	switch encoding & 0x70 {
+	case DW_EH_PE_absptr:
+		return value, nil
+	case DW_EH_PE_pcrel:
+		return addr + value, nil
+	}
+
+	return 0, fmt.Errorf("%w: 0x%x", UnsupportedEncodingErr, encoding)
+}
+
+// The encoding of pc_begin in the FDEs of the CIE, given by the R of the augmentation string
+func cieFDEEncoding(data []byte) (byte, error) {
+	if len(data) < 10 {
+		return 0, InvalidEhFrameErr
+	}
+
+	version := data[8]
+	augmentation := helpers.GetString(data[9:])
+	offset := uint64(9 + len(augmentation) + 1)
+	if strings.Contains(augmentation, "eh") {
+		offset += 8
+	}
+
+	// code alignment, data alignment (signed, only the size matters) and return register
+	_, offset = readULEB128(data, offset)
+	_, offset = readULEB128(data, offset)
+	if version == 1 {
+		offset++
+	} else {
+		_, offset = readULEB128(data, offset)
+	}
+
+	if !strings.HasPrefix(augmentation, "z") {
+		return DW_EH_PE_absptr, nil
+	}
+
+	// length of the augmentation data
+	_, offset = readULEB128(data, offset)
+	for _, c := range augmentation[1:] {
+		if offset >= uint64(len(data)) {
+			return 0, InvalidEhFrameErr
+		}
+
+		switch c {
+		case 'R':
+			return data[offset], nil
+		case 'P':
+			size, err := encodedPointerSize(data[offset])
+			if err != nil {
+				return 0, err
+			}
+			offset += 1 + size
+		case 'L':
+			offset++
+		case 'S', 'B':
+		default:
+			return DW_EH_PE_absptr, nil
+		}
+	}
+
+	return DW_EH_PE_absptr, nil
+}
+
+// Splits an input .eh_frame in its CIEs and FDEs, a zero length ends the section
+func parseEhFrame(objFile *elf.ELF64, section *elf.Section) ([]*ehRecord, error) {
+	data := section.Data
+	records := []*ehRecord{}
+	cies := make(map[uint64]*ehRecord)
+
+	for offset := uint64(0); offset+4 <= uint64(len(data)); {
+		length := uint64(binary.LittleEndian.Uint32(data[offset:]))
+		if length == 0 {
+			break
+		}
+		end := offset + 4 + length
+		if length == 0xffffffff || length < 4 || end > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: record at 0x%x of %s", InvalidEhFrameErr, offset, objFile.Filename)
+		}
+
+		record := &ehRecord{data: data[offset:end], offset: offset, objFile: objFile}
+		id := uint64(binary.LittleEndian.Uint32(data[offset+4:]))
+		if id == 0 {
+			encoding, err := cieFDEEncoding(record.data)
+			if err != nil {
+				return nil, fmt.Errorf("%w: CIE at 0x%x of %s", err, offset, objFile.Filename)
+			}
+			record.fdeEncoding = encoding
+			cies[offset] = record
+		} else {
+			// the CIE pointer is the distance back from the pointer itself
+			cie, found := cies[offset+4-id]
+			if !found {
+				return nil, fmt.Errorf("%w: FDE at 0x%x of %s has no CIE", InvalidEhFrameErr, offset, objFile.Filename)
+			}
+			record.cie = cie
+		}
+
+		records = append(records, record)
+		offset = end
+	}
+
+	for _, relocation := range section.Relocations {
+		idx := sort.Search(len(records), func(i int) bool {
+			return records[i].offset+uint64(len(records[i].data)) > relocation.Offset
+		})
+		if idx == len(records) || records[idx].offset > relocation.Offset {
+			return nil, fmt.Errorf("%w: relocation at 0x%x of %s is outside the records", InvalidEhFrameErr, relocation.Offset, objFile.Filename)
+		}
+		records[idx].relocations = append(records[idx].relocations, relocation)
+	}
+
+	return records, nil
+}
+
+// CIEs are identical if they have the same bytes and their relocations reference the same
+// symbols, the local ones are only identical to themselves
+func cieKey(record *ehRecord) string {
+	var key strings.Builder
+	key.Write(record.data)
+	for _, relocation := range record.relocations {
+		target := relocation.SymbolName
+		if relocation.Symbol != nil && (target == "" || relocation.Symbol.IsLocal()) {
+			target = fmt.Sprintf("%p", relocation.Symbol)
+		}
+		fmt.Fprintf(&key, "|%x:%x:%x:%s", relocation.Offset-record.offset, relocation.GetType(), relocation.Addend, target)
+	}
+
+	return key.String()
+}
+
+// The input section that holds the function of the FDE, from the relocation of pc_begin
+func (linker *Linker) fdeSection(record *ehRecord) *elf.Section {
+	for _, relocation := range record.relocations {
+		if relocation.Offset-record.offset != 8 || relocation.Symbol == nil {
+			continue
+		}
+
+		symbol, objFile := relocation.Symbol, record.objFile
+		if symbol.BaseSymbol.StShNdx == 0 {
+			router, found := linker.Symbols[relocation.SymbolName]
+			if !found || router.DefinedSymbol == nil {
+				return nil
+			}
+			symbol, objFile = router.DefinedSymbol.Symbol, router.DefinedSymbol.Elf
+		}
+
+		if symbol.BaseSymbol.IsSpecialSection() || int(symbol.BaseSymbol.StShNdx) >= len(objFile.Sections) {
+			return nil
+		}
+		return objFile.Sections[symbol.BaseSymbol.StShNdx]
+	}
+
+	return nil
+}
+
+// Builds the .eh_frame of the output from the records of the inputs, once the sections are
+// merged. The kept records are copied with their relocations, and the CIE pointers of the FDEs
+// are rewritten for the output layout.
+func (linker *Linker) createEhFrame() error {
+	records := []*ehRecord{}
+	cies := make(map[string]*ehRecord)
+	dropped := 0
+
+	for _, objFile := range linker.InputObjects {
+		for _, section := range objFile.Sections {
+			if section.Name != ".eh_frame" {
+				continue
+			}
+
+			parsed, err := parseEhFrame(objFile, section)
+			if err != nil {
+				return err
+			}
+
+			for _, record := range parsed {
+				if record.isCIE() {
+					key := cieKey(record)
+					if canonical, found := cies[key]; found {
+						record.canonical = canonical
+						continue
+					}
+					record.canonical = record
+					cies[key] = record
+				} else if fdeSection := linker.fdeSection(record); fdeSection == nil || !linker.isMerged(fdeSection) {
+					dropped++
+					continue
+				} else {
+					record.cie.canonical.used = true
+				}
+				records = append(records, record)
+			}
+		}
+	}
+
+	if dropped != 0 {
+		log.Debugf("Dropped %d FDEs of functions that are not linked in", dropped)
+	}
+
+	fdes := []*ehRecord{}
+	for _, record := range records {
+		if !record.isCIE() {
+			fdes = append(fdes, record)
+		}
+	}
+	if len(fdes) == 0 {
+		return nil
+	}
+
+	linker.EhFrame = &EhFrame{
+		Section: linker.addSyntheticSection(".eh_frame", elf.SHT_PROGBITS, elf.SHF_ALLOC, 8, 0),
+		FDEs:    fdes,
+	}
+	section := linker.EhFrame.Section
+
+	for _, record := range records {
+		if record.isCIE() && !record.used {
+			continue
+		}
+
+		record.outputOffset = uint64(len(section.Data))
+		section.Data = append(section.Data, record.data...)
+		if !record.isCIE() {
+			binary.LittleEndian.PutUint32(section.Data[record.outputOffset+4:], uint32(record.outputOffset+4-record.cie.canonical.outputOffset))
+		}
+
+		for _, relocation := range record.relocations {
+			copied := *relocation
+			copied.Offset = record.outputOffset + relocation.Offset - record.offset
+			section.Relocations = append(section.Relocations, &copied)
+		}
+	}
+	section.SectionEntry.ShSize = uint64(len(section.Data))
+
+	if linker.LinkerInputs.EhFrameHdr {
+		linker.EhFrame.Header = linker.addSyntheticSection(".eh_frame_hdr", elf.SHT_PROGBITS, elf.SHF_ALLOC, 4, 0)
+		linker.EhFrame.Header.Data = make([]byte, ehFrameHdrHeaderSize+8*len(fdes))
+		linker.EhFrame.Header.SectionEntry.ShSize = uint64(len(linker.EhFrame.Header.Data))
+	}
+
+	return nil
+}
+
+// Writes the search table once the relocations of .eh_frame are applied, the addresses are
+// relative to .eh_frame_hdr
+func (linker *Linker) fillEhFrameHdr() error {
+	if linker.EhFrame == nil || linker.EhFrame.Header == nil {
+		return nil
+	}
+
+	ehFrameAddr := linker.GetSectionVirtAddress(linker.EhFrame.Section)
+	hdrAddr := linker.GetSectionVirtAddress(linker.EhFrame.Header)
+	ehFrame := linker.EhFrame.Section.Data
+	data := linker.EhFrame.Header.Data
+
+	type tableEntry struct {
+		pc  uint64
+		fde uint64
+	}
+	table := []tableEntry{}
+	for _, fde := range linker.EhFrame.FDEs {
+		pcAddr := ehFrameAddr + fde.outputOffset + 8
+		pc, err := readEncodedPointer(ehFrame, fde.outputOffset+8, fde.cie.fdeEncoding, pcAddr)
+		if err != nil {
+			return fmt.Errorf("%w: FDE of %s", err, fde.objFile.Filename)
+		}
+		table = append(table, tableEntry{pc: pc, fde: ehFrameAddr + fde.outputOffset})
+	}
+	sort.SliceStable(table, func(i, j int) bool { return table[i].pc < table[j].pc })
+
+	data[0] = 1
+	data[1] = DW_EH_PE_pcrel | DW_EH_PE_sdata4
+	data[2] = DW_EH_PE_udata4
+	data[3] = DW_EH_PE_datarel | DW_EH_PE_sdata4
+	binary.LittleEndian.PutUint32(data[4:], uint32(ehFrameAddr-(hdrAddr+4)))
+	binary.LittleEndian.PutUint32(data[8:], uint32(len(table)))
+	for idx, entry := range table {
+		binary.LittleEndian.PutUint32(data[ehFrameHdrHeaderSize+8*idx:], uint32(entry.pc-hdrAddr))
+		binary.LittleEndian.PutUint32(data[ehFrameHdrHeaderSize+8*idx+4:], uint32(entry.fde-hdrAddr))
+	}
+
+	return nil
+}
+
+func (linker *Linker) ehFrameSegment() []elf.ELF64Phdr {
+	if linker.EhFrame == nil || linker.EhFrame.Header == nil {
+		return nil
+	}
+
+	return []elf.ELF64Phdr{sectionSegment(elf.PT_GNU_EH_FRAME, elf.PF_R, linker.EhFrame.Header)}
+}
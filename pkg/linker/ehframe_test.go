@@ -0,0 +1,103 @@
+package linker
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEhFrame(t *testing.T) {
+	l, err := Link(LinkerInputs{
+		Filenames: []string{
+			"../../data/sample_relocatable_symbols.o",
+			"../../data/sample_relocatable_symbols_defs.o",
+			"../../data/sample_relocatable_unwind_helper.o",
+		},
+		ExecutableName: filepath.Join(t.TempDir(), "a.out"),
+		EhFrameHdr:     true,
+		GCSections:     true,
+		Undefined:      []string{"main", "helper"},
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the three inputs have the same CIE, helper_discarded is collected
+	records, err := parseEhFrame(&elf.ELF64{}, &elf.Section{Data: l.EhFrame.Section.Data})
+	assert.Truef(t, err == nil, "parsing the output failed: %v", err)
+	cies, fdes := 0, 0
+	for _, record := range records {
+		if record.isCIE() {
+			cies++
+		} else {
+			fdes++
+		}
+	}
+	assert.Truef(t, cies == 1, "identical CIEs should be merged got=%d", cies)
+	assert.Truef(t, fdes == 4, "the FDE of helper_discarded should be dropped got=%d", fdes)
+
+	// the FDEs cover the functions of .text
+	ehFrameAddr := l.EhFrame.Section.SectionEntry.ShAddr
+	text := l.Executable.MappedSections[".text"].SectionEntry
+	pcs := map[uint64]uint64{}
+	for _, record := range records {
+		if record.isCIE() {
+			continue
+		}
+		pc, err := readEncodedPointer(l.EhFrame.Section.Data, record.offset+8, DW_EH_PE_pcrel|DW_EH_PE_sdata4, ehFrameAddr+record.offset+8)
+		assert.Truef(t, err == nil, "%v", err)
+		assert.Truef(t, pc >= text.ShAddr && pc < text.ShAddr+text.ShSize, "FDE at 0x%x does not point in .text got=0x%x", record.offset, pc)
+		pcs[ehFrameAddr+record.offset] = pc
+	}
+
+	// the search table is sorted and points to the FDEs
+	hdr := l.EhFrame.Header
+	data := hdr.Data
+	assert.Truef(t, data[0] == 1 && data[1] == DW_EH_PE_pcrel|DW_EH_PE_sdata4 && data[3] == DW_EH_PE_datarel|DW_EH_PE_sdata4, "wrong .eh_frame_hdr encodings")
+	assert.Truef(t, hdr.SectionEntry.ShAddr+4+uint64(int32(binary.LittleEndian.Uint32(data[4:]))) == ehFrameAddr, "wrong eh_frame_ptr")
+	assert.Truef(t, binary.LittleEndian.Uint32(data[8:]) == 4, "wrong fde_count")
+	previous := uint64(0)
+	for idx := 0; idx < 4; idx++ {
+		entry := data[ehFrameHdrHeaderSize+8*idx:]
+		pc := hdr.SectionEntry.ShAddr + uint64(int32(binary.LittleEndian.Uint32(entry)))
+		fde := hdr.SectionEntry.ShAddr + uint64(int32(binary.LittleEndian.Uint32(entry[4:])))
+		assert.Truef(t, pcs[fde] == pc, "table entry %d does not match its FDE", idx)
+		assert.Truef(t, pc > previous, "the table should be sorted")
+		previous = pc
+	}
+
+	found := false
+	for _, phdr := range l.Executable.PhdrEntries {
+		if phdr.Type == elf.PT_GNU_EH_FRAME {
+			found = phdr.Vaddr == hdr.SectionEntry.ShAddr && phdr.MemSz == hdr.SectionEntry.ShSize
+		}
+	}
+	assert.Truef(t, found, "PT_GNU_EH_FRAME should cover .eh_frame_hdr")
+	assert.Truef(t, len(l.Executable.PhdrEntries) == int(l.Executable.Header.PhNum), "PhNum does not match the program headers")
+}
+
+func TestUnwind(t *testing.T) {
+	libgcc := "/lib/x86_64-linux-gnu/libgcc_s.so.1"
+	if _, err := os.Stat(libgcc); err != nil {
+		t.Skipf("%s not found", libgcc)
+	}
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	// _Unwind_Backtrace finds the FDEs through PT_GNU_EH_FRAME, from itself up to _start
+	dir := t.TempDir()
+	_, err := Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_unwind.o", libgcc},
+		ExecutableName: filepath.Join(dir, "a.out"),
+		EhFrameHdr:     true,
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 5*2, "wrong exit code: %v", err)
+}
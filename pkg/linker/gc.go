@@ -0,0 +1,216 @@
+package linker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+// Sections that the program runs without referencing them
+var retainedSectionNames = []string{".init", ".fini", ".init_array", ".fini_array", ".preinit_array", ".ctors", ".dtors"}
+
+func (linker *Linker) forcedSymbols() []string {
+	names := []string{}
+	names = append(names, linker.LinkerInputs.Undefined...)
+	return append(names, linker.LinkerInputs.RequireDefined...)
+}
+
+// Adds the symbols of --undefined and --require-defined as undefined references, so archive
+// members that define them are linked in
+func (linker *Linker) addUndefinedSymbols() {
+	for _, name := range linker.forcedSymbols() {
+		if _, found := linker.Symbols[name]; !found {
+			linker.Symbols[name] = &SymbolRouter{SymbolType: SYM_UNDEF}
+			linker.UndefinedSymbols[name] = struct{}{}
+		}
+	}
+}
+
+func (linker *Linker) checkRequiredSymbols() error {
+	for _, name := range linker.LinkerInputs.RequireDefined {
+		if router := linker.Symbols[name]; router.DefinedSymbol == nil {
+			return fmt.Errorf("%w: %s required by --require-defined", UndefinedSymbolErr, name)
+		}
+	}
+
+	return nil
+}
+
+func isRetainedSection(section *elf.Section) bool {
+	if section.SectionEntry.ShFlags&elf.SHF_GNU_RETAIN != 0 || section.SectionEntry.ShType == elf.SHT_NOTE {
+		return true
+	}
+
+	for _, name := range retainedSectionNames {
+		if section.Name == name || strings.HasPrefix(section.Name, name+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The sections that __start_ and __stop_ symbols of the name delimit
+func boundSectionName(name string) (string, bool) {
+	if section, found := strings.CutPrefix(name, "__start_"); found {
+		return section, true
+	}
+
+	return strings.CutPrefix(name, "__stop_")
+}
+
+type sectionMarker struct {
+	linker *Linker
+	queue  []*MergeUnit
+	// the FDEs of the sections, the sections that they reference (LSDA and personality) are
+	// live if the function is
+	fdes map[*elf.Section][]*ehRecord
+	// the SHF_LINK_ORDER sections that are live if the section they are linked to is
+	dependents map[*elf.Section][]*MergeUnit
+}
+
+func (marker *sectionMarker) mark(objFile *elf.ELF64, section *elf.Section) {
+	if _, live := marker.linker.liveSections[section]; live || marker.linker.isDiscarded(section) {
+		return
+	}
+
+	marker.linker.liveSections[section] = struct{}{}
+	marker.queue = append(marker.queue, &MergeUnit{Section: section, SourceELF: objFile})
+}
+
+// Marks the section of the definition of the symbol, or the sections that a __start_ or __stop_
+// symbol delimits. These do not keep the SHF_LINK_ORDER sections, that follow their linked
+// section.
+func (marker *sectionMarker) markSymbol(name string) {
+	if sectionName, found := boundSectionName(name); found && isCIdentifier(sectionName) {
+		for _, objFile := range marker.linker.InputObjects {
+			for _, section := range objFile.Sections {
+				if section.Name == sectionName && !isLinkOrder(section) {
+					marker.mark(objFile, section)
+				}
+			}
+		}
+	}
+
+	router, found := marker.linker.Symbols[name]
+	if !found || router.DefinedSymbol == nil || router.DefinedSymbol.Elf == nil {
+		return
+	}
+
+	marker.markDefinition(router.DefinedSymbol.Elf, router.DefinedSymbol.Symbol)
+}
+
+func (marker *sectionMarker) markDefinition(objFile *elf.ELF64, symbol *elf.Symbol) {
+	index := symbol.BaseSymbol.StShNdx
+	if index == elf.SHN_UNDEF || symbol.BaseSymbol.IsSpecialSection() || int(index) >= len(objFile.Sections) {
+		return
+	}
+
+	marker.mark(objFile, objFile.Sections[index])
+}
+
+// Section symbols and local symbols reference the sections of their object, the others are
+// resolved by name
+func (marker *sectionMarker) markRelocations(objFile *elf.ELF64, relocations []*elf.Relocation) {
+	for _, relocation := range relocations {
+		symbol := relocation.Symbol
+		if symbol != nil && (isSectionRelocation(relocation) || symbol.IsLocal()) {
+			marker.markDefinition(objFile, symbol)
+		} else {
+			marker.markSymbol(relocation.SymbolName)
+		}
+	}
+}
+
+// With --gc-sections, only the allocated sections that can be reached from the roots through
+// relocations are linked in. The roots are the entry point, the symbols of --undefined and
+// --require-defined, the exported symbols, the sections the program runs without referencing
+// them (constructors, notes, SHF_GNU_RETAIN), and the ones delimited by referenced __start_ and
+// __stop_ symbols.
+func (linker *Linker) markLiveSections() error {
+	if !linker.LinkerInputs.GCSections {
+		return nil
+	}
+
+	if err := linker.readDynamicList(); err != nil {
+		return err
+	}
+
+	linker.liveSections = make(map[*elf.Section]struct{})
+	marker := &sectionMarker{
+		linker:     linker,
+		fdes:       make(map[*elf.Section][]*ehRecord),
+		dependents: make(map[*elf.Section][]*MergeUnit),
+	}
+
+	for _, objFile := range linker.InputObjects {
+		for _, section := range objFile.Sections {
+			if section.Name == ".eh_frame" {
+				// a broken .eh_frame is reported when the output one is built
+				records, _ := parseEhFrame(objFile, section)
+				for _, record := range records {
+					if !record.isCIE() {
+						if fdeSection := linker.fdeSection(record); fdeSection != nil {
+							marker.fdes[fdeSection] = append(marker.fdes[fdeSection], record)
+						}
+					}
+				}
+			}
+
+			if isLinkOrder(section) {
+				if linked := linkedSection(objFile, section); linked != nil {
+					marker.dependents[linked] = append(marker.dependents[linked], &MergeUnit{Section: section, SourceELF: objFile})
+				}
+			} else if section.SectionEntry.ShFlags&elf.SHF_ALLOC != 0 && isRetainedSection(section) {
+				marker.mark(objFile, section)
+			}
+		}
+	}
+
+	if !linker.LinkerInputs.Shared {
+		marker.markSymbol("_start")
+	}
+	for _, name := range linker.forcedSymbols() {
+		marker.markSymbol(name)
+	}
+	for name, router := range linker.Symbols {
+		if linker.isExported(router) && linker.isDynamicExport(name) {
+			marker.markSymbol(name)
+		}
+	}
+
+	for len(marker.queue) != 0 {
+		unit := marker.queue[0]
+		marker.queue = marker.queue[1:]
+
+		marker.markRelocations(unit.SourceELF, unit.Section.Relocations)
+		for _, fde := range marker.fdes[unit.Section] {
+			marker.markRelocations(fde.objFile, fde.relocations)
+			marker.markRelocations(fde.objFile, fde.cie.relocations)
+		}
+		for _, dependent := range marker.dependents[unit.Section] {
+			marker.mark(dependent.SourceELF, dependent.Section)
+		}
+	}
+
+	return nil
+}
+
+// Sections that are not allocated are always kept
+func (linker *Linker) isLive(section *elf.Section) bool {
+	if linker.liveSections == nil || section.SectionEntry.ShFlags&elf.SHF_ALLOC == 0 {
+		return true
+	}
+
+	_, live := linker.liveSections[section]
+	return live
+}
+
+func (linker *Linker) removeSection(objFile *elf.ELF64, section *elf.Section) {
+	linker.RemovedSections = append(linker.RemovedSections, fmt.Sprintf("%s(%s)", objFile.Filename, section.Name))
+	if linker.LinkerInputs.PrintGCSections {
+		log.Infof("removing unused section '%s' in file '%s'", section.Name, objFile.Filename)
+	}
+}
@@ -0,0 +1,91 @@
+package linker
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCSections(t *testing.T) {
+	object := "../../data/sample_relocatable_gc.o"
+	removed := func(l *Linker, section string) bool {
+		return helpers.Find[string](l.RemovedSections, object+"("+section+")") != -1
+	}
+
+	dir := t.TempDir()
+	l, err := Link(LinkerInputs{Filenames: []string{object}, ExecutableName: filepath.Join(dir, "a.out"), GCSections: true, PrintGCSections: true})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	for _, section := range []string{".text.unused_func", ".data.unused_data", ".rodata.unused_string"} {
+		assert.Truef(t, removed(l, section), "%s should be removed got=%v", section, l.RemovedSections)
+	}
+	// reachable from _start, SHF_GNU_RETAIN, and delimited by __start_gc_set
+	for _, section := range []string{".text._start", ".text.helper", ".data.used_data", ".text.retained_func", "gc_set"} {
+		assert.Truef(t, !removed(l, section), "%s should be kept", section)
+	}
+
+	// the function sections are merged in .text
+	_, found := l.Executable.MappedSections[".text.helper"]
+	assert.Truef(t, !found, ".text.helper should be merged in .text")
+	gcSet := l.Executable.MappedSections["gc_set"]
+	assert.Truef(t, gcSet != nil && gcSet.SectionEntry.ShSize == 8, "gc_set should hold both entries")
+	start, _ := l.resolveSymbol("__start_gc_set")
+	stop, _ := l.resolveSymbol("__stop_gc_set")
+	assert.Truef(t, start != nil && stop != nil && l.GetSymbolVirtAddress(stop)-l.GetSymbolVirtAddress(start) == 8, "wrong gc_set bounds")
+
+	// the sum of gc_set plus used_data
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 1+2+7, "wrong exit code: %v", err)
+
+	// --undefined keeps the definition and what it references
+	l, err = Link(LinkerInputs{Filenames: []string{object}, ExecutableName: filepath.Join(dir, "a.out"), GCSections: true, Undefined: []string{"unused_func"}})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	for _, section := range []string{".text.unused_func", ".data.unused_data"} {
+		assert.Truef(t, !removed(l, section), "%s should be kept by --undefined", section)
+	}
+	assert.Truef(t, removed(l, ".rodata.unused_string"), "the folded string should still be removed")
+
+	// shared objects keep their exported definitions
+	l, err = Link(LinkerInputs{Filenames: []string{object}, ExecutableName: filepath.Join(dir, "libgc.so"), GCSections: true, Shared: true})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, !removed(l, ".text.unused_func") && !removed(l, ".data.unused_data"), "exported definitions should be kept")
+
+	l, err = Link(LinkerInputs{Filenames: []string{object}, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, len(l.RemovedSections) == 0, "nothing is removed without --gc-sections")
+}
+
+func TestUndefinedSymbols(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_archmain.o", "../../data/libarchive.a"},
+		ExecutableName: filepath.Join(dir, "a.out"),
+	}
+
+	// --undefined pulls the archive member that defines the symbol
+	inputs.Undefined = []string{"arch_unused"}
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	_, err = l.resolveSymbol("arch_unused")
+	assert.Truef(t, err == nil, "arch_unused should be linked in")
+
+	inputs.Undefined = nil
+	inputs.RequireDefined = []string{"arch_unused"}
+	_, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	inputs.RequireDefined = []string{"missing"}
+	_, err = Link(inputs)
+	assert.Truef(t, errors.Is(err, UndefinedSymbolErr), "--require-defined of an undefined symbol should fail got=%v", err)
+
+	// an undefined --undefined symbol is not an error
+	inputs.RequireDefined = nil
+	inputs.Undefined = []string{"missing"}
+	_, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+}
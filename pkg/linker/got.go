@@ -0,0 +1,128 @@
+package linker
+
+import (
+	"encoding/binary"
+
+	"github.com/andreistan26/golink/pkg/elf"
+)
+
+type GOTEntryKind uint32
+
+const (
+	// address of the symbol
+	GOT_SYMBOL GOTEntryKind = iota
+	// module id and offset in its TLS block, passed to __tls_get_addr
+	GOT_TLS_GD
+	// module id pair shared by all the Local Dynamic accesses of the output
+	GOT_TLS_LD
+	// offset of the variable from the thread pointer, Initial Exec
+	GOT_TLS_IE
+	// TLS descriptor, resolver function and its argument
+	GOT_TLS_DESC
+)
+
+type GOTEntry struct {
+	Kind GOTEntryKind
+	// symbol the entry was allocated for, empty for GOT_TLS_LD
+	SymbolName string
+	// offset of the entry in .got
+	Offset uint64
+}
+
+func (entry *GOTEntry) Size() uint64 {
+	switch entry.Kind {
+	case GOT_TLS_GD, GOT_TLS_LD, GOT_TLS_DESC:
+		return 16
+	}
+
+	return 8
+}
+
+type gotKey struct {
+	kind       GOTEntryKind
+	symbolName string
+}
+
+// The GOT is allocated while scanning the relocations, before the layout of the output,
+// its content is written once the addresses of the symbols are known
+type GlobalOffsetTable struct {
+	Section *elf.Section
+	Entries []*GOTEntry
+
+	mappedEntries map[gotKey]*GOTEntry
+}
+
+func (linker *Linker) got() *GlobalOffsetTable {
+	if linker.GOT == nil {
+		linker.GOT = &GlobalOffsetTable{
+			Section:       linker.addSyntheticSection(".got", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_WRITE, 8, 8),
+			Entries:       []*GOTEntry{},
+			mappedEntries: make(map[gotKey]*GOTEntry),
+		}
+	}
+
+	return linker.GOT
+}
+
+// Returns the entry of kind for the symbol, the second value is true if it was just allocated
+func (got *GlobalOffsetTable) Allocate(kind GOTEntryKind, symbolName string) (*GOTEntry, bool) {
+	key := gotKey{kind: kind, symbolName: symbolName}
+	if entry, found := got.mappedEntries[key]; found {
+		return entry, false
+	}
+
+	entry := &GOTEntry{
+		Kind:       kind,
+		SymbolName: symbolName,
+		Offset:     uint64(len(got.Section.Data)),
+	}
+
+	got.Section.Data = append(got.Section.Data, make([]byte, entry.Size())...)
+	got.Section.SectionEntry.ShSize = uint64(len(got.Section.Data))
+	got.Entries = append(got.Entries, entry)
+	got.mappedEntries[key] = entry
+
+	return entry, true
+}
+
+func (got *GlobalOffsetTable) Find(kind GOTEntryKind, symbolName string) *GOTEntry {
+	return got.mappedEntries[gotKey{kind: kind, symbolName: symbolName}]
+}
+
+// Writes the entries whose value is known at link time, the rest is filled by dynamic relocations
+func (linker *Linker) fillGOT() error {
+	if linker.GOT == nil {
+		return nil
+	}
+
+	for _, entry := range linker.GOT.Entries {
+		switch entry.Kind {
+		case GOT_SYMBOL:
+			// imported symbols are filled by R_X86_64_GLOB_DAT and indirect functions by fillIPLT
+			if linker.isImported(entry.SymbolName) || linker.isIFunc(entry.SymbolName) {
+				continue
+			}
+
+			S, err := linker.symbolAddress(entry.SymbolName)
+			if err != nil {
+				return err
+			}
+
+			binary.LittleEndian.PutUint64(linker.GOT.Section.Data[entry.Offset:], S)
+		case GOT_TLS_GD:
+			if linker.isPreemptible(entry.SymbolName) {
+				continue
+			}
+
+			symbol, err := linker.resolveSymbol(entry.SymbolName)
+			if err != nil {
+				return err
+			}
+
+			binary.LittleEndian.PutUint64(linker.GOT.Section.Data[entry.Offset+8:],
+				linker.GetSymbolVirtAddress(symbol)-linker.TLS.Vaddr)
+		}
+	}
+
+	return nil
+}
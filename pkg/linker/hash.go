@@ -0,0 +1,179 @@
+package linker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	HASH_STYLE_SYSV = "sysv"
+	HASH_STYLE_GNU  = "gnu"
+	HASH_STYLE_BOTH = "both"
+)
+
+var InvalidHashStyleErr = errors.New("Invalid hash style")
+
+// The dynamic loader looks up the symbols of a module through its hash table. The SysV table
+// is made of nbucket and nchain, the buckets holding the first symbol index of each hash
+// value, and the chains linking the symbols that share a bucket.
+func sysvHash(name string) uint32 {
+	h := uint32(0)
+	for _, c := range []byte(name) {
+		h = (h << 4) + uint32(c)
+		g := h & 0xf0000000
+		if g != 0 {
+			h ^= g >> 24
+		}
+		h &^= g
+	}
+
+	return h
+}
+
+func sysvBucketCount(symbolCount int) int {
+	if symbolCount < 3 {
+		return 1
+	}
+
+	return symbolCount / 2
+}
+
+func sysvHashSize(symbolCount int) int {
+	return 4 * (2 + sysvBucketCount(symbolCount) + symbolCount)
+}
+
+// Writes the table of the .dynsym names, the null symbol included
+func fillSysvHash(data []byte, names []string) {
+	nbucket := sysvBucketCount(len(names))
+	buckets := data[8:]
+	chains := data[8+4*nbucket:]
+
+	binary.LittleEndian.PutUint32(data, uint32(nbucket))
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(names)))
+
+	for idx := len(names) - 1; idx > 0; idx-- {
+		bucket := buckets[4*(sysvHash(names[idx])%uint32(nbucket)):]
+		binary.LittleEndian.PutUint32(chains[4*idx:], binary.LittleEndian.Uint32(bucket))
+		binary.LittleEndian.PutUint32(bucket, uint32(idx))
+	}
+}
+
+// The GNU table only covers the symbols defined by the module, which have to come last in
+// .dynsym grouped by bucket. A bloom filter rejects most of the names that are not defined
+// before the buckets are looked at, the chains hold the hashes of the symbols so that the
+// names only have to be compared when the hashes match.
+func gnuHash(name string) uint32 {
+	h := uint32(5381)
+	for _, c := range []byte(name) {
+		h = h*33 + uint32(c)
+	}
+
+	return h
+}
+
+// the second hash of the bloom filter is the GNU hash shifted by gnuBloomShift
+const gnuBloomShift = 26
+
+func gnuBucketCount(symbolCount int) int {
+	if symbolCount < 4 {
+		return 1
+	}
+
+	return symbolCount / 4
+}
+
+// About 12 bits per symbol, the number of 64 bit words has to be a power of 2
+func gnuBloomWords(symbolCount int) int {
+	words := 1
+	for words*64 < symbolCount*12 {
+		words *= 2
+	}
+
+	return words
+}
+
+func gnuHashSize(symbolCount int) int {
+	return 16 + 8*gnuBloomWords(symbolCount) + 4*gnuBucketCount(symbolCount) + 4*symbolCount
+}
+
+// Writes the table of the defined symbols, they follow symbolOffset symbols in .dynsym and
+// are already ordered by bucket
+func fillGNUHash(data []byte, names []string, symbolOffset int) {
+	nbucket := gnuBucketCount(len(names))
+	nbloom := gnuBloomWords(len(names))
+	bloom := data[16:]
+	buckets := bloom[8*nbloom:]
+	chains := buckets[4*nbucket:]
+
+	binary.LittleEndian.PutUint32(data, uint32(nbucket))
+	binary.LittleEndian.PutUint32(data[4:], uint32(symbolOffset))
+	binary.LittleEndian.PutUint32(data[8:], uint32(nbloom))
+	binary.LittleEndian.PutUint32(data[12:], gnuBloomShift)
+
+	for idx, name := range names {
+		h := gnuHash(name)
+
+		word := bloom[8*((h/64)%uint32(nbloom)):]
+		bits := binary.LittleEndian.Uint64(word) | 1<<(h%64) | 1<<((h>>gnuBloomShift)%64)
+		binary.LittleEndian.PutUint64(word, bits)
+
+		bucket := buckets[4*(h%uint32(nbucket)):]
+		if binary.LittleEndian.Uint32(bucket) == 0 {
+			binary.LittleEndian.PutUint32(bucket, uint32(symbolOffset+idx))
+		}
+
+		// the lowest bit marks the last symbol of a bucket
+		value := h &^ 1
+		if idx == len(names)-1 || gnuHash(names[idx+1])%uint32(nbucket) != h%uint32(nbucket) {
+			value |= 1
+		}
+		binary.LittleEndian.PutUint32(chains[4*idx:], value)
+	}
+}
+
+// Checks the --hash-style value, an empty one emits both tables
+func checkHashStyle(style string) error {
+	switch style {
+	case "", HASH_STYLE_SYSV, HASH_STYLE_GNU, HASH_STYLE_BOTH:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", InvalidHashStyleErr, style)
+}
+
+func (linker *Linker) sysvHashTable() bool {
+	return linker.LinkerInputs.HashStyle != HASH_STYLE_GNU
+}
+
+func (linker *Linker) gnuHashTable() bool {
+	return linker.LinkerInputs.HashStyle != HASH_STYLE_SYSV
+}
+
+// The symbols defined by the output are hashed by the GNU table, the functions with a canonical
+// PLT entry too as the other modules are bound to the entry
+func (linker *Linker) isDefinedDynamicSymbol(name string) bool {
+	router, found := linker.Symbols[name]
+	return found && router.DefinedSymbol != nil || linker.isCanonicalPLTEntry(name)
+}
+
+// Moves the defined symbols after the undefined ones and groups them by GNU hash bucket, the
+// dynamic symbol indices are only used once the layout is done
+func (linker *Linker) sortDynamicSymbols() {
+	undefined, defined := []string{}, []string{}
+	for _, name := range linker.DynamicSymbols {
+		if linker.isDefinedDynamicSymbol(name) {
+			defined = append(defined, name)
+		} else {
+			undefined = append(undefined, name)
+		}
+	}
+
+	nbucket := uint32(gnuBucketCount(len(defined)))
+	sort.SliceStable(defined, func(i, j int) bool {
+		return gnuHash(unversionedName(defined[i]))%nbucket < gnuHash(unversionedName(defined[j]))%nbucket
+	})
+
+	linker.DynamicSymbols = append(undefined, defined...)
+}
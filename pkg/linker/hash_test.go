@@ -0,0 +1,154 @@
+package linker
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+// The name of a .dynsym entry
+func dynamicSymbolName(l *Linker, idx uint32) string {
+	dynamic := l.Dynamic
+	offset := binary.LittleEndian.Uint32(dynamic.DynSym.Data[0x18*idx:])
+	name := string(dynamic.DynStr.Data[offset:])
+	return name[:strings.IndexByte(name, 0)]
+}
+
+// Looks the name up like the dynamic loader does with DT_HASH
+func lookupSysvHash(l *Linker, name string) uint32 {
+	data := l.Dynamic.Hash.Data
+	nbucket := binary.LittleEndian.Uint32(data)
+	chains := data[8+4*nbucket:]
+
+	idx := binary.LittleEndian.Uint32(data[8+4*(sysvHash(name)%nbucket):])
+	for ; idx != 0; idx = binary.LittleEndian.Uint32(chains[4*idx:]) {
+		if dynamicSymbolName(l, idx) == name {
+			return idx
+		}
+	}
+
+	return 0
+}
+
+// Looks the name up like the dynamic loader does with DT_GNU_HASH
+func lookupGNUHash(l *Linker, name string) uint32 {
+	data := l.Dynamic.GNUHash.Data
+	nbucket := binary.LittleEndian.Uint32(data)
+	symbolOffset := binary.LittleEndian.Uint32(data[4:])
+	nbloom := binary.LittleEndian.Uint32(data[8:])
+	shift := binary.LittleEndian.Uint32(data[12:])
+	buckets := data[16+8*nbloom:]
+	chains := buckets[4*nbucket:]
+
+	h := gnuHash(name)
+	word := binary.LittleEndian.Uint64(data[16+8*((h/64)%nbloom):])
+	if word>>(h%64)&1 == 0 || word>>((h>>shift)%64)&1 == 0 {
+		return 0
+	}
+
+	idx := binary.LittleEndian.Uint32(buckets[4*(h%nbucket):])
+	if idx == 0 {
+		return 0
+	}
+
+	for ; ; idx++ {
+		value := binary.LittleEndian.Uint32(chains[4*(idx-symbolOffset):])
+		if value|1 == h|1 && dynamicSymbolName(l, idx) == name {
+			return idx
+		}
+		if value&1 != 0 {
+			return 0
+		}
+	}
+}
+
+func TestHashTables(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_libmine.o"},
+		ExecutableName: filepath.Join(dir, "libmine.so"),
+		Shared:         true,
+	}
+
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.Dynamic.Hash != nil && l.Dynamic.GNUHash != nil, "both tables are emitted by default")
+
+	for idx, name := range l.DynamicSymbols {
+		assert.Truef(t, lookupSysvHash(l, name) == uint32(idx+1), "%s not found through .hash", name)
+		assert.Truef(t, lookupGNUHash(l, name) == uint32(idx+1), "%s not found through .gnu.hash", name)
+	}
+	for _, name := range []string{"internal", "missing", ""} {
+		assert.Truef(t, lookupSysvHash(l, name) == 0, "%s should not be found through .hash", name)
+		assert.Truef(t, lookupGNUHash(l, name) == 0, "%s should not be found through .gnu.hash", name)
+	}
+
+	inputs.HashStyle = HASH_STYLE_GNU
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.Dynamic.Hash == nil && l.Dynamic.GNUHash != nil, "only .gnu.hash should be emitted")
+
+	inputs.HashStyle = HASH_STYLE_SYSV
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, l.Dynamic.Hash != nil && l.Dynamic.GNUHash == nil, "only .hash should be emitted")
+
+	inputs.HashStyle = "md5"
+	_, err = Link(inputs)
+	assert.ErrorIs(t, err, InvalidHashStyleErr)
+}
+
+func TestGNUHashSymbolOrder(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_callback_main.o",
+		"../../data/sample_shared_lib_callback.so",
+	}
+
+	l, err := Link(LinkerInputs{
+		Filenames:      filenames,
+		ExecutableName: filepath.Join(dir, "a.out"),
+		ExportDynamic:  true,
+		HashStyle:      HASH_STYLE_GNU,
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the imported symbols come first, they are not in the table
+	symbolOffset := binary.LittleEndian.Uint32(l.Dynamic.GNUHash.Data[4:])
+	assert.Truef(t, l.dynamicSymbolIndex("call_back") < symbolOffset, "call_back should precede the definitions")
+	assert.Truef(t, lookupGNUHash(l, "call_back") == 0, "call_back is not defined")
+
+	nbucket := binary.LittleEndian.Uint32(l.Dynamic.GNUHash.Data)
+	previous := uint32(0)
+	for idx := symbolOffset; idx <= uint32(len(l.DynamicSymbols)); idx++ {
+		name := dynamicSymbolName(l, idx)
+		bucket := gnuHash(name) % nbucket
+		assert.Truef(t, bucket >= previous, "the definitions should be ordered by bucket")
+		previous = bucket
+		assert.Truef(t, lookupGNUHash(l, name) == idx, "%s not found through .gnu.hash", name)
+	}
+
+	for _, entry := range l.Dynamic.Entries {
+		assert.Truef(t, entry.Tag != elf.DT_HASH, "DT_HASH should not be emitted")
+	}
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile(filenames[1])
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libcallback.so"), library, 0755) == nil, "writing the library failed")
+
+	// the library binds exe_callback through the table of the executable
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 6, "wrong exit code: %v", err)
+}
@@ -0,0 +1,255 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+const (
+	ICF_NONE = "none"
+	ICF_SAFE = "safe"
+	ICF_ALL  = "all"
+)
+
+var (
+	InvalidICFErr     = errors.New("Invalid --icf mode")
+	InvalidAddrsigErr = errors.New("Invalid .llvm_addrsig")
+)
+
+func checkICF(mode string) error {
+	switch mode {
+	case "", ICF_NONE, ICF_SAFE, ICF_ALL:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", InvalidICFErr, mode)
+}
+
+// Read-only sections of .text and .rodata, the ones delimited by __start_ and __stop_ symbols
+// or run without being referenced are kept as they are. The contents of SHF_MERGE sections are
+// deduplicated anyway.
+func (linker *Linker) isFoldable(section *elf.Section) bool {
+	entry := section.SectionEntry
+	if entry.ShType != elf.SHT_PROGBITS || entry.ShSize == 0 ||
+		entry.ShFlags&elf.SHF_ALLOC == 0 || entry.ShFlags&(elf.SHF_WRITE|elf.SHF_TLS|elf.SHF_MERGE) != 0 {
+		return false
+	}
+
+	name, _ := outputSectionName(section)
+	return (name == ".text" || name == ".rodata") && !isRetainedSection(section) && linker.isLive(section) && !linker.isDiscarded(section)
+}
+
+// The input section and the offset in it that the relocation points to, nil if the symbol is
+// not defined by an input object. In a shared object the global symbols can be interposed, so
+// they are compared by name.
+func (linker *Linker) relocationTarget(objFile *elf.ELF64, relocation *elf.Relocation) (*elf.Section, uint64) {
+	symbol := relocation.Symbol
+	if symbol == nil {
+		return nil, 0
+	}
+
+	if !isSectionRelocation(relocation) && !symbol.IsLocal() {
+		router, found := linker.Symbols[relocation.SymbolName]
+		if linker.LinkerInputs.Shared || !found || router.DefinedSymbol == nil || router.DefinedSymbol.Elf == nil {
+			return nil, 0
+		}
+		symbol, objFile = router.DefinedSymbol.Symbol, router.DefinedSymbol.Elf
+	}
+
+	index := symbol.BaseSymbol.StShNdx
+	if index == elf.SHN_UNDEF || symbol.BaseSymbol.IsSpecialSection() || int(index) >= len(objFile.Sections) {
+		return nil, 0
+	}
+
+	return objFile.Sections[index], symbol.BaseSymbol.StValue
+}
+
+// The sections whose address is compared by the program, that --icf=safe does not fold: the
+// ones that define a symbol listed in .llvm_addrsig or an exported symbol. Without
+// .llvm_addrsig all the sections of the object are.
+func (linker *Linker) addressSignificantSections() (map[*elf.Section]struct{}, error) {
+	significant := make(map[*elf.Section]struct{})
+	markSymbol := func(objFile *elf.ELF64, symbol *elf.Symbol) {
+		index := symbol.BaseSymbol.StShNdx
+		if index != elf.SHN_UNDEF && !symbol.BaseSymbol.IsSpecialSection() && int(index) < len(objFile.Sections) {
+			significant[objFile.Sections[index]] = struct{}{}
+		}
+	}
+
+	for _, objFile := range linker.InputObjects {
+		var addrsig *elf.Section
+		for _, section := range objFile.Sections {
+			if section.SectionEntry.ShType == elf.SHT_LLVM_ADDRSIG {
+				addrsig = section
+			}
+		}
+
+		if addrsig == nil {
+			for _, section := range objFile.Sections {
+				significant[section] = struct{}{}
+			}
+			continue
+		}
+
+		for offset := uint64(0); offset < uint64(len(addrsig.Data)); {
+			var index uint64
+			index, offset = readULEB128(addrsig.Data, offset)
+			if index >= uint64(len(objFile.Symbols)) {
+				return nil, fmt.Errorf("%w: symbol %d in %s", InvalidAddrsigErr, index, objFile.Filename)
+			}
+
+			symbol := objFile.Symbols[index]
+			if router, found := linker.Symbols[symbol.Name]; found && !symbol.IsLocal() && router.DefinedSymbol != nil && router.DefinedSymbol.Elf != nil {
+				markSymbol(router.DefinedSymbol.Elf, router.DefinedSymbol.Symbol)
+			} else {
+				markSymbol(objFile, symbol)
+			}
+		}
+	}
+
+	if err := linker.readDynamicList(); err != nil {
+		return nil, err
+	}
+	for name, router := range linker.Symbols {
+		if linker.isExported(router) && linker.isDynamicExport(name) {
+			markSymbol(router.DefinedSymbol.Elf, router.DefinedSymbol.Symbol)
+		}
+	}
+
+	return significant, nil
+}
+
+type foldCandidate struct {
+	section *elf.Section
+	objFile *elf.ELF64
+}
+
+func (candidate *foldCandidate) String() string {
+	return fmt.Sprintf("%s(%s)", candidate.objFile.Filename, candidate.section.Name)
+}
+
+// The part of the key of a section that does not depend on the other candidates: the flags,
+// the contents and the relocations without their targets
+func contentsKey(section *elf.Section) string {
+	var key strings.Builder
+	name, _ := outputSectionName(section)
+	entry := section.SectionEntry
+	fmt.Fprintf(&key, "%s %x %x %x %d:", name, entry.ShType, entry.ShFlags, entry.ShAddrAlign, len(section.Relocations))
+	key.Write(section.Data)
+	for _, relocation := range section.Relocations {
+		fmt.Fprintf(&key, " %x %x %x", relocation.Offset, relocation.GetType(), relocation.Addend)
+	}
+
+	return key.String()
+}
+
+// With --icf, the identical sections are folded in the first of them. Sections are identical
+// when their flags, contents and relocations are, and the relocations point to the same place,
+// or to the same offset of identical sections. The candidates are first grouped by contents,
+// then the groups are split by the groups of their relocation targets until none changes, so
+// mutually recursive functions are folded too. The symbols of a folded section are moved to
+// the section it is folded in.
+func (linker *Linker) foldIdenticalSections() error {
+	mode := linker.LinkerInputs.ICF
+	if mode == "" || mode == ICF_NONE {
+		return nil
+	}
+
+	var significant map[*elf.Section]struct{}
+	if mode == ICF_SAFE {
+		var err error
+		if significant, err = linker.addressSignificantSections(); err != nil {
+			return err
+		}
+	}
+
+	candidates := []*foldCandidate{}
+	classes := make(map[*elf.Section]int)
+	keys := make(map[string]int)
+	for _, objFile := range linker.InputObjects {
+		for _, section := range objFile.Sections {
+			if _, found := significant[section]; found || !linker.isFoldable(section) {
+				continue
+			}
+
+			key := contentsKey(section)
+			if _, found := keys[key]; !found {
+				keys[key] = len(keys)
+			}
+			classes[section] = keys[key]
+			candidates = append(candidates, &foldCandidate{section: section, objFile: objFile})
+		}
+	}
+
+	for count := len(keys); ; {
+		next := make(map[*elf.Section]int)
+		keys = make(map[string]int)
+		for _, candidate := range candidates {
+			var key strings.Builder
+			fmt.Fprintf(&key, "%d", classes[candidate.section])
+			for _, relocation := range candidate.section.Relocations {
+				target, offset := linker.relocationTarget(candidate.objFile, relocation)
+				if class, found := classes[target]; found {
+					fmt.Fprintf(&key, " c%d+%x", class, offset)
+				} else if target != nil {
+					fmt.Fprintf(&key, " s%p+%x", target, offset)
+				} else {
+					fmt.Fprintf(&key, " n%s", relocation.SymbolName)
+				}
+			}
+
+			if _, found := keys[key.String()]; !found {
+				keys[key.String()] = len(keys)
+			}
+			next[candidate.section] = keys[key.String()]
+		}
+
+		classes = next
+		if len(keys) == count {
+			break
+		}
+		count = len(keys)
+	}
+
+	leaders := make(map[int]*foldCandidate)
+	for _, candidate := range candidates {
+		leader, found := leaders[classes[candidate.section]]
+		if !found {
+			leaders[classes[candidate.section]] = candidate
+			continue
+		}
+
+		linker.foldSection(candidate, leader)
+	}
+
+	return nil
+}
+
+func (linker *Linker) foldSection(candidate *foldCandidate, leader *foldCandidate) {
+	if linker.FoldedSections == nil {
+		linker.FoldedSections = make(map[string]string)
+	}
+
+	linker.foldedSections[candidate.section] = leader.section
+	linker.FoldedSections[candidate.String()] = leader.String()
+
+	symbols := linker.SectionDefinedSymbols[candidate.section.SectionEntry]
+	delete(linker.SectionDefinedSymbols, candidate.section.SectionEntry)
+	for _, symbol := range symbols {
+		linker.addSectionDefinedSymbol(symbol, leader.section.SectionEntry)
+	}
+
+	if linker.LinkerInputs.PrintICFSections {
+		log.Infof("folding identical section '%s' in file '%s' into '%s' in file '%s'",
+			candidate.section.Name, candidate.objFile.Filename, leader.section.Name, leader.objFile.Filename)
+	}
+}
+
+func (linker *Linker) isFolded(section *elf.Section) bool {
+	_, found := linker.foldedSections[section]
+	return found
+}
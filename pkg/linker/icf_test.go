@@ -0,0 +1,62 @@
+package linker
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICF(t *testing.T) {
+	object := "../../data/sample_relocatable_icf.o"
+	section := func(name string) string {
+		return object + "(" + name + ")"
+	}
+	link := func(mode string, objects ...string) *Linker {
+		dir := t.TempDir()
+		l, err := Link(LinkerInputs{Filenames: objects, ExecutableName: filepath.Join(dir, "a.out"), ICF: mode, PrintICFSections: true})
+		assert.Truef(t, err == nil, "%s: link failed: %v", mode, err)
+
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		err = cmd.Run()
+		assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 17, "%s: wrong exit code: %v", mode, err)
+		return l
+	}
+	address := func(l *Linker, name string) uint64 {
+		symbol, err := l.resolveSymbol(name)
+		assert.Truef(t, err == nil, "%s should be defined", name)
+		return l.GetSymbolVirtAddress(symbol)
+	}
+
+	// add_c is listed in .llvm_addrsig
+	l := link(ICF_SAFE, object)
+	assert.Truef(t, l.FoldedSections[section(".text.add_b")] == section(".text.add_a"), "add_b should be folded in add_a got=%v", l.FoldedSections)
+	assert.Truef(t, l.FoldedSections[section(".rodata.msg_a")] == section(".rodata.msg_b"), "msg_a should be folded in msg_b")
+	_, found := l.FoldedSections[section(".text.add_c")]
+	assert.Truef(t, !found, "the address of add_c is taken")
+	assert.Truef(t, address(l, "add_a") == address(l, "add_b") && address(l, "add_a") != address(l, "add_c"), "wrong addresses")
+
+	// the mutually recursive functions are identical pair by pair
+	assert.Truef(t, l.FoldedSections[section(".text.even_b")] == section(".text.even_a"), "even_b should be folded in even_a")
+	assert.Truef(t, l.FoldedSections[section(".text.odd_b")] == section(".text.odd_a"), "odd_b should be folded in odd_a")
+	assert.Truef(t, address(l, "even_b") == address(l, "even_a") && address(l, "odd_b") == address(l, "odd_a"), "wrong addresses")
+	_, found = l.FoldedSections[section(".text.mul3")]
+	assert.Truef(t, !found && address(l, "mul2") != address(l, "mul3"), "different contents should not be folded")
+	assert.Truef(t, len(l.FoldedSections) == 4, "wrong folded sections got=%v", l.FoldedSections)
+
+	l = link(ICF_ALL, object)
+	assert.Truef(t, len(l.FoldedSections) == 5, "wrong folded sections got=%v", l.FoldedSections)
+	assert.Truef(t, address(l, "add_a") == address(l, "add_c") && address(l, "add_b") == address(l, "add_c"), "add_c should be folded too")
+
+	// without .llvm_addrsig all the sections of the object are address significant
+	l = link(ICF_SAFE, "../../data/sample_relocatable_icf_noaddrsig.o")
+	assert.Truef(t, len(l.FoldedSections) == 0, "nothing should be folded got=%v", l.FoldedSections)
+
+	l = link(ICF_NONE, object)
+	assert.Truef(t, len(l.FoldedSections) == 0, "nothing should be folded without --icf")
+
+	_, err := Link(LinkerInputs{Filenames: []string{object}, ExecutableName: filepath.Join(t.TempDir(), "a.out"), ICF: "some"})
+	assert.Truef(t, errors.Is(err, InvalidICFErr), "wrong error got=%v", err)
+}
@@ -0,0 +1,159 @@
+package linker
+
+import (
+	"encoding/binary"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/helpers"
+)
+
+const ipltEntrySize = 16
+
+// Indirect functions of a static executable are called through IPLT stubs that jump through
+// a GOT slot. There is no dynamic loader to fill the slots, the C runtime runs the resolver of
+// each R_X86_64_IRELATIVE relocation between __rela_iplt_start and __rela_iplt_end at startup.
+// In a dynamically linked executable the IRELATIVE relocations are in .rela.dyn instead.
+type IPLT struct {
+	Section     *elf.Section
+	RelaSection *elf.Section
+	Entries     []*IPLTEntry
+
+	mappedEntries map[string]*IPLTEntry
+	relaEnd       *elf.Symbol
+}
+
+type IPLTEntry struct {
+	SymbolName string
+	// offset of the stub in .iplt
+	Offset   uint64
+	GOTEntry *GOTEntry
+}
+
+func (linker *Linker) iplt() *IPLT {
+	if linker.IPLT == nil {
+		linker.IPLT = &IPLT{
+			Section:       linker.addSyntheticSection(".iplt", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_EXECINSTR, 16, ipltEntrySize),
+			Entries:       []*IPLTEntry{},
+			mappedEntries: make(map[string]*IPLTEntry),
+		}
+
+		if !linker.isDynamic() {
+			linker.IPLT.RelaSection = linker.addSyntheticSection(".rela.iplt", elf.SHT_RELA, elf.SHF_ALLOC|elf.SHF_INFO_LINK, 8, 0x18)
+		}
+	}
+
+	return linker.IPLT
+}
+
+func (linker *Linker) isIFunc(name string) bool {
+	router, found := linker.Symbols[name]
+	return found && router.DefinedSymbol != nil &&
+		router.DefinedSymbol.Symbol.BaseSymbol.GetType() == elf.STT_GNU_IFUNC
+}
+
+// Allocates the stub, the GOT slot and the IRELATIVE relocation of an indirect function
+func (linker *Linker) allocateIPLTEntry(name string) *IPLTEntry {
+	iplt := linker.iplt()
+	if entry, found := iplt.mappedEntries[name]; found {
+		return entry
+	}
+
+	gotEntry, _ := linker.got().Allocate(GOT_SYMBOL, name)
+	entry := &IPLTEntry{
+		SymbolName: name,
+		Offset:     uint64(len(iplt.Section.Data)),
+		GOTEntry:   gotEntry,
+	}
+
+	iplt.Section.Data = append(iplt.Section.Data, make([]byte, ipltEntrySize)...)
+	iplt.Section.SectionEntry.ShSize = uint64(len(iplt.Section.Data))
+
+	if iplt.RelaSection == nil {
+		linker.addDynamicRelocation(&DynamicRelocation{
+			Section: linker.GOT.Section, Offset: gotEntry.Offset, Type: elf.R_X86_64_IRELATIVE, AddendSymbol: name,
+		})
+	} else {
+		iplt.RelaSection.Data = append(iplt.RelaSection.Data, make([]byte, 0x18)...)
+		iplt.RelaSection.SectionEntry.ShSize = uint64(len(iplt.RelaSection.Data))
+	}
+
+	if iplt.relaEnd != nil {
+		iplt.relaEnd.BaseSymbol.StValue = iplt.RelaSection.SectionEntry.ShSize
+	}
+
+	iplt.Entries = append(iplt.Entries, entry)
+	iplt.mappedEntries[name] = entry
+
+	return entry
+}
+
+// The C runtime of a static executable references these even if there is no indirect function
+func (linker *Linker) defineIRelativeSymbols() {
+	if !linker.isReferenced("__rela_iplt_start") && !linker.isReferenced("__rela_iplt_end") {
+		return
+	}
+
+	iplt := linker.iplt()
+	linker.defineSyntheticSymbol("__rela_iplt_start", iplt.RelaSection, 0, elf.STT_NOTYPE)
+	iplt.relaEnd = linker.defineSyntheticSymbol("__rela_iplt_end", iplt.RelaSection, iplt.RelaSection.SectionEntry.ShSize, elf.STT_NOTYPE)
+}
+
+// Calls and address references to an indirect function use its stub
+func (linker *Linker) ipltStubAddress(name string) (uint64, bool) {
+	if linker.IPLT == nil {
+		return 0, false
+	}
+
+	entry, found := linker.IPLT.mappedEntries[name]
+	if !found {
+		return 0, false
+	}
+
+	return linker.GetSectionVirtAddress(linker.IPLT.Section) + entry.Offset, true
+}
+
+// Writes the stubs and the IRELATIVE relocations once the layout is done
+func (linker *Linker) fillIPLT() error {
+	if linker.IPLT == nil {
+		return nil
+	}
+
+	if len(linker.IPLT.Entries) == 0 {
+		return nil
+	}
+
+	ipltAddr := linker.GetSectionVirtAddress(linker.IPLT.Section)
+	gotAddr := linker.GetSectionVirtAddress(linker.GOT.Section)
+	if linker.IPLT.RelaSection != nil {
+		linker.IPLT.RelaSection.SectionEntry.ShInfo = uint32(helpers.Find[*elf.Section](linker.Executable.Sections, linker.GOT.Section))
+	}
+
+	for idx, entry := range linker.IPLT.Entries {
+		symbol, err := linker.resolveSymbol(entry.SymbolName)
+		if err != nil {
+			return err
+		}
+
+		resolver := linker.GetSymbolVirtAddress(symbol)
+		slot := gotAddr + entry.GOTEntry.Offset
+
+		// jmp *slot(%rip), padded with int3
+		stub := linker.IPLT.Section.Data[entry.Offset : entry.Offset+ipltEntrySize]
+		copy(stub, []byte{0xff, 0x25, 0, 0, 0, 0, 0xcc, 0xcc, 0xcc, 0xcc, 0xcc, 0xcc, 0xcc, 0xcc, 0xcc, 0xcc})
+		binary.LittleEndian.PutUint32(stub[2:], uint32(slot-(ipltAddr+entry.Offset+6)))
+
+		// the slot holds the resolver until the relocation is processed
+		binary.LittleEndian.PutUint64(linker.GOT.Section.Data[entry.GOTEntry.Offset:], resolver)
+
+		if linker.IPLT.RelaSection == nil {
+			continue
+		}
+
+		rela := linker.IPLT.RelaSection.Data[idx*0x18:]
+		binary.LittleEndian.PutUint64(rela, slot)
+		binary.LittleEndian.PutUint64(rela[0x8:], elf.R_X86_64_IRELATIVE)
+		binary.LittleEndian.PutUint64(rela[0x10:], resolver)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package linker
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIFuncStatic(t *testing.T) {
+	filenames := []string{
+		"../../data/sample_relocatable_ifunc.o",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(t.TempDir(), "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	assert.Truef(t, l.IPLT != nil && len(l.IPLT.Entries) == 1, "f should have an IPLT entry")
+	entry := l.IPLT.Entries[0]
+	stub, _ := l.ipltStubAddress("f")
+	slot := l.GetSectionVirtAddress(l.GOT.Section) + entry.GOTEntry.Offset
+	resolver := l.GetSymbolVirtAddress(l.Symbols["f"].DefinedSymbol.Symbol)
+
+	// the stub jumps through the GOT slot
+	stubData := l.IPLT.Section.Data[entry.Offset:]
+	assert.Truef(t, stubData[0] == 0xff && stubData[1] == 0x25, "stub should be an indirect jmp")
+	assert.Truef(t, binary.LittleEndian.Uint32(stubData[2:]) == uint32(slot-(stub+6)), "stub does not jump through the GOT slot")
+
+	rela := l.IPLT.RelaSection.Data
+	assert.Truef(t, len(rela) == 0x18, "wrong .rela.iplt size got=%d", len(rela))
+	assert.Truef(t, binary.LittleEndian.Uint64(rela) == slot, "IRELATIVE should relocate the GOT slot")
+	assert.Truef(t, binary.LittleEndian.Uint64(rela[0x8:]) == elf.R_X86_64_IRELATIVE, "wrong relocation type")
+	assert.Truef(t, binary.LittleEndian.Uint64(rela[0x10:]) == resolver, "IRELATIVE addend should be the resolver")
+
+	// both the call and the function pointer use the stub
+	text := l.Executable.MappedSections[".text"]
+	data := l.Executable.MappedSections[".data"]
+	for _, section := range []*elf.Section{text, data} {
+		for _, relocation := range section.Relocations {
+			if relocation.SymbolName != "f" {
+				continue
+			}
+
+			P := l.GetSectionVirtAddress(section) + relocation.Offset
+			switch relocation.GetType() {
+			case elf.R_X86_64_PLT32:
+				assert.Truef(t, binary.LittleEndian.Uint32(section.Data[relocation.Offset:]) == uint32(stub+relocation.Addend-P),
+					"call to f should go through the stub")
+			case elf.R_X86_64_64:
+				assert.Truef(t, binary.LittleEndian.Uint64(section.Data[relocation.Offset:]) == stub,
+					"address of f should be the stub")
+			}
+		}
+	}
+
+	start := l.GetSymbolVirtAddress(l.Symbols["__rela_iplt_start"].DefinedSymbol.Symbol)
+	end := l.GetSymbolVirtAddress(l.Symbols["__rela_iplt_end"].DefinedSymbol.Symbol)
+	assert.Truef(t, start == l.GetSectionVirtAddress(l.IPLT.RelaSection), "__rela_iplt_start should be the start of .rela.iplt")
+	assert.Truef(t, end-start == 0x18, "__rela_iplt_end should be the end of .rela.iplt")
+}
+
+func TestImportedIFunc(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_ifuncmain.o",
+		"../../data/sample_shared_lib_imports.so",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the resolver of lib_select is run by the loader, the executable sees a function
+	assert.Truef(t, l.importedSymbolType("lib_select") == elf.STT_FUNC, "lib_select should be a function")
+	for _, relocation := range l.DynamicRelocations {
+		assert.Truef(t, relocation.Type != elf.R_X86_64_COPY, "%s should not be copied", relocation.SymbolName)
+	}
+	index := l.dynamicSymbolIndex("lib_select")
+	info := l.Dynamic.DynSym.Data[int(index)*0x18+0x4]
+	assert.Truef(t, elf.STT(info&0xf) == elf.STT_FUNC, "lib_select should be STT_FUNC in .dynsym got=%d", info&0xf)
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile("../../data/sample_shared_lib_imports.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libimports.so"), library, 0755) == nil, "writing the library failed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 3*10+4+3, "wrong exit code: %v", err)
+}
+
+func TestSharedHiddenIFunc(t *testing.T) {
+	dir := t.TempDir()
+	library := filepath.Join(dir, "libifunc_hidden.so")
+
+	l, err := Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_libifunc_hidden.o"},
+		ExecutableName: library,
+		Shared:         true,
+		SOName:         "libifunc_hidden.so",
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// hidden_f can not be interposed, the call and the pointer use its stub
+	assert.Truef(t, l.IPLT != nil && len(l.IPLT.Entries) == 1, "hidden_f should have an IPLT entry")
+	entry := l.IPLT.Entries[0]
+	stub, _ := l.ipltStubAddress("hidden_f")
+	irelative := false
+	for _, relocation := range l.DynamicRelocations {
+		if relocation.Type == elf.R_X86_64_IRELATIVE {
+			irelative = relocation.Section == l.GOT.Section && relocation.Offset == entry.GOTEntry.Offset
+		}
+	}
+	assert.Truef(t, irelative, "the GOT slot of hidden_f should be relocated by R_X86_64_IRELATIVE")
+
+	rela := l.Executable.MappedSections[".rela.dyn"].Data
+	found := false
+	for idx := 0; idx < len(rela); idx += 0x18 {
+		if binary.LittleEndian.Uint64(rela[idx+0x8:]) == elf.R_X86_64_RELATIVE && binary.LittleEndian.Uint64(rela[idx+0x10:]) == stub {
+			found = true
+		}
+	}
+	assert.Truef(t, found, "the R_X86_64_RELATIVE of hidden_ptr should have the stub as addend")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	_, err = Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_ifunc_hidden_main.o", library},
+		ExecutableName: filepath.Join(dir, "a.out"),
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the library calls the implementation directly and through the pointer
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 5+5, "wrong exit code: %v", err)
+}
@@ -0,0 +1,191 @@
+package linker
+
+import (
+	"github.com/andreistan26/golink/pkg/elf"
+)
+
+const pageSize = 0x1000
+
+// Position dependent executables are linked at the traditional base address, position
+// independent outputs at 0 and the dynamic loader chooses where they go
+func (linker *Linker) imageBase() uint64 {
+	if linker.isPIC() {
+		return 0
+	}
+
+	return 0x400000
+}
+
+// Permissions of the PT_LOAD that holds the section, consecutive sections with the same
+// permissions share a segment. A segment is never both writable and executable, read-only
+// data is only executable with --no-rosegment.
+func (linker *Linker) segmentFlags(entry *elf.ELF64Shdr) uint32 {
+	switch {
+	case entry.IsWritable():
+		return elf.PF_R | elf.PF_W
+	case entry.ShFlags&elf.SHF_EXECINSTR != 0 || linker.LinkerInputs.NoRosegment:
+		return elf.PF_R | elf.PF_X
+	}
+
+	return elf.PF_R
+}
+
+func isLoaded(entry *elf.ELF64Shdr) bool {
+	return entry.ShType != elf.SHT_NULL && entry.ShFlags&elf.SHF_ALLOC != 0
+}
+
+// .tbss only exists in the TLS template, the sections that follow it overlap it
+func isTBSS(entry *elf.ELF64Shdr) bool {
+	return entry.ShType == elf.SHT_NOBITS && entry.IsTLS()
+}
+
+// The number of program headers has to be known before the layout, as the table is at the
+// start of the first segment
+func (linker *Linker) programHeaderCount() int {
+	count := 0
+	flags := uint32(0)
+	for _, section := range linker.Executable.Sections {
+		if isLoaded(section.SectionEntry) && linker.segmentFlags(section.SectionEntry) != flags {
+			flags = linker.segmentFlags(section.SectionEntry)
+			count++
+		}
+	}
+
+	if _, found := linker.Executable.MappedSections[".interp"]; found {
+		// PT_PHDR and PT_INTERP
+		count += 2
+	}
+
+	if _, found := linker.Executable.MappedSections[".dynamic"]; found {
+		count++
+	}
+
+	if linker.GNUProperty != nil {
+		// PT_NOTE and PT_GNU_PROPERTY
+		count += 2
+	}
+
+	if linker.BuildID != nil {
+		// PT_NOTE of the build ID
+		count++
+	}
+
+	if len(linker.tlsSections()) != 0 {
+		count++
+	}
+
+	if linker.EhFrame != nil && linker.EhFrame.Header != nil {
+		// PT_GNU_EH_FRAME
+		count++
+	}
+
+	// PT_GNU_STACK
+	count++
+
+	for _, section := range linker.Executable.Sections {
+		if linker.isRelroSection(section) {
+			count++
+			break
+		}
+	}
+
+	return count
+}
+
+// Assigns the file offset and the address of every section and returns the PT_LOAD headers.
+// The first segment also maps the ELF header and the program headers. A new segment starts
+// on a new page, at an address that is congruent to its file offset modulo the page size.
+// The sections that follow the RELRO ones start on a new page too. With -z separate-code the
+// executable segment also starts on a new page of the file, and the next segment after it, so
+// that no other byte of the file is mapped executable.
+func (linker *Linker) layoutSections(headersSize uint64) []elf.ELF64Phdr {
+	loads := []elf.ELF64Phdr{}
+	var load *elf.ELF64Phdr
+	inRelro := false
+
+	offset := headersSize
+	addr := linker.imageBase() + headersSize
+
+	for _, section := range linker.Executable.Sections {
+		entry := section.SectionEntry
+		align := entry.ShAddrAlign
+		if align == 0 {
+			align = 1
+		}
+
+		if entry.ShType == elf.SHT_NULL {
+			continue
+		}
+
+		if !isLoaded(entry) {
+			offset = alignUp(offset, align)
+			entry.ShOff = offset
+			entry.ShAddr = 0
+			offset += entry.ShSize
+			continue
+		}
+
+		flags := linker.segmentFlags(entry)
+		if load == nil {
+			loads = append(loads, elf.ELF64Phdr{Type: elf.PT_LOAD, Flags: flags, Vaddr: linker.imageBase(), Paddr: linker.imageBase(), Align: pageSize})
+			load = &loads[len(loads)-1]
+		} else if load.Flags != flags {
+			offset = alignUp(offset, align)
+			if !linker.LinkerInputs.NoSeparateCode && (load.Flags|flags)&elf.PF_X != 0 {
+				offset = alignUp(offset, pageSize)
+			}
+			addr = alignUp(addr, pageSize) + offset%pageSize
+			loads = append(loads, elf.ELF64Phdr{Type: elf.PT_LOAD, Flags: flags, Offset: offset, Vaddr: addr, Paddr: addr, Align: pageSize})
+			load = &loads[len(loads)-1]
+		} else if inRelro && !linker.isRelroSection(section) {
+			addr = alignUp(addr, pageSize)
+		}
+		inRelro = linker.isRelroSection(section)
+
+		addr = alignUp(addr, align)
+		offset = load.Offset + addr - load.Vaddr
+		entry.ShAddr = addr
+		entry.ShOff = offset
+
+		switch {
+		case isTBSS(entry):
+		case entry.ShType == elf.SHT_NOBITS:
+			addr += entry.ShSize
+			load.MemSz = addr - load.Vaddr
+		default:
+			addr += entry.ShSize
+			offset += entry.ShSize
+			load.FileSz = offset - load.Offset
+			load.MemSz = addr - load.Vaddr
+		}
+	}
+
+	linker.Executable.Header.ShOff = alignUp(offset, 8)
+
+	return loads
+}
+
+// A segment that covers exactly one section
+func sectionSegment(phdrType uint32, flags uint32, section *elf.Section) elf.ELF64Phdr {
+	entry := section.SectionEntry
+	align := entry.ShAddrAlign
+	if align == 0 {
+		align = 1
+	}
+
+	fileSize := entry.ShSize
+	if entry.ShType == elf.SHT_NOBITS {
+		fileSize = 0
+	}
+
+	return elf.ELF64Phdr{
+		Type:   phdrType,
+		Flags:  flags,
+		Offset: entry.ShOff,
+		Vaddr:  entry.ShAddr,
+		Paddr:  entry.ShAddr,
+		FileSz: fileSize,
+		MemSz:  entry.ShSize,
+		Align:  align,
+	}
+}
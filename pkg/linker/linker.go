@@ -1,8 +1,9 @@
-Gackage linker
+package linker
 
 import (
 	"errors"
-	"os"
+	"fmt"
+	"sort"
 
 	"github.com/andreistan26/golink/pkg/elf"
 	"github.com/andreistan26/golink/pkg/helpers"
@@ -15,10 +16,94 @@ const (
 	SYM_WEAK         = 3
 )
 
+var (
+	UndefinedSymbolErr = errors.New("Undefined symbol")
+	DuplicateSymbolErr = errors.New("Duplicate symbol")
+)
+
 type LinkerInputs struct {
 	Filenames        []string
 	ExecutableName   string
 	DynamicLibraries []string
+
+	// produce a shared object instead of an executable
+	Shared bool
+	// produce a position independent executable, -pie
+	PIE bool
+	// the executable is not loaded by a dynamic loader, with PIE it relocates itself at startup
+	Static bool
+	// path of the dynamic loader, DefaultDynamicLinker if empty
+	DynamicLinker string
+	// DT_SONAME of a shared object
+	SOName string
+	// allow text relocations instead of failing, -z notext
+	NoText bool
+	// path of the version script that selects and versions the exported symbols
+	VersionScript string
+	// fail if a global pattern of the version script matches no definition
+	NoUndefinedVersion bool
+	// executables export all their definitions, --export-dynamic
+	ExportDynamic bool
+	// file listing the symbols that an executable exports, or that a shared object lets
+	// other modules interpose, in the syntax of an anonymous version script node
+	DynamicList string
+	// the references of a shared object bind to its own definitions, -Bsymbolic, or only the
+	// ones to functions, -Bsymbolic-functions
+	Symbolic          bool
+	SymbolicFunctions bool
+	// archives whose definitions are not exported, ALL for every archive
+	ExcludeLibs []string
+	// hash tables of the dynamic symbols, sysv, gnu or both, the default
+	HashStyle string
+	// library search paths of the output, recorded in DT_RUNPATH with --enable-new-dtags or
+	// in DT_RPATH otherwise
+	RPath          []string
+	EnableNewDTags bool
+	// resolve all the symbols at load time, -z now
+	BindNow bool
+	// the output uses $ORIGIN, -z origin, implied by a run path that contains it
+	Origin bool
+	// the shared object can not be unloaded, -z nodelete
+	NoDelete bool
+	// only the shared libraries that resolve a reference are recorded in DT_NEEDED
+	AsNeeded bool
+	// shared objects can not keep undefined references either, -z defs
+	NoUndefined bool
+	// relative relocations are packed in .relr.dyn, -z pack-relative-relocs
+	PackRelativeRelocs bool
+	// the sections written by the dynamic loader stay writable, -z norelro
+	NoRelro bool
+	// read-only data shares the executable segment, --no-rosegment
+	NoRosegment bool
+	// the executable segment may share file pages with the other segments, -z noseparate-code
+	NoSeparateCode bool
+	// override the stack permissions that the inputs ask for, -z execstack and -z noexecstack
+	ExecStack   bool
+	NoExecStack bool
+	// size of the stack of the main thread, -z stack-size
+	StackSize uint64
+	// report the objects without IBT or SHSTK, none, warn or error, -z cet-report
+	CETReport string
+	// mark the output as IBT compatible even if some objects are not, -z force-ibt
+	ForceIBT bool
+	// how the .note.gnu.build-id of the output is computed, fast, md5, sha1, uuid, 0x<hex>
+	// or none, the default
+	BuildID string
+	// add .eh_frame_hdr and PT_GNU_EH_FRAME, --eh-frame-hdr
+	EhFrameHdr bool
+	// only link the sections that are reachable from the roots, --gc-sections, and log the
+	// ones that are removed, --print-gc-sections
+	GCSections      bool
+	PrintGCSections bool
+	// symbols added as undefined references, --undefined, and the ones that have to be
+	// defined as well, --require-defined. Both are roots of --gc-sections.
+	Undefined      []string
+	RequireDefined []string
+	// fold the identical sections, none, safe or all, --icf, and log them, --print-icf-sections
+	ICF              string
+	PrintICFSections bool
+	// optimization level, -O, strings that end another one are merged in it from -O2
+	Optimize int
 }
 
 type ConnectedSymbol struct {
@@ -31,6 +116,15 @@ type SymbolRouter struct {
 
 	// pointer to the definition of the symbol
 	DefinedSymbol *ConnectedSymbol
+
+	// definition exported by a shared library, the symbol stays undefined in the output
+	SharedSymbol *SharedSymbol
+
+	// first undefined reference to the symbol
+	Reference *ConnectedSymbol
+
+	// the definition was made local by the version script
+	Local bool
 }
 
 type OutputELF struct {
@@ -50,6 +144,58 @@ type Linker struct {
 
 	// set of all the undefined symbols
 	UndefinedSymbols map[string]struct{}
+
+	// thread-local storage image, nil if no input has TLS sections
+	TLS *TLSTemplate
+	// _TLS_MODULE_BASE_, used by the Local Dynamic TLS descriptor sequences
+	tlsModuleBase *elf.Symbol
+
+	GOT     *GlobalOffsetTable
+	IPLT    *IPLT
+	PLT     *PLT
+	Dynamic *DynamicSections
+
+	// relocations left for the dynamic loader and the symbols they reference
+	DynamicRelocations []*DynamicRelocation
+	DynamicSymbols     []string
+	// DT_FLAGS and DT_FLAGS_1 of the output
+	DynamicFlags  uint64
+	DynamicFlags1 uint64
+
+	VersionScript *VersionScript
+	DynamicList   *VersionScript
+
+	// x86 features of the output, recorded in .note.gnu.property if any
+	X86Features uint32
+	GNUProperty *elf.Section
+	// .note.gnu.build-id, nil without --build-id
+	BuildID *elf.Section
+	// unwind tables of the output, nil if no function has one
+	EhFrame *EhFrame
+
+	// input sections that are part of the output, in the order they were merged in
+	mergedSections map[*elf.Section]int
+	// input sections reachable from the roots of --gc-sections, nil without it
+	liveSections map[*elf.Section]struct{}
+	// file(section) of the sections removed by --gc-sections
+	RemovedSections []string
+	// input sections that are not linked in as their contents are in another one, folded by
+	// --icf or deduplicated SHF_MERGE sections
+	foldedSections map[*elf.Section]*elf.Section
+	// file(section) of the sections folded by --icf and of the ones they are folded in
+	FoldedSections map[string]string
+	// object that the kept COMDAT group of each signature comes from, and the sections of the
+	// later copies
+	comdatGroups      map[string]*elf.ELF64
+	discardedSections map[*elf.Section]struct{}
+	// SHF_LINK_ORDER sections, linked in once the others are, and the output section that
+	// sh_link of each output one points to
+	linkOrderUnits   []*MergeUnit
+	linkOrderTargets map[string]*elf.Section
+
+	SharedLibraries []*SharedLibrary
+	// DT_NEEDED entries of the output, the libraries that resolved at least one symbol
+	Needed []string
 }
 
 func NewLinker(inputs LinkerInputs) *Linker {
@@ -60,6 +206,11 @@ func NewLinker(inputs LinkerInputs) *Linker {
 		Symbols:               make(map[string]*SymbolRouter),
 		UndefinedSymbols:      make(map[string]struct{}),
 		SectionDefinedSymbols: make(map[*elf.ELF64Shdr][]*ConnectedSymbol),
+		mergedSections:        make(map[*elf.Section]int),
+		foldedSections:        make(map[*elf.Section]*elf.Section),
+		comdatGroups:          make(map[string]*elf.ELF64),
+		discardedSections:     make(map[*elf.Section]struct{}),
+		linkOrderTargets:      make(map[string]*elf.Section),
 	}
 
 	if inputs.ExecutableName == "" {
@@ -72,44 +223,196 @@ func NewLinker(inputs LinkerInputs) *Linker {
 }
 
 func Link(inputs LinkerInputs) (*Linker, error) {
+	if err := checkHashStyle(inputs.HashStyle); err != nil {
+		return nil, err
+	}
+
+	if err := checkCETReport(inputs.CETReport); err != nil {
+		return nil, err
+	}
+
+	if err := checkICF(inputs.ICF); err != nil {
+		return nil, err
+	}
+
 	linker := NewLinker(inputs)
 
 	log.Debugf("Linker input files received %v", inputs.Filenames)
 
+	linker.addUndefinedSymbols()
+
 	for _, inputFile := range linker.LinkerInputs.Filenames {
-		linker.NewFile(inputFile)
+		if err := linker.NewFile(inputFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, library := range linker.LinkerInputs.DynamicLibraries {
+		if err := linker.NewFile(library); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := linker.checkRequiredSymbols(); err != nil {
+		return nil, err
+	}
+
+	if err := linker.markLiveSections(); err != nil {
+		return nil, err
 	}
 
 	linker.fillSectionDefinedSymbols()
 
+	if err := linker.foldIdenticalSections(); err != nil {
+		return nil, err
+	}
+
+	if err := linker.mergeConstants(); err != nil {
+		return nil, err
+	}
+
 	for _, inputElf := range linker.InputObjects {
 		linker.MergeElf(inputElf)
 	}
 
-	linker.Executable.SortSections()
+	if err := linker.mergeLinkOrderSections(); err != nil {
+		return nil, err
+	}
+
+	if err := linker.mergeGNUProperties(); err != nil {
+		return nil, err
+	}
+
+	if err := linker.createEhFrame(); err != nil {
+		return nil, err
+	}
+
+	if err := linker.createBuildID(); err != nil {
+		return nil, err
+	}
+
+	linker.resolveSharedSymbols()
+	linker.defineSyntheticSymbols()
+	err := linker.checkUndefinedSymbols()
+	if err != nil {
+		return nil, err
+	}
+
+	err = linker.applyVersionScript()
+	if err != nil {
+		return nil, err
+	}
+
+	err = linker.exportSymbols()
+	if err != nil {
+		return nil, err
+	}
+
+	err = linker.scanRelocations()
+	if err != nil {
+		return nil, err
+	}
+
+	linker.createDynamicSections()
+
+	linker.Executable.SortSections(linker.isRelroSection)
 	linker.UpdateMergedExecutable()
 	linker.fillProgramHeader()
 	linker.fillExecutableHeader()
-	linker.ApplyRelocations()
+	err = linker.ApplyRelocations()
+	if err != nil {
+		return nil, err
+	}
+
+	err = linker.fillGOT()
+	if err != nil {
+		return nil, err
+	}
+
+	err = linker.fillIPLT()
+	if err != nil {
+		return nil, err
+	}
+
+	err = linker.fillPLT()
+	if err != nil {
+		return nil, err
+	}
 
-	err := linker.Executable.WriteELF()
+	err = linker.fillDynamicRelocations()
+	if err != nil {
+		return nil, err
+	}
+
+	err = linker.fillDynamicSections()
+	if err != nil {
+		return nil, err
+	}
+
+	linker.fillLinkOrder()
+
+	err = linker.fillEhFrameHdr()
+	if err != nil {
+		return nil, err
+	}
+
+	err = linker.Executable.WriteELF()
 	if err != nil {
 		panic(err)
 	}
 
+	err = linker.fillBuildID()
+	if err != nil {
+		return nil, err
+	}
+
 	log.Debugf("%s\n", linker.Executable.String())
 
 	return linker, nil
 }
 
 func (linker *Linker) NewFile(filepath string) error {
+	if elf.IsArchive(filepath) {
+		archive, err := elf.NewArchive(filepath)
+		if err != nil {
+			return err
+		}
+
+		return linker.addArchive(archive)
+	}
+
 	objFile, err := elf.NewELF(filepath)
 	if err != nil {
 		return err
 	}
 
+	if objFile.Header.Type == elf.ET_DYN {
+		if linker.LinkerInputs.Static {
+			return fmt.Errorf("%w: %s", StaticLinkSharedLibraryErr, filepath)
+		}
+		linker.addSharedLibrary(objFile)
+		return nil
+	}
+
+	return linker.addObject(objFile)
+}
+
+func (linker *Linker) addObject(objFile *elf.ELF64) error {
 	linker.InputObjects = append(linker.InputObjects, objFile)
 
+	for _, sym := range objFile.Symbols {
+		setDefinitionVersion(sym)
+	}
+	for _, section := range objFile.Sections {
+		for _, relocation := range section.Relocations {
+			relocation.SymbolName = relocation.Symbol.Name
+		}
+	}
+
+	if err := linker.discardDuplicateGroups(objFile); err != nil {
+		return err
+	}
+
 	// Now update symbol hashtable with symbols
 	for _, sym := range objFile.Symbols {
 		err := linker.UpdateSymbol(sym, objFile)
@@ -123,7 +426,7 @@ func (linker *Linker) NewFile(filepath string) error {
 
 func (linker *Linker) UpdateSymbol(namedSymbol *elf.Symbol, objFile *elf.ELF64) error {
 	// We skip symbols that dont matter to resolution
-	if helpers.Find[elf.STT]([]elf.STT{elf.STT_NOTYPE, elf.STT_FUNC, elf.STT_OBJECT}, namedSymbol.BaseSymbol.GetType()) == -1 ||
+	if helpers.Find[elf.STT]([]elf.STT{elf.STT_NOTYPE, elf.STT_FUNC, elf.STT_OBJECT, elf.STT_TLS, elf.STT_GNU_IFUNC}, namedSymbol.BaseSymbol.GetType()) == -1 ||
 		namedSymbol.Name == "" {
 		return nil
 	}
@@ -146,24 +449,42 @@ func (linker *Linker) UpdateSymbol(namedSymbol *elf.Symbol, objFile *elf.ELF64)
 		linker.Symbols[namedSymbol.Name] = router
 	}
 
+	// references to thread-local variables keep their STT_TLS type, so definitions
+	// are told apart by their section
 	if router.DefinedSymbol == nil {
-		if entry.Symbol.BaseSymbol.GetType() != elf.STT_NOTYPE {
+		if entry.Symbol.BaseSymbol.StShNdx != elf.SHN_UNDEF {
 			router.DefinedSymbol = entry
 			delete(linker.UndefinedSymbols, namedSymbol.Name)
 			log.Debugf("Added as defined symbol")
 		} else {
+			// the symbol may stay undefined only if all the references to it are weak
+			if entry.Symbol.BaseSymbol.GetBinding() == elf.STB_WEAK && !found {
+				router.SymbolType = SYM_WEAK
+			} else if entry.Symbol.BaseSymbol.GetBinding() != elf.STB_WEAK {
+				router.SymbolType = SYM_UNDEF
+			}
+			if router.Reference == nil {
+				router.Reference = entry
+			}
 			linker.UndefinedSymbols[namedSymbol.Name] = struct{}{}
 		}
 		return nil
 	} else {
 		log.Debugf("This entry has a defined symbol")
-		if entry.Symbol.BaseSymbol.GetType() != elf.STT_NOTYPE {
-			if router.DefinedSymbol.Symbol.BaseSymbol.GetBinding() == elf.STB_WEAK {
-				// TODO remove the previous defined symbol from the list as it is a weak and we found a strong
-				router.DefinedSymbol.Symbol = entry.Symbol
-			} else {
-				return errors.New("Two strong symbols with same name.")
+		if entry.Symbol.BaseSymbol.StShNdx != elf.SHN_UNDEF {
+			// a strong definition replaces a weak one, a weak one never replaces the first
+			// definition, only two strong definitions conflict
+			if entry.Symbol.BaseSymbol.GetBinding() == elf.STB_WEAK {
+				return nil
+			}
+			if router.DefinedSymbol.Symbol.BaseSymbol.GetBinding() != elf.STB_WEAK {
+				previous := "the linker"
+				if router.DefinedSymbol.Elf != nil {
+					previous = router.DefinedSymbol.Elf.Filename
+				}
+				return fmt.Errorf("%w: %s defined in %s and %s", DuplicateSymbolErr, namedSymbol.Name, previous, objFile.Filename)
 			}
+			router.DefinedSymbol = entry
 		} else {
 			// update reference(entry) with the found definition
 			log.Debugf("Found a definition: %v for the reference %v", router.DefinedSymbol.Symbol,
@@ -175,12 +496,136 @@ func (linker *Linker) UpdateSymbol(namedSymbol *elf.Symbol, objFile *elf.ELF64)
 	return nil
 }
 
+func (linker *Linker) resolveSymbol(name string) (*elf.Symbol, error) {
+	router, found := linker.Symbols[name]
+	if !found || router.DefinedSymbol == nil {
+		return nil, fmt.Errorf("%w: %s", UndefinedSymbolErr, name)
+	}
+
+	return router.DefinedSymbol.Symbol, nil
+}
+
+// Returns true if the inputs reference the symbol without defining it
+func (linker *Linker) isReferenced(name string) bool {
+	router, found := linker.Symbols[name]
+	return found && router.DefinedSymbol == nil
+}
+
+// Symbols that are referenced by the inputs but are provided by the linker
+func (linker *Linker) defineSyntheticSymbols() {
+	if tlsSections := linker.tlsSections(); linker.isReferenced("_TLS_MODULE_BASE_") && len(tlsSections) != 0 {
+		// the value is set once the TLS template is built
+		linker.tlsModuleBase = linker.defineSyntheticSymbol("_TLS_MODULE_BASE_", tlsSections[0], 0, elf.STT_TLS)
+	}
+
+	// the bounds of the sections named like C identifiers
+	for _, section := range linker.Executable.Sections {
+		if section.SectionEntry.ShFlags&elf.SHF_ALLOC == 0 || !isCIdentifier(section.Name) {
+			continue
+		}
+		if linker.isReferenced("__start_" + section.Name) {
+			linker.defineSyntheticSymbol("__start_"+section.Name, section, 0, elf.STT_NOTYPE)
+		}
+		if linker.isReferenced("__stop_" + section.Name) {
+			linker.defineSyntheticSymbol("__stop_"+section.Name, section, section.SectionEntry.ShSize, elf.STT_NOTYPE)
+		}
+	}
+
+	if linker.isDynamic() {
+		// the start of .dynamic, a static PIE finds its relocations through it
+		linker.defineSyntheticSymbol("_DYNAMIC", linker.dynamicSection(), 0, elf.STT_OBJECT)
+	} else {
+		linker.defineIRelativeSymbols()
+	}
+}
+
+// Defines a symbol at value relative to an output section
+func (linker *Linker) defineSyntheticSymbol(name string, section *elf.Section, value uint64, symType elf.STT) *elf.Symbol {
+	symbol := &elf.Symbol{
+		BaseSymbol: &elf.ELF64Sym{
+			StInfo:  byte(elf.STB_GLOBAL)<<4 | byte(symType),
+			StValue: value,
+		},
+		Name: name,
+	}
+
+	section.Symbols = append(section.Symbols, symbol)
+	linker.Executable.Symbols = append(linker.Executable.Symbols, symbol)
+
+	router, found := linker.Symbols[name]
+	if !found {
+		router = &SymbolRouter{SymbolType: SYM_DEF}
+		linker.Symbols[name] = router
+	}
+
+	router.DefinedSymbol = &ConnectedSymbol{Symbol: symbol}
+	delete(linker.UndefinedSymbols, name)
+
+	return symbol
+}
+
+// Adds a section that is generated by the linker instead of being merged from the inputs
+func (linker *Linker) addSyntheticSection(name string, shType elf.SHT_TYPE, flags elf.SHT_FLAGS, align uint64, entSize uint64) *elf.Section {
+	section := &elf.Section{
+		SectionEntry: &elf.ELF64Shdr{
+			ShType:      shType,
+			ShFlags:     flags,
+			ShAddrAlign: align,
+			ShEntSize:   entSize,
+		},
+		Data:    []byte{},
+		Symbols: []*elf.Symbol{},
+		Name:    name,
+	}
+
+	linker.Executable.Sections = append(linker.Executable.Sections, section)
+	linker.Executable.MappedSections[name] = section
+	linker.Executable.Header.ShNum++
+
+	return section
+}
+
+// Drops a synthetic section that turned out to be empty, before the layout
+func (linker *Linker) removeSyntheticSection(section *elf.Section) {
+	idx := helpers.Find[*elf.Section](linker.Executable.Sections, section)
+	if idx == -1 {
+		return
+	}
+
+	linker.Executable.Sections = append(linker.Executable.Sections[:idx], linker.Executable.Sections[idx+1:]...)
+	delete(linker.Executable.MappedSections, section.Name)
+	linker.Executable.Header.ShNum--
+}
+
 func (linker *Linker) fillSectionDefinedSymbols() {
-	for _, router := range linker.Symbols {
+	// in the order of the names, so the symbol table and the build ID do not change between runs
+	names := make([]string, 0, len(linker.Symbols))
+	for name := range linker.Symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		router := linker.Symbols[name]
 		definedSymbol := router.DefinedSymbol
+		if definedSymbol == nil {
+			continue
+		}
 		definedSymbolSection := definedSymbol.Elf.Sections[definedSymbol.Symbol.BaseSymbol.StShNdx]
 		linker.addSectionDefinedSymbol(definedSymbol, definedSymbolSection.SectionEntry)
 	}
+
+	// section symbols are not resolved by name, but relocations against them need their
+	// value to follow the section once it is merged
+	for _, inputElf := range linker.InputObjects {
+		for _, symbol := range inputElf.Symbols {
+			if symbol.BaseSymbol.GetType() != elf.STT_SECTION || int(symbol.BaseSymbol.StShNdx) >= len(inputElf.Sections) {
+				continue
+			}
+			section := inputElf.Sections[symbol.BaseSymbol.StShNdx]
+			linker.addSectionDefinedSymbol(&ConnectedSymbol{Symbol: symbol, Elf: inputElf}, section.SectionEntry)
+		}
+	}
 }
 
 func (linker *Linker) addSectionDefinedSymbol(symbol *ConnectedSymbol, section *elf.ELF64Shdr) {
@@ -192,68 +637,69 @@ func (linker *Linker) addSectionDefinedSymbol(symbol *ConnectedSymbol, section *
 	}
 }
 
+// Lays out the sections and builds the program headers that describe them to the loader
 func (linker *Linker) fillProgramHeader() {
-	// find data segment offset
-	writableNdx := helpers.FindIf[*elf.Section](linker.Executable.Sections, func(section *elf.Section) bool {
-		return section.SectionEntry.IsWritable()
-	})
-
-	rxSegSize := 0
-	for i := 0; i < writableNdx; i++ {
-		rxSegSize += int(linker.Executable.Sections[i].SectionEntry.ShSize)
-	}
-
-	linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, elf.ELF64Phdr{
-		Type:   elf.PT_LOAD,
-		Flags:  elf.PF_R | elf.PF_X,
-		Offset: linker.Executable.Sections[0].SectionEntry.ShOff,
-		Vaddr:  0x400000 + linker.Executable.Sections[0].SectionEntry.ShOff,
-		Paddr:  0x400000 + linker.Executable.Sections[0].SectionEntry.ShOff,
-		FileSz: uint64(rxSegSize),
-		MemSz:  uint64(rxSegSize),
-		Align:  0x1000, // change pls
-	})
-
-	rwSegSize := 0
-	for i := writableNdx; i < len(linker.Executable.Sections); i++ {
-		rwSegSize += int(linker.Executable.Sections[i].SectionEntry.ShSize)
-	}
-
-	linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, elf.ELF64Phdr{
-		Type:   elf.PT_LOAD,
-		Flags:  elf.PF_R | elf.PF_W,
-		Offset: linker.Executable.Sections[writableNdx].SectionEntry.ShOff,
-		Vaddr:  0x401000 + linker.Executable.Sections[writableNdx].SectionEntry.ShOff,
-		Paddr:  0x401000 + linker.Executable.Sections[writableNdx].SectionEntry.ShOff,
-		FileSz: uint64(rwSegSize),
-		MemSz:  uint64(rwSegSize),
-		Align:  os.GetPagesize(),
-	})
-
-	linker.Executable.Header.PhNum = 2
-
-	phdrSize := uint64(56*2) + 64
-	// iterate all sections and offset them
-	for _, section := range linker.Executable.Sections {
-		section.SectionEntry.ShOff += phdrSize
+	phNum := linker.programHeaderCount()
+	linker.Executable.Header.PhNum = uint16(phNum)
+	loads := linker.layoutSections(uint64(0x40 + 0x38*phNum))
+
+	interp := linker.Executable.MappedSections[".interp"]
+	if interp != nil {
+		linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, elf.ELF64Phdr{
+			Type:   elf.PT_PHDR,
+			Flags:  elf.PF_R,
+			Offset: 0x40,
+			Vaddr:  linker.imageBase() + 0x40,
+			Paddr:  linker.imageBase() + 0x40,
+			FileSz: uint64(0x38 * phNum),
+			MemSz:  uint64(0x38 * phNum),
+			Align:  8,
+		})
+		linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, sectionSegment(elf.PT_INTERP, elf.PF_R, interp))
+	}
+
+	linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, loads...)
+
+	if dynamic := linker.Executable.MappedSections[".dynamic"]; dynamic != nil {
+		linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, sectionSegment(elf.PT_DYNAMIC, elf.PF_R|elf.PF_W, dynamic))
+	}
+
+	linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, linker.propertySegments()...)
+	linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, linker.buildIDSegment()...)
+
+	linker.fillTLSSegment()
+
+	linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, linker.ehFrameSegment()...)
+
+	linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, linker.stackSegment())
+
+	if relro, found := linker.relroSegment(); found {
+		linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, relro)
 	}
 }
 
 func (linker *Linker) fillExecutableHeader() {
 	linker.Executable.Header.FillIdentExecutable()
 	linker.Executable.Header.Type = elf.ET_EXEC
+	if linker.isPIC() {
+		linker.Executable.Header.Type = elf.ET_DYN
+	}
 	linker.Executable.Header.Machine = 0x3E
 	linker.Executable.Header.Version = 1
 	linker.Executable.Header.EhSize = 0x40
 	linker.Executable.Header.ShEntSize = 0x40
 
-	lastSection := linker.Executable.Sections[len(linker.Executable.Sections)-1]
-	linker.Executable.Header.ShOff = lastSection.SectionEntry.ShOff + lastSection.SectionEntry.ShSize
 	linker.Executable.Header.ShEntSize = 0x40
+	linker.Executable.Header.ShNum = uint16(len(linker.Executable.Sections))
 
 	linker.Executable.Header.PhOff = 0x40
 	linker.Executable.Header.PhEntSize = 0x38
-	linker.Executable.Header.Entry = linker.GetSectionVirtAddress(linker.Executable.MappedSections[".text"])
+	if !linker.LinkerInputs.Shared {
+		linker.Executable.Header.Entry = linker.GetSectionVirtAddress(linker.Executable.MappedSections[".text"])
+		if start, err := linker.resolveSymbol("_start"); err == nil {
+			linker.Executable.Header.Entry = linker.GetSymbolVirtAddress(start)
+		}
+	}
 
 	for idx, section := range linker.Executable.Sections {
 		if section.Name == ".shstrtab" {
@@ -263,12 +709,7 @@ func (linker *Linker) fillExecutableHeader() {
 }
 
 func (linker *Linker) GetSectionVirtAddress(section *elf.Section) uint64 {
-	phdrNdx := 0
-	if section.SectionEntry.IsWritable() {
-		phdrNdx = 1
-	}
-
-	return section.SectionEntry.ShOff + linker.Executable.PhdrEntries[phdrNdx].Vaddr
+	return section.SectionEntry.ShAddr
 }
 
 func (linker *Linker) GetSymbolVirtAddress(symbol *elf.Symbol) uint64 {
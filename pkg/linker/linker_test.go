@@ -1,6 +1,7 @@
 package linker
 
 import (
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -156,8 +157,68 @@ func TestLinkerMergeSections(t *testing.T) {
 func TestProgramHeaders(t *testing.T) {
 	filenames := []string{
 		"../../data/sample_relocatable_symbols.o",
+		"../../data/sample_relocatable_symbols_defs.o",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(t.TempDir(), "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	assert.Truef(t, int(l.Executable.Header.PhNum) == len(l.Executable.PhdrEntries), "PhNum does not match the program headers")
+	for _, phdr := range l.Executable.PhdrEntries {
+		t.Logf("%v\n", phdr)
+		assert.Truef(t, phdr.Type != elf.PT_TLS, "PT_TLS emitted without TLS sections")
+	}
+}
+
+func TestSegmentPermissions(t *testing.T) {
+	inputs := LinkerInputs{
+		Filenames: []string{
+			"../../data/sample_relocatable_symbols.o",
+			"../../data/sample_relocatable_symbols_defs.o",
+		},
+		ExecutableName: filepath.Join(t.TempDir(), "a.out"),
 	}
 
-	l, _ := Link(LinkerInputs{Filenames: filenames})
-	l.Executable.PhdrEntries
+	segmentOf := func(l *Linker, section *elf.Section) *elf.ELF64Phdr {
+		for idx, phdr := range l.Executable.PhdrEntries {
+			if phdr.Type == elf.PT_LOAD && section.SectionEntry.ShAddr >= phdr.Vaddr && section.SectionEntry.ShAddr < phdr.Vaddr+phdr.MemSz {
+				return &l.Executable.PhdrEntries[idx]
+			}
+		}
+		return nil
+	}
+
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, int(l.Executable.Header.PhNum) == len(l.Executable.PhdrEntries), "PhNum does not match the program headers")
+
+	for _, phdr := range l.Executable.PhdrEntries {
+		assert.Truef(t, phdr.Flags&(elf.PF_W|elf.PF_X) != elf.PF_W|elf.PF_X, "segment %v is writable and executable", phdr)
+	}
+
+	rodata := segmentOf(l, l.Executable.MappedSections[".rodata"])
+	text := segmentOf(l, l.Executable.MappedSections[".text"])
+	assert.Truef(t, rodata != nil && rodata.Flags == elf.PF_R, ".rodata should be in a read-only segment")
+	assert.Truef(t, text != nil && text.Flags == elf.PF_R|elf.PF_X, ".text should be in the executable segment")
+
+	// no other byte of the file is mapped with the code
+	assert.Truef(t, text.Offset%pageSize == 0 && text.Vaddr%pageSize == 0, "the code should start on a new page")
+	for _, phdr := range l.Executable.PhdrEntries {
+		if phdr.Type == elf.PT_LOAD && phdr.Offset > text.Offset {
+			assert.Truef(t, phdr.Offset >= alignUp(text.Offset+text.FileSz, pageSize), "the segment after the code should start on a new page")
+		}
+	}
+
+	inputs.NoSeparateCode = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	text = segmentOf(l, l.Executable.MappedSections[".text"])
+	assert.Truef(t, text.Offset%pageSize != 0, "the code should share the file page of the read-only data")
+
+	inputs.NoRosegment = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	rodata = segmentOf(l, l.Executable.MappedSections[".rodata"])
+	text = segmentOf(l, l.Executable.MappedSections[".text"])
+	assert.Truef(t, rodata == text && text.Flags == elf.PF_R|elf.PF_X, ".rodata should share the executable segment")
 }
@@ -0,0 +1,61 @@
+package linker
+
+import (
+	"sort"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/helpers"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+func isLinkOrder(section *elf.Section) bool {
+	return section.SectionEntry.ShFlags&elf.SHF_LINK_ORDER != 0
+}
+
+// The section that sh_link of a SHF_LINK_ORDER section points to, like the function that an
+// entry of __patchable_function_entries describes
+func linkedSection(objFile *elf.ELF64, section *elf.Section) *elf.Section {
+	index := section.SectionEntry.ShLink
+	if index == 0 || int(index) >= len(objFile.Sections) {
+		return nil
+	}
+
+	return objFile.Sections[index]
+}
+
+// SHF_LINK_ORDER sections are linked in after the other ones, in the order of their linked
+// sections in the output, and only if their linked section is, it may have been removed by
+// --gc-sections, folded by --icf or discarded with its COMDAT group.
+func (linker *Linker) mergeLinkOrderSections() error {
+	units := linker.linkOrderUnits
+	sort.SliceStable(units, func(i, j int) bool {
+		return linker.mergedSections[linkedSection(units[i].SourceELF, units[i].Section)] <
+			linker.mergedSections[linkedSection(units[j].SourceELF, units[j].Section)]
+	})
+
+	for _, unit := range units {
+		linked := linkedSection(unit.SourceELF, unit.Section)
+		if linked == nil || !linker.isMerged(linked) {
+			log.Debugf("Section %s of %s was skipped as its linked section is not linked in", unit.Section.Name, unit.SourceELF.Filename)
+			continue
+		}
+
+		if err := linker.mergeUnit(unit); err != nil {
+			return err
+		}
+		if _, found := linker.linkOrderTargets[unit.Section.Name]; !found {
+			linker.linkOrderTargets[unit.Section.Name] = linker.Executable.MappedSections[linked.Name]
+		}
+	}
+
+	return nil
+}
+
+// sh_link of the output SHF_LINK_ORDER sections is the index of the output section of their
+// linked sections, this is called after the layout is done
+func (linker *Linker) fillLinkOrder() {
+	for name, target := range linker.linkOrderTargets {
+		section := linker.Executable.MappedSections[name]
+		section.SectionEntry.ShLink = uint32(helpers.Find[*elf.Section](linker.Executable.Sections, target))
+	}
+}
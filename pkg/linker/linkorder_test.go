@@ -0,0 +1,52 @@
+package linker
+
+import (
+	"encoding/binary"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkOrder(t *testing.T) {
+	objects := []string{
+		"../../data/sample_relocatable_patch_a.o",
+		"../../data/sample_relocatable_patch_b.o",
+	}
+	// the program exits with 16 if the entries are sorted, plus their count, plus 5
+	for _, test := range []struct {
+		inputs LinkerInputs
+		count  int
+	}{
+		{LinkerInputs{}, 6},
+		// the entries of unused_a and unused_b are removed with them
+		{LinkerInputs{GCSections: true}, 4},
+		// and the one of second_copy is folded with it
+		{LinkerInputs{GCSections: true, ICF: ICF_ALL}, 3},
+	} {
+		dir := t.TempDir()
+		inputs := test.inputs
+		inputs.Filenames = objects
+		inputs.ExecutableName = filepath.Join(dir, "a.out")
+		l, err := Link(inputs)
+		assert.Truef(t, err == nil, "%d: link failed: %v", test.count, err)
+
+		entries := l.Executable.MappedSections["__patchable_function_entries"]
+		text := l.Executable.MappedSections[".text"]
+		assert.Truef(t, entries.SectionEntry.ShSize == uint64(8*test.count), "%d: wrong entries size got=%d", test.count, entries.SectionEntry.ShSize)
+		assert.Truef(t, int(entries.SectionEntry.ShLink) == helpers.Find(l.Executable.Sections, text), "sh_link should point to .text")
+
+		previous := uint64(0)
+		for offset := 0; offset < len(entries.Data); offset += 8 {
+			entry := binary.LittleEndian.Uint64(entries.Data[offset:])
+			assert.Truef(t, entry > previous && entry < text.SectionEntry.ShAddr+text.SectionEntry.ShSize, "%d: the entries should follow .text", test.count)
+			previous = entry
+		}
+
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		err = cmd.Run()
+		assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 16+test.count+5, "%d: wrong exit code: %v", test.count, err)
+	}
+}
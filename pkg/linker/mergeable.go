@@ -0,0 +1,240 @@
+package linker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/andreistan26/golink/pkg/elf"
+)
+
+var InvalidMergeSectionErr = errors.New("Invalid SHF_MERGE section")
+
+// A string with its NUL, or a record of sh_entsize bytes, of a SHF_MERGE section
+type mergePiece struct {
+	offset       uint64
+	data         []byte
+	outputOffset uint64
+}
+
+type mergeableSection struct {
+	section *elf.Section
+	objFile *elf.ELF64
+	pieces  []*mergePiece
+}
+
+// The SHF_MERGE sections with the same output section, flags, entry size and alignment. Their
+// pieces are deduplicated in the first of them, the others are not linked in.
+type mergeGroup struct {
+	sections []*mergeableSection
+	data     []byte
+}
+
+func (section *mergeableSection) String() string {
+	return fmt.Sprintf("%s(%s)", section.objFile.Filename, section.section.Name)
+}
+
+// Allocated SHF_MERGE sections, the ones with relocations are linked in as they are
+func (linker *Linker) isMergeable(section *elf.Section) bool {
+	entry := section.SectionEntry
+	if entry.ShFlags&elf.SHF_MERGE == 0 || entry.ShFlags&elf.SHF_ALLOC == 0 || entry.ShType != elf.SHT_PROGBITS ||
+		entry.ShEntSize == 0 || len(section.Relocations) != 0 {
+		return false
+	}
+
+	_, mergeable := outputSectionName(section)
+	return mergeable && linker.isLive(section) && !linker.isFolded(section) && !linker.isDiscarded(section)
+}
+
+// Splits the section in NUL terminated strings of sh_entsize characters, or in records of
+// sh_entsize bytes
+func (section *mergeableSection) split() error {
+	data := section.section.Data
+	size := section.section.SectionEntry.ShEntSize
+	if uint64(len(data))%size != 0 {
+		return fmt.Errorf("%w: size is not a multiple of the entry size in %s", InvalidMergeSectionErr, section)
+	}
+
+	for offset := uint64(0); offset < uint64(len(data)); {
+		end := offset + size
+		if section.section.SectionEntry.ShFlags&elf.SHF_STRINGS != 0 {
+			for ; ; end += size {
+				if end > uint64(len(data)) {
+					return fmt.Errorf("%w: unterminated string in %s", InvalidMergeSectionErr, section)
+				}
+				if bytes.Equal(data[end-size:end], make([]byte, size)) {
+					break
+				}
+			}
+		}
+
+		section.pieces = append(section.pieces, &mergePiece{offset: offset, data: data[offset:end]})
+		offset = end
+	}
+
+	return nil
+}
+
+// The output offset of an input offset, inside a piece or at the end of the section
+func (section *mergeableSection) outputOffset(offset uint64) (uint64, error) {
+	idx := sort.Search(len(section.pieces), func(i int) bool {
+		return section.pieces[i].offset > offset
+	}) - 1
+
+	if idx >= 0 {
+		piece := section.pieces[idx]
+		if offset <= piece.offset+uint64(len(piece.data)) {
+			return piece.outputOffset + offset - piece.offset, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: offset 0x%x is out of %s", InvalidMergeSectionErr, offset, section)
+}
+
+// Lays out the unique pieces of the group. With tail merging, strings that end another one
+// point in it: sorted by their reversed bytes, a string comes right after the ones it ends.
+func (group *mergeGroup) layout(tailMerge bool) {
+	align := group.sections[0].section.SectionEntry.ShAddrAlign
+	pieces := []*mergePiece{}
+	for _, section := range group.sections {
+		pieces = append(pieces, section.pieces...)
+	}
+
+	offsets := make(map[string]uint64)
+	place := func(piece *mergePiece) {
+		if offset, found := offsets[string(piece.data)]; found {
+			piece.outputOffset = offset
+			return
+		}
+
+		piece.outputOffset = alignUp(uint64(len(group.data)), align)
+		group.data = append(group.data, make([]byte, piece.outputOffset-uint64(len(group.data)))...)
+		group.data = append(group.data, piece.data...)
+		offsets[string(piece.data)] = piece.outputOffset
+	}
+
+	if !tailMerge {
+		for _, piece := range pieces {
+			place(piece)
+		}
+		return
+	}
+
+	reversed := func(data []byte) string {
+		out := make([]byte, len(data))
+		for idx, c := range data {
+			out[len(data)-1-idx] = c
+		}
+		return string(out)
+	}
+	sorted := make([]*mergePiece, len(pieces))
+	copy(sorted, pieces)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return reversed(sorted[i].data) > reversed(sorted[j].data)
+	})
+
+	var previous *mergePiece
+	for _, piece := range sorted {
+		if previous != nil && bytes.HasSuffix(previous.data, piece.data) {
+			piece.outputOffset = previous.outputOffset + uint64(len(previous.data)-len(piece.data))
+			offsets[string(piece.data)] = piece.outputOffset
+			continue
+		}
+
+		place(piece)
+		previous = piece
+	}
+}
+
+// Deduplicates the strings and constants of the SHF_MERGE sections across the inputs, and with
+// -O2 merges the strings that end another one. The relocations against the section symbols,
+// whose addend is the offset in the section, and the symbols defined in the sections are
+// rewritten to the deduplicated pieces.
+func (linker *Linker) mergeConstants() error {
+	groups := make(map[string]*mergeGroup)
+	keys := []string{}
+	members := make(map[*elf.Section]*mergeableSection)
+	for _, objFile := range linker.InputObjects {
+		for _, section := range objFile.Sections {
+			if !linker.isMergeable(section) {
+				continue
+			}
+
+			member := &mergeableSection{section: section, objFile: objFile}
+			if err := member.split(); err != nil {
+				return err
+			}
+			members[section] = member
+
+			name, _ := outputSectionName(section)
+			entry := section.SectionEntry
+			key := fmt.Sprintf("%s %x %x %x", name, entry.ShFlags, entry.ShEntSize, entry.ShAddrAlign)
+			if _, found := groups[key]; !found {
+				groups[key] = &mergeGroup{}
+				keys = append(keys, key)
+			}
+			groups[key].sections = append(groups[key].sections, member)
+		}
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		flags := group.sections[0].section.SectionEntry.ShFlags
+		group.layout(linker.LinkerInputs.Optimize >= 2 && flags&elf.SHF_STRINGS != 0 &&
+			group.sections[0].section.SectionEntry.ShAddrAlign <= 1)
+	}
+
+	// the addends of the relocations against section symbols are offsets in the section
+	for _, objFile := range linker.InputObjects {
+		for _, section := range objFile.Sections {
+			for _, relocation := range section.Relocations {
+				if !isSectionRelocation(relocation) || int(relocation.Symbol.BaseSymbol.StShNdx) >= len(objFile.Sections) {
+					continue
+				}
+
+				member, found := members[objFile.Sections[relocation.Symbol.BaseSymbol.StShNdx]]
+				if !found {
+					continue
+				}
+
+				offset := relocation.Symbol.BaseSymbol.StValue + relocation.Addend
+				outputOffset, err := member.outputOffset(offset)
+				if err != nil {
+					return err
+				}
+				relocation.Addend += outputOffset - offset
+			}
+		}
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		carrier := group.sections[0].section
+		for _, member := range group.sections {
+			symbols := linker.SectionDefinedSymbols[member.section.SectionEntry]
+			delete(linker.SectionDefinedSymbols, member.section.SectionEntry)
+			for _, symbol := range symbols {
+				if symbol.Symbol.BaseSymbol.GetType() == elf.STT_SECTION {
+					symbol.Symbol.BaseSymbol.StValue = 0
+				} else {
+					value, err := member.outputOffset(symbol.Symbol.BaseSymbol.StValue)
+					if err != nil {
+						return err
+					}
+					symbol.Symbol.BaseSymbol.StValue = value
+				}
+				linker.addSectionDefinedSymbol(symbol, carrier.SectionEntry)
+			}
+
+			if member.section != carrier {
+				linker.foldedSections[member.section] = carrier
+			}
+		}
+
+		carrier.Data = group.data
+		carrier.SectionEntry.ShSize = uint64(len(group.data))
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package linker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeConstants(t *testing.T) {
+	objects := []string{
+		"../../data/sample_relocatable_merge_a.o",
+		"../../data/sample_relocatable_merge_b.o",
+		"../../data/sample_relocatable_merge_c.o",
+	}
+	// the bits of the exit code: the strings of the objects are the same, world_a points in
+	// "hello world", world_ptr is "world" and the constants are right
+	for optimize, flags := range map[int]int{0: 1 | 4 | 8, 2: 1 | 2 | 4 | 8} {
+		dir := t.TempDir()
+		l, err := Link(LinkerInputs{Filenames: objects, ExecutableName: filepath.Join(dir, "a.out"), Optimize: optimize})
+		assert.Truef(t, err == nil, "-O%d: link failed: %v", optimize, err)
+
+		rodata := l.Executable.MappedSections[".rodata"].Data
+		assert.Truef(t, bytes.Count(rodata, []byte("hello world\x00")) == 1, "-O%d: the strings should be deduplicated", optimize)
+		worlds := 2
+		if optimize >= 2 {
+			worlds = 1
+		}
+		assert.Truef(t, bytes.Count(rodata, []byte("world\x00")) == worlds, "-O%d: wrong tail merging", optimize)
+		scale := binary.LittleEndian.AppendUint64(nil, math.Float64bits(1.5))
+		assert.Truef(t, bytes.Count(rodata, scale) == 1, "-O%d: the constants should be deduplicated", optimize)
+
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		err = cmd.Run()
+		assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == flags, "-O%d: wrong exit code: %v", optimize, err)
+	}
+}
+
+func TestMergeableSplit(t *testing.T) {
+	section := func(flags elf.SHT_FLAGS, size uint64, data string) *mergeableSection {
+		return &mergeableSection{
+			section: &elf.Section{Name: ".rodata.test", Data: []byte(data), SectionEntry: &elf.ELF64Shdr{ShFlags: flags, ShEntSize: size}},
+			objFile: &elf.ELF64{Filename: "test.o"},
+		}
+	}
+
+	strs := section(elf.SHF_ALLOC|elf.SHF_MERGE|elf.SHF_STRINGS, 1, "ab\x00\x00c\x00")
+	assert.Truef(t, strs.split() == nil && len(strs.pieces) == 3, "wrong strings got=%v", strs.pieces)
+	assert.Truef(t, string(strs.pieces[2].data) == "c\x00" && strs.pieces[2].offset == 4, "wrong last string")
+
+	// strings of two byte characters end with two zero bytes
+	wide := section(elf.SHF_ALLOC|elf.SHF_MERGE|elf.SHF_STRINGS, 2, "a\x00\x00\x00b\x00\x00\x00")
+	assert.Truef(t, wide.split() == nil && len(wide.pieces) == 2, "wrong wide strings got=%v", wide.pieces)
+
+	records := section(elf.SHF_ALLOC|elf.SHF_MERGE, 4, "aaaabbbb")
+	assert.Truef(t, records.split() == nil && len(records.pieces) == 2, "wrong records got=%v", records.pieces)
+
+	err := section(elf.SHF_ALLOC|elf.SHF_MERGE|elf.SHF_STRINGS, 1, "ab\x00c").split()
+	assert.Truef(t, errors.Is(err, InvalidMergeSectionErr), "unterminated strings should fail got=%v", err)
+	err = section(elf.SHF_ALLOC|elf.SHF_MERGE, 4, "aaaab").split()
+	assert.Truef(t, errors.Is(err, InvalidMergeSectionErr), "partial records should fail got=%v", err)
+}
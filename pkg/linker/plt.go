@@ -0,0 +1,177 @@
+package linker
+
+import (
+	"encoding/binary"
+
+	"github.com/andreistan26/golink/pkg/elf"
+)
+
+const (
+	pltEntrySize = 16
+	// PLT0, pushes the link map and jumps to the resolver of the dynamic loader
+	pltHeaderSize = 16
+	// .got.plt starts with the address of .dynamic, the link map and the resolver
+	gotPLTHeaderSize = 24
+)
+
+// Calls to functions of other modules go through a PLT entry that jumps through a .got.plt slot.
+// The slot initially points back into the entry, which pushes the index of its R_X86_64_JUMP_SLOT
+// relocation and jumps to PLT0, so the function is only resolved on the first call.
+// With IBT the calls go through .plt.sec instead, whose entries start with endbr64 before the
+// jump through the slot, and the slot points to the lazy binding entry in .plt, that starts with
+// endbr64 as well.
+type PLT struct {
+	Section     *elf.Section
+	GOTPLT      *elf.Section
+	RelaSection *elf.Section
+	// .plt.sec, nil without IBT
+	SecSection *elf.Section
+	Entries    []*PLTEntry
+
+	mappedEntries map[string]*PLTEntry
+}
+
+type PLTEntry struct {
+	SymbolName string
+	// offset of the entry in .plt
+	Offset uint64
+	// offset of the slot in .got.plt
+	GOTOffset uint64
+	// the address of the entry is the one of the function, it is exported in .dynsym
+	Canonical bool
+}
+
+func (linker *Linker) plt() *PLT {
+	if linker.PLT == nil {
+		linker.PLT = &PLT{
+			Section:       linker.addSyntheticSection(".plt", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_EXECINSTR, 16, pltEntrySize),
+			GOTPLT:        linker.addSyntheticSection(".got.plt", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_WRITE, 8, 8),
+			RelaSection:   linker.addSyntheticSection(".rela.plt", elf.SHT_RELA, elf.SHF_ALLOC|elf.SHF_INFO_LINK, 8, 0x18),
+			Entries:       []*PLTEntry{},
+			mappedEntries: make(map[string]*PLTEntry),
+		}
+
+		linker.PLT.Section.Data = make([]byte, pltHeaderSize)
+		linker.PLT.Section.SectionEntry.ShSize = pltHeaderSize
+		linker.PLT.GOTPLT.Data = make([]byte, gotPLTHeaderSize)
+		linker.PLT.GOTPLT.SectionEntry.ShSize = gotPLTHeaderSize
+
+		if linker.ibtPLT() {
+			linker.PLT.SecSection = linker.addSyntheticSection(".plt.sec", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_EXECINSTR, 16, pltEntrySize)
+		}
+	}
+
+	return linker.PLT
+}
+
+func (linker *Linker) allocatePLTEntry(name string) *PLTEntry {
+	plt := linker.plt()
+	if entry, found := plt.mappedEntries[name]; found {
+		return entry
+	}
+
+	entry := &PLTEntry{
+		SymbolName: name,
+		Offset:     uint64(len(plt.Section.Data)),
+		GOTOffset:  uint64(len(plt.GOTPLT.Data)),
+	}
+
+	plt.Section.Data = append(plt.Section.Data, make([]byte, pltEntrySize)...)
+	plt.Section.SectionEntry.ShSize = uint64(len(plt.Section.Data))
+	plt.GOTPLT.Data = append(plt.GOTPLT.Data, make([]byte, 8)...)
+	plt.GOTPLT.SectionEntry.ShSize = uint64(len(plt.GOTPLT.Data))
+	plt.RelaSection.Data = append(plt.RelaSection.Data, make([]byte, 0x18)...)
+	plt.RelaSection.SectionEntry.ShSize = uint64(len(plt.RelaSection.Data))
+	if plt.SecSection != nil {
+		plt.SecSection.Data = append(plt.SecSection.Data, make([]byte, pltEntrySize)...)
+		plt.SecSection.SectionEntry.ShSize = uint64(len(plt.SecSection.Data))
+	}
+
+	linker.addDynamicSymbol(name)
+
+	plt.Entries = append(plt.Entries, entry)
+	plt.mappedEntries[name] = entry
+
+	return entry
+}
+
+func (linker *Linker) pltAddress(name string) (uint64, bool) {
+	if linker.PLT == nil {
+		return 0, false
+	}
+
+	entry, found := linker.PLT.mappedEntries[name]
+	if !found {
+		return 0, false
+	}
+
+	if linker.PLT.SecSection != nil {
+		return linker.GetSectionVirtAddress(linker.PLT.SecSection) + entry.Offset - pltHeaderSize, true
+	}
+
+	return linker.GetSectionVirtAddress(linker.PLT.Section) + entry.Offset, true
+}
+
+func (linker *Linker) isCanonicalPLTEntry(name string) bool {
+	return linker.PLT != nil && linker.PLT.mappedEntries[name] != nil && linker.PLT.mappedEntries[name].Canonical
+}
+
+// Writes PLT0, the entries, the initial .got.plt slots and the JUMP_SLOT relocations once the
+// layout is done
+func (linker *Linker) fillPLT() error {
+	if linker.PLT == nil {
+		return nil
+	}
+
+	pltAddr := linker.GetSectionVirtAddress(linker.PLT.Section)
+	gotPLTAddr := linker.GetSectionVirtAddress(linker.PLT.GOTPLT)
+	data := linker.PLT.Section.Data
+
+	// push GOT+8(%rip); jmp *GOT+16(%rip); nopl 0(%rax)
+	copy(data, []byte{0xff, 0x35, 0, 0, 0, 0, 0xff, 0x25, 0, 0, 0, 0, 0x0f, 0x1f, 0x40, 0x00})
+	binary.LittleEndian.PutUint32(data[2:], uint32(gotPLTAddr+8-(pltAddr+6)))
+	binary.LittleEndian.PutUint32(data[8:], uint32(gotPLTAddr+16-(pltAddr+12)))
+
+	if dynamic := linker.Executable.MappedSections[".dynamic"]; dynamic != nil {
+		binary.LittleEndian.PutUint64(linker.PLT.GOTPLT.Data, linker.GetSectionVirtAddress(dynamic))
+	}
+
+	for idx, entry := range linker.PLT.Entries {
+		entryAddr := pltAddr + entry.Offset
+		slot := gotPLTAddr + entry.GOTOffset
+		stub := data[entry.Offset : entry.Offset+pltEntrySize]
+
+		if linker.PLT.SecSection != nil {
+			// endbr64; push $idx; jmp PLT0; xchg %ax,%ax
+			copy(stub, []byte{0xf3, 0x0f, 0x1e, 0xfa, 0x68, 0, 0, 0, 0, 0xe9, 0, 0, 0, 0, 0x66, 0x90})
+			binary.LittleEndian.PutUint32(stub[5:], uint32(idx))
+			binary.LittleEndian.PutUint32(stub[10:], uint32(pltAddr-(entryAddr+14)))
+
+			// endbr64; jmp *slot(%rip); nopw 0(%rax,%rax)
+			secOffset := entry.Offset - pltHeaderSize
+			secAddr := linker.GetSectionVirtAddress(linker.PLT.SecSection) + secOffset
+			secStub := linker.PLT.SecSection.Data[secOffset : secOffset+pltEntrySize]
+			copy(secStub, []byte{0xf3, 0x0f, 0x1e, 0xfa, 0xff, 0x25, 0, 0, 0, 0, 0x66, 0x0f, 0x1f, 0x44, 0x00, 0x00})
+			binary.LittleEndian.PutUint32(secStub[6:], uint32(slot-(secAddr+10)))
+
+			// the slot points to the entry in .plt until the symbol is resolved
+			binary.LittleEndian.PutUint64(linker.PLT.GOTPLT.Data[entry.GOTOffset:], entryAddr)
+		} else {
+			// jmp *slot(%rip); push $idx; jmp PLT0
+			copy(stub, []byte{0xff, 0x25, 0, 0, 0, 0, 0x68, 0, 0, 0, 0, 0xe9, 0, 0, 0, 0})
+			binary.LittleEndian.PutUint32(stub[2:], uint32(slot-(entryAddr+6)))
+			binary.LittleEndian.PutUint32(stub[7:], uint32(idx))
+			binary.LittleEndian.PutUint32(stub[12:], uint32(pltAddr-(entryAddr+16)))
+
+			// the slot points to the push until the symbol is resolved
+			binary.LittleEndian.PutUint64(linker.PLT.GOTPLT.Data[entry.GOTOffset:], entryAddr+6)
+		}
+
+		rela := linker.PLT.RelaSection.Data[idx*0x18:]
+		binary.LittleEndian.PutUint64(rela, slot)
+		binary.LittleEndian.PutUint64(rela[0x8:], uint64(linker.dynamicSymbolIndex(entry.SymbolName))<<32|elf.R_X86_64_JUMP_SLOT)
+		binary.LittleEndian.PutUint64(rela[0x10:], 0)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package linker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+const (
+	CET_REPORT_NONE  = "none"
+	CET_REPORT_WARN  = "warn"
+	CET_REPORT_ERROR = "error"
+)
+
+var (
+	InvalidCETReportErr = errors.New("Invalid -z cet-report value")
+	MissingCETErr       = errors.New("Input does not support CET")
+)
+
+func checkCETReport(report string) error {
+	switch report {
+	case "", CET_REPORT_NONE, CET_REPORT_WARN, CET_REPORT_ERROR:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", InvalidCETReportErr, report)
+}
+
+// The x86 features of an object are the ones of its GNU_PROPERTY_X86_FEATURE_1_AND
+// properties, an object without them supports none
+func x86Features(objFile *elf.ELF64) (uint32, error) {
+	properties, err := objFile.GNUProperties()
+	if err != nil {
+		return 0, err
+	}
+
+	features := uint32(0)
+	for _, property := range properties {
+		if property.Type == elf.GNU_PROPERTY_X86_FEATURE_1_AND && len(property.Data) >= 4 {
+			features |= binary.LittleEndian.Uint32(property.Data)
+		}
+	}
+
+	return features, nil
+}
+
+func missingFeatures(features uint32) []string {
+	missing := []string{}
+	if features&elf.GNU_PROPERTY_X86_FEATURE_1_IBT == 0 {
+		missing = append(missing, "GNU_PROPERTY_X86_FEATURE_1_IBT")
+	}
+	if features&elf.GNU_PROPERTY_X86_FEATURE_1_SHSTK == 0 {
+		missing = append(missing, "GNU_PROPERTY_X86_FEATURE_1_SHSTK")
+	}
+
+	return missing
+}
+
+// The output supports the CET features (indirect branch tracking and the shadow stack) that all
+// the objects support, -z force-ibt turns IBT on anyway. -z cet-report reports the objects that
+// lack one of them. The merged features are recorded in .note.gnu.property, that the loader
+// finds through PT_GNU_PROPERTY.
+func (linker *Linker) mergeGNUProperties() error {
+	report := linker.LinkerInputs.CETReport
+	features := ^uint32(0)
+	for _, objFile := range linker.InputObjects {
+		objFeatures, err := x86Features(objFile)
+		if err != nil {
+			return err
+		}
+		features &= objFeatures
+
+		if missing := missingFeatures(objFeatures); len(missing) != 0 {
+			switch report {
+			case CET_REPORT_WARN:
+				log.Warnf("-z cet-report: %s does not have %s", objFile.Filename, strings.Join(missing, " and "))
+			case CET_REPORT_ERROR:
+				return fmt.Errorf("%w: %s does not have %s", MissingCETErr, objFile.Filename, strings.Join(missing, " and "))
+			}
+		}
+
+		if linker.LinkerInputs.ForceIBT && objFeatures&elf.GNU_PROPERTY_X86_FEATURE_1_IBT == 0 && (report == "" || report == CET_REPORT_NONE) {
+			log.Warnf("-z force-ibt: %s does not have GNU_PROPERTY_X86_FEATURE_1_IBT", objFile.Filename)
+		}
+	}
+
+	if len(linker.InputObjects) == 0 {
+		features = 0
+	}
+	if linker.LinkerInputs.ForceIBT {
+		features |= elf.GNU_PROPERTY_X86_FEATURE_1_IBT
+	}
+
+	linker.X86Features = features
+	if features == 0 {
+		return nil
+	}
+
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, features)
+
+	linker.GNUProperty = linker.addSyntheticSection(".note.gnu.property", elf.SHT_NOTE, elf.SHF_ALLOC, 8, 0)
+	linker.GNUProperty.Data = elf.GNUPropertyNote([]elf.GNUProperty{{Type: elf.GNU_PROPERTY_X86_FEATURE_1_AND, Data: data}})
+	linker.GNUProperty.SectionEntry.ShSize = uint64(len(linker.GNUProperty.Data))
+
+	return nil
+}
+
+// With IBT every indirect branch has to land on an endbr64, so the PLT entries start with one
+func (linker *Linker) ibtPLT() bool {
+	return linker.X86Features&elf.GNU_PROPERTY_X86_FEATURE_1_IBT != 0
+}
+
+// The note is described by both PT_NOTE and PT_GNU_PROPERTY
+func (linker *Linker) propertySegments() []elf.ELF64Phdr {
+	if linker.GNUProperty == nil {
+		return nil
+	}
+
+	return []elf.ELF64Phdr{
+		sectionSegment(elf.PT_NOTE, elf.PF_R, linker.GNUProperty),
+		sectionSegment(elf.PT_GNU_PROPERTY, elf.PF_R, linker.GNUProperty),
+	}
+}
@@ -0,0 +1,112 @@
+package linker
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func propertyFeatures(t *testing.T, l *Linker) (uint32, bool) {
+	if l.GNUProperty == nil {
+		return 0, false
+	}
+
+	output := &elf.ELF64{Sections: []*elf.Section{l.GNUProperty}}
+	properties, err := output.GNUProperties()
+	assert.Truef(t, err == nil, "parsing the note failed: %v", err)
+	assert.Truef(t, len(properties) == 1 && properties[0].Type == elf.GNU_PROPERTY_X86_FEATURE_1_AND, "wrong properties got=%v", properties)
+
+	segments := map[uint32]elf.ELF64Phdr{}
+	for _, phdr := range l.Executable.PhdrEntries {
+		segments[phdr.Type] = phdr
+	}
+	assert.Truef(t, len(l.Executable.PhdrEntries) == int(l.Executable.Header.PhNum), "PhNum does not match the program headers")
+	for _, phdrType := range []uint32{elf.PT_NOTE, elf.PT_GNU_PROPERTY} {
+		assert.Truef(t, segments[phdrType].Vaddr == l.GNUProperty.SectionEntry.ShAddr, "%x should cover the note", phdrType)
+		assert.Truef(t, segments[phdrType].FileSz == l.GNUProperty.SectionEntry.ShSize, "%x should cover the note", phdrType)
+	}
+
+	return binary.LittleEndian.Uint32(properties[0].Data), true
+}
+
+func TestGNUProperties(t *testing.T) {
+	cet := []string{
+		"../../data/sample_relocatable_symbols.o",
+		"../../data/sample_relocatable_symbols_defs.o",
+	}
+	mixed := append(cet[:len(cet):len(cet)], "../../data/sample_relocatable_nostack.o")
+
+	// the features are the ones that every object has
+	l, err := Link(LinkerInputs{Filenames: cet, ExecutableName: filepath.Join(t.TempDir(), "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	features, found := propertyFeatures(t, l)
+	assert.Truef(t, found && features == elf.GNU_PROPERTY_X86_FEATURE_1_IBT|elf.GNU_PROPERTY_X86_FEATURE_1_SHSTK, "wrong features got=%x", features)
+
+	l, err = Link(LinkerInputs{Filenames: mixed, ExecutableName: filepath.Join(t.TempDir(), "a.out"), CETReport: CET_REPORT_WARN})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	_, found = propertyFeatures(t, l)
+	assert.Truef(t, !found, "an object without the note disables the features")
+	for _, phdr := range l.Executable.PhdrEntries {
+		assert.Truef(t, phdr.Type != elf.PT_GNU_PROPERTY, "PT_GNU_PROPERTY without features")
+	}
+
+	_, err = Link(LinkerInputs{Filenames: mixed, ExecutableName: filepath.Join(t.TempDir(), "a.out"), CETReport: CET_REPORT_ERROR})
+	assert.Truef(t, errors.Is(err, MissingCETErr), "-z cet-report=error should fail got=%v", err)
+
+	_, err = Link(LinkerInputs{Filenames: cet, ExecutableName: filepath.Join(t.TempDir(), "a.out"), CETReport: "fail"})
+	assert.Truef(t, errors.Is(err, InvalidCETReportErr), "wrong error got=%v", err)
+
+	l, err = Link(LinkerInputs{Filenames: mixed, ExecutableName: filepath.Join(t.TempDir(), "a.out"), ForceIBT: true})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	features, found = propertyFeatures(t, l)
+	assert.Truef(t, found && features == elf.GNU_PROPERTY_X86_FEATURE_1_IBT, "-z force-ibt should only set IBT got=%x", features)
+}
+
+func TestIBTPLT(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		inputs LinkerInputs
+	}{
+		{"IBT objects", LinkerInputs{Filenames: []string{"../../data/sample_relocatable_cet_dynmain.o", "../../data/sample_shared_lib.so"}}},
+		{"-z force-ibt", LinkerInputs{Filenames: []string{"../../data/sample_relocatable_dynmain.o", "../../data/sample_shared_lib.so"}, ForceIBT: true}},
+	} {
+		dir := t.TempDir()
+		test.inputs.ExecutableName = filepath.Join(dir, "a.out")
+		l, err := Link(test.inputs)
+		assert.Truef(t, err == nil, "%s: link failed: %v", test.name, err)
+
+		features, _ := propertyFeatures(t, l)
+		assert.Truef(t, features&elf.GNU_PROPERTY_X86_FEATURE_1_IBT != 0, "%s: the output should support IBT", test.name)
+		assert.Truef(t, l.PLT.SecSection != nil, "%s: the calls should go through .plt.sec", test.name)
+
+		// the calls and the lazy binding slot both land on endbr64
+		endbr64 := []byte{0xf3, 0x0f, 0x1e, 0xfa}
+		call, _ := l.pltAddress("lib_func")
+		secOffset := call - l.PLT.SecSection.SectionEntry.ShAddr
+		assert.Truef(t, string(l.PLT.SecSection.Data[secOffset:secOffset+4]) == string(endbr64), "%s: .plt.sec entries should start with endbr64", test.name)
+		slot := binary.LittleEndian.Uint64(l.PLT.GOTPLT.Data[l.PLT.Entries[0].GOTOffset:])
+		pltOffset := slot - l.PLT.Section.SectionEntry.ShAddr
+		assert.Truef(t, pltOffset == l.PLT.Entries[0].Offset, "%s: the slot should point to the .plt entry", test.name)
+		assert.Truef(t, string(l.PLT.Section.Data[pltOffset:pltOffset+4]) == string(endbr64), "%s: .plt entries should start with endbr64", test.name)
+
+		if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+			t.Skipf("%s not found", DefaultDynamicLinker)
+		}
+
+		library, err := os.ReadFile("../../data/sample_shared_lib.so")
+		assert.Truef(t, err == nil, "%v", err)
+		assert.Truef(t, os.WriteFile(filepath.Join(dir, "libsample.so.1"), library, 0755) == nil, "writing the library failed")
+
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+		err = cmd.Run()
+		exitErr, ok := err.(*exec.ExitError)
+		assert.Truef(t, ok && exitErr.ExitCode() == 22, "%s: wrong exit code got=%v", test.name, err)
+	}
+}
@@ -3,6 +3,7 @@ package linker
 import (
 	"encoding/binary"
 	"fmt"
+	"strings"
 
 	"github.com/andreistan26/golink/pkg/elf"
 	"github.com/andreistan26/golink/pkg/helpers"
@@ -14,26 +15,90 @@ type MergeUnit struct {
 	SourceELF *elf.ELF64
 }
 
+var mergeableNames = []string{
+	"", ".text", ".data", ".bss", ".strtab", ".rodata", ".shstrtab", ".tdata", ".tbss",
+	".data.rel", ".data.rel.local", ".data.rel.ro", ".data.rel.ro.local", ".init_array", ".fini_array",
+	".gcc_except_table",
+}
+
+// Input sections with these prefixes, from -ffunction-sections and -fdata-sections, are merged
+// in the output section without the suffix
+var outputSectionPrefixes = []string{
+	".text.", ".rodata.", ".data.rel.ro.", ".data.", ".bss.", ".tdata.", ".tbss.",
+	".init_array.", ".fini_array.", ".gcc_except_table.",
+}
+
+// The name of the output section of an input section, allocated sections named like C
+// identifiers are kept as they are, their bounds are given by __start_ and __stop_ symbols
+func outputSectionName(section *elf.Section) (string, bool) {
+	if helpers.Find[string](mergeableNames, section.Name) != -1 {
+		return section.Name, true
+	}
+
+	for _, prefix := range outputSectionPrefixes {
+		if strings.HasPrefix(section.Name, prefix) {
+			return strings.TrimSuffix(prefix, "."), true
+		}
+	}
+
+	if section.SectionEntry.ShFlags&elf.SHF_ALLOC != 0 && isCIdentifier(section.Name) {
+		return section.Name, true
+	}
+
+	return "", false
+}
+
+func isCIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for idx, c := range name {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (idx > 0 && c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // This is the method that handles section merging.
 // A merge unit is a bundle of a section header + section data + section source *ELF
 // Sections like data and text are merged as is, copy pasted with their offsets modified such that
 // they reference the output section header
 func (linker *Linker) MergeElf(target *elf.ELF64) error {
-	mergeableNames := []string{
-		"", ".text", ".data", ".bss", ".strtab", ".rodata", ".shstrtab",
-	}
-
 	for _, section := range target.Sections {
-		if helpers.Find[string](mergeableNames, section.Name) != -1 { //|| strings.Index(section.Name, ".rel") == 0 {
-			err := linker.mergeUnit(&MergeUnit{
-				Section:   section,
-				SourceELF: target,
-			})
-			if err != nil {
-				log.Errorf(err.Error())
-			}
-		} else {
+		name, mergeable := outputSectionName(section)
+		if !mergeable {
 			log.Debugf("Section was skipped because it's name was not in the mergeableNames: %s", section.Name)
+			continue
+		}
+
+		if linker.isDiscarded(section) {
+			continue
+		}
+
+		if !linker.isLive(section) {
+			linker.removeSection(target, section)
+			continue
+		}
+
+		if linker.isFolded(section) {
+			continue
+		}
+
+		section.Name = name
+		if isLinkOrder(section) {
+			linker.linkOrderUnits = append(linker.linkOrderUnits, &MergeUnit{Section: section, SourceELF: target})
+			continue
+		}
+
+		err := linker.mergeUnit(&MergeUnit{
+			Section:   section,
+			SourceELF: target,
+		})
+		if err != nil {
+			log.Errorf(err.Error())
 		}
 	}
 
@@ -41,6 +106,9 @@ func (linker *Linker) MergeElf(target *elf.ELF64) error {
 }
 
 func (linker *Linker) mergeUnit(target *MergeUnit) error {
+	// in the order of their output offsets, for the SHF_LINK_ORDER sections
+	linker.mergedSections[target.Section] = len(linker.mergedSections)
+
 	outputSection, found := linker.Executable.MappedSections[target.Section.Name]
 	if !found {
 		// add newly found section entry to the executables section list and hashmap
@@ -65,16 +133,30 @@ func (linker *Linker) mergeUnit(target *MergeUnit) error {
 	} else {
 		// copy data from new section to same section in the executable
 		if target.Section.Name != ".shstrtab" && target.Section.Name != ".strtab" {
+			// the input section keeps its alignment in the output one
+			align := target.Section.SectionEntry.ShAddrAlign
+			padding := alignUp(outputSection.SectionEntry.ShSize, align) - outputSection.SectionEntry.ShSize
+			outputSection.Data = append(outputSection.Data, make([]byte, padding)...)
+			outputSection.SectionEntry.ShSize += padding
+			if align > outputSection.SectionEntry.ShAddrAlign {
+				outputSection.SectionEntry.ShAddrAlign = align
+			}
+
 			outputSection.Data = append(outputSection.Data, target.Section.Data...)
 			linker.updateRelocations(target, outputSection.SectionEntry.ShSize)
 			outputSection.SectionEntry.ShSize += target.Section.SectionEntry.ShSize
 		}
 	}
 
-	linker.mergeSymbols(target, found)
+	linker.mergeSymbols(target, !found)
 	return nil
 }
 
+func (linker *Linker) isMerged(section *elf.Section) bool {
+	_, found := linker.mergedSections[section]
+	return found
+}
+
 func (linker *Linker) mergeSymbols(target *MergeUnit, isFirstSection bool) {
 	destSection, ok := linker.Executable.MappedSections[target.Section.Name]
 	if !ok {
@@ -130,24 +212,188 @@ func (linker *Linker) UpdateMergedExecutable() error {
 	strtab.SectionEntry.ShSize = uint64(len(strtab.Data))
 	shstrtab.SectionEntry.ShSize = uint64(len(shstrtab.Data))
 
-	currentSectionOffset := uint64(0)
+	return nil
+}
+
+// Goes through the relocations of the merged sections before the layout, to allocate the
+// GOT and PLT entries and the dynamic relocations they need
+func (linker *Linker) scanRelocations() error {
 	for _, section := range linker.Executable.Sections {
-		// update offset of current section
-		section.SectionEntry.ShOff = currentSectionOffset
-		currentSectionOffset += section.SectionEntry.ShSize
+		for i := 0; i < len(section.Relocations); i++ {
+			relocation := section.Relocations[i]
+			name := relocation.SymbolName
+
+			if isTLSRelocation(relocation.GetType()) {
+				if linker.LinkerInputs.Shared {
+					if err := linker.scanTLSRelocation(relocation); err != nil {
+						return err
+					}
+					continue
+				}
+
+				if name != "" && !isSectionRelocation(relocation) && linker.isImported(name) {
+					if err := linker.scanImportedTLSRelocation(relocation); err != nil {
+						return err
+					}
+				}
+				if relocation.GetType() == elf.R_X86_64_TLSGD || relocation.GetType() == elf.R_X86_64_TLSLD {
+					// the call to __tls_get_addr does not survive the relaxation
+					i = linker.skipTLSGetAddr(section, i)
+				}
+				continue
+			}
+
+			switch {
+			case isSectionRelocation(relocation):
+				// always a local definition
+			case name == "":
+				continue
+			case linker.isIFunc(name) && !linker.isPreemptible(name):
+				linker.allocateIPLTEntry(name)
+			case linker.isImported(name):
+				if err := linker.scanImportedRelocation(section, relocation); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := linker.scanLocalRelocation(section, relocation); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-// TODO: support -no-pic, currently only -fPIC and PIE are supported
+// Relocations against symbols that are resolved at link time, in a position independent output
+// their absolute addresses are relocated by the dynamic loader
+func (linker *Linker) scanLocalRelocation(section *elf.Section, relocation *elf.Relocation) error {
+	name := relocation.SymbolName
+
+	switch relocation.GetType() {
+	case elf.R_X86_64_GOTPCREL, elf.R_X86_64_GOTPCRELX, elf.R_X86_64_REX_GOTPCRELX:
+		entry, isNew := linker.got().Allocate(GOT_SYMBOL, name)
+		switch {
+		case !isNew || !linker.isPIC() || linker.isIFunc(name):
+		case linker.isUndefinedWeak(name):
+			// the slot stays 0, unless the symbol is dynamic and another module may define it
+			if linker.dynamicSymbolIndex(name) != 0 {
+				linker.addDynamicRelocation(&DynamicRelocation{
+					Section: linker.GOT.Section, Offset: entry.Offset, Type: elf.R_X86_64_GLOB_DAT, SymbolName: name,
+				})
+			}
+		default:
+			linker.addDynamicRelocation(&DynamicRelocation{
+				Section: linker.GOT.Section, Offset: entry.Offset, Type: elf.R_X86_64_RELATIVE, AddendSymbol: name,
+			})
+		}
+	case elf.R_X86_64_64:
+		// the address of a weak undefined symbol is 0 wherever the output is loaded
+		if linker.isPIC() && !linker.isUndefinedWeak(name) {
+			return linker.addAbsoluteRelocation(section, relocation)
+		}
+	case elf.R_X86_64_32, elf.R_X86_64_32S:
+		if linker.isPIC() {
+			return fmt.Errorf("%w: 32-bit absolute address of %s, recompile with -fPIC", NotPICErr, name)
+		}
+	}
+
+	return nil
+}
+
+// The value of S for a relocation: the IPLT stub of an indirect function, the PLT entry of an
+// imported function, zero for the other imported symbols and the weak undefined ones, as their
+// value is only known at runtime
+func (linker *Linker) symbolAddress(name string) (uint64, error) {
+	if stub, found := linker.ipltStubAddress(name); found {
+		return stub, nil
+	}
+
+	if entry, found := linker.pltAddress(name); found {
+		return entry, nil
+	}
+
+	if linker.isImported(name) {
+		return 0, nil
+	}
+
+	symbol, err := linker.resolveSymbol(name)
+	if err != nil {
+		if router, found := linker.Symbols[name]; found && router.SymbolType == SYM_WEAK {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return linker.GetSymbolVirtAddress(symbol), nil
+}
+
+// Relocations against section symbols are used for the local definitions, they are resolved
+// through the symbol itself as it has no name
+func isSectionRelocation(relocation *elf.Relocation) bool {
+	return relocation.Symbol != nil && relocation.Symbol.BaseSymbol.GetType() == elf.STT_SECTION
+}
+
+func (linker *Linker) relocationSymbolAddress(relocation *elf.Relocation) (uint64, error) {
+	if isSectionRelocation(relocation) {
+		return linker.GetSymbolVirtAddress(relocation.Symbol), nil
+	}
+
+	return linker.symbolAddress(relocation.SymbolName)
+}
+
+// Writes the link time values of the relocations, in position independent outputs the absolute
+// addresses are relative to 0 and the dynamic relocations add the load address
 func (linker *Linker) ApplyRelocations() error {
 	for _, section := range linker.Executable.Sections {
-		for _, relocation := range section.Relocations {
+		for i := 0; i < len(section.Relocations); i++ {
+			relocation := section.Relocations[i]
+			log.Debugf("Applying relocation at %x", relocation.Offset)
+
+			if linker.LinkerInputs.Shared && isTLSRelocation(relocation.GetType()) {
+				if err := linker.applyDynamicTLSRelocation(section, relocation); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// these do not reference the value of their symbol
+			switch relocation.GetType() {
+			case elf.R_X86_64_NONE:
+				continue
+			case elf.R_X86_64_TLSLD:
+				// there is a single TLS module in a static executable, relax to Local Exec
+				// and skip the call to __tls_get_addr that follows
+				if err := relaxTLSLDToLE(section.Data, relocation.Offset); err != nil {
+					return err
+				}
+				i = linker.skipTLSGetAddr(section, i)
+				continue
+			case elf.R_X86_64_TLSDESC_CALL:
+				if err := relaxTLSDescCall(section.Data, relocation.Offset); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if !linker.LinkerInputs.Shared && linker.isImportedTLS(relocation) {
+				if err := linker.applyImportedTLSRelocation(section, relocation); err != nil {
+					return err
+				}
+				if relocation.GetType() == elf.R_X86_64_TLSGD {
+					i = linker.skipTLSGetAddr(section, i)
+				}
+				continue
+			}
+
+			S, err := linker.relocationSymbolAddress(relocation)
+			if err != nil {
+				return err
+			}
+
 			A := relocation.Addend
-			S := linker.GetSymbolVirtAddress(linker.Symbols[relocation.SymbolName].DefinedSymbol.Symbol)
 			P := linker.GetSectionVirtAddress(section) + relocation.Offset
-			fmt.Printf("Applied relocation at %x\n", relocation.Offset)
 
 			// section offset of the place where we need to write a symbol address
 			// relDest := relocation.Offset
@@ -155,8 +401,6 @@ func (linker *Linker) ApplyRelocations() error {
 			// symAddr := 0
 
 			switch relocation.GetType() {
-			case elf.R_X86_64_NONE:
-				continue
 			case elf.R_X86_64_64:
 				V := S + A
 				binary.LittleEndian.PutUint64(section.Data[relocation.Offset:], uint64(V))
@@ -165,13 +409,66 @@ func (linker *Linker) ApplyRelocations() error {
 				V := S + A - P
 				binary.LittleEndian.PutUint64(section.Data[relocation.Offset:], uint64(V))
 				break
-			case elf.R_X86_64_PC32:
+			// calls to imported functions go through their PLT entry, the others go straight
+			// to the symbol, or to its IPLT stub
+			case elf.R_X86_64_PC32, elf.R_X86_64_PLT32:
 				V := S + A - P
 				binary.LittleEndian.PutUint32(section.Data[relocation.Offset:], uint32(V))
 				break
-				//case elf.R_X86_64_REX_GOTP:
-				//case elf.R_X86_64_GOTPCREL:
-				//TODO
+			case elf.R_X86_64_32, elf.R_X86_64_32S:
+				V := S + A
+				binary.LittleEndian.PutUint32(section.Data[relocation.Offset:], uint32(V))
+				break
+			case elf.R_X86_64_GOTPCREL, elf.R_X86_64_GOTPCRELX, elf.R_X86_64_REX_GOTPCRELX:
+				entry := linker.GOT.Find(GOT_SYMBOL, relocation.SymbolName)
+				V := linker.GetSectionVirtAddress(linker.GOT.Section) + entry.Offset + A - P
+				binary.LittleEndian.PutUint32(section.Data[relocation.Offset:], uint32(V))
+				break
+			case elf.R_X86_64_TPOFF32, elf.R_X86_64_DTPOFF32:
+				// DTPOFF is only found after a relaxed LD sequence, where the module base is the thread pointer
+				tpoff, err := linker.tpOffset(relocation, S)
+				if err != nil {
+					return err
+				}
+				binary.LittleEndian.PutUint32(section.Data[relocation.Offset:], uint32(tpoff+A))
+				break
+			case elf.R_X86_64_TPOFF64, elf.R_X86_64_DTPOFF64:
+				tpoff, err := linker.tpOffset(relocation, S)
+				if err != nil {
+					return err
+				}
+				binary.LittleEndian.PutUint64(section.Data[relocation.Offset:], tpoff+A)
+				break
+			case elf.R_X86_64_GOTTPOFF:
+				// the PC relative addends of the relaxed sequences account for the -4 of the
+				// displacement, which is not needed by the immediate that replaces it
+				tpoff, err := linker.tpOffset(relocation, S)
+				if err != nil {
+					return err
+				}
+				if err := relaxGOTTPOFFToLE(section.Data, relocation.Offset, tpoff+A+4); err != nil {
+					return err
+				}
+				break
+			case elf.R_X86_64_TLSGD:
+				tpoff, err := linker.tpOffset(relocation, S)
+				if err != nil {
+					return err
+				}
+				if err := relaxTLSGDToLE(section.Data, relocation.Offset, tpoff+A+4); err != nil {
+					return err
+				}
+				i = linker.skipTLSGetAddr(section, i)
+				break
+			case elf.R_X86_64_GOTPC32_TLSDESC:
+				tpoff, err := linker.tpOffset(relocation, S)
+				if err != nil {
+					return err
+				}
+				if err := relaxTLSDescToLE(section.Data, relocation.Offset, tpoff+A+4); err != nil {
+					return err
+				}
+				break
 			}
 		}
 	}
@@ -0,0 +1,136 @@
+package linker
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/helpers"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+// Version of glibc that the outputs with DT_RELR depend on, the dynamic loader refuses them
+// otherwise
+const GlibcRelrVersion = "GLIBC_ABI_DT_RELR"
+
+// The relative relocations packed in .relr.dyn. An even entry is the address of a relocated
+// word, it is followed by odd bitmaps whose bit n, from the second lowest, relocates the n-th
+// word after the previous entry. The addends are the values already stored at the places.
+type RelrTable struct {
+	Section *elf.Section
+	// the relocated offsets of each output section, sorted
+	Offsets  map[*elf.Section][]uint64
+	Sections []*elf.Section
+}
+
+// words covered by a bitmap entry
+const relrBitmapWords = 63
+
+// Moves the relative relocations of aligned words from .rela.dyn to .relr.dyn. An address entry
+// starts the relocations of each output section, so that the size of the table is known before
+// the layout.
+func (linker *Linker) packRelativeRelocations() {
+	if !linker.LinkerInputs.PackRelativeRelocs || len(linker.DynamicRelocations) == 0 {
+		return
+	}
+
+	relr := &RelrTable{Offsets: make(map[*elf.Section][]uint64)}
+	remaining := []*DynamicRelocation{}
+	for _, relocation := range linker.DynamicRelocations {
+		if relocation.Type != elf.R_X86_64_RELATIVE || relocation.Offset%8 != 0 ||
+			relocation.Section.SectionEntry.ShAddrAlign < 8 {
+			remaining = append(remaining, relocation)
+			continue
+		}
+
+		if _, found := relr.Offsets[relocation.Section]; !found {
+			relr.Sections = append(relr.Sections, relocation.Section)
+		}
+		relr.Offsets[relocation.Section] = append(relr.Offsets[relocation.Section], relocation.Offset)
+	}
+
+	packed := len(linker.DynamicRelocations) - len(remaining)
+	if packed == 0 {
+		return
+	}
+
+	size := 0
+	for _, section := range relr.Sections {
+		offsets := relr.Offsets[section]
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		size += 8 * len(encodeRelr(0, offsets))
+	}
+
+	relr.Section = linker.addSyntheticSection(".relr.dyn", elf.SHT_RELR, elf.SHF_ALLOC, 8, 8)
+	relr.Section.Data = make([]byte, size)
+	relr.Section.SectionEntry.ShSize = uint64(size)
+	linker.Dynamic.Relr = relr
+
+	linker.DynamicRelocations = remaining
+	relaDyn := linker.relaDyn()
+	relaDyn.Data = relaDyn.Data[:0x18*len(remaining)]
+	relaDyn.SectionEntry.ShSize = uint64(len(relaDyn.Data))
+	if len(remaining) == 0 {
+		linker.removeSyntheticSection(relaDyn)
+	}
+
+	log.Infof("Packed %d relative relocations in .relr.dyn, %d bytes saved", packed, 0x18*packed-size)
+}
+
+// Encodes the sorted offsets of the relocated words of a section at the given address
+func encodeRelr(base uint64, offsets []uint64) []uint64 {
+	entries := []uint64{}
+
+	for i := 0; i < len(offsets); {
+		entries = append(entries, base+offsets[i])
+		next := offsets[i] + 8
+		i++
+
+		for i < len(offsets) && offsets[i]-next < 8*relrBitmapWords {
+			bitmap := uint64(0)
+			for i < len(offsets) && offsets[i]-next < 8*relrBitmapWords {
+				bitmap |= 1 << ((offsets[i] - next) / 8)
+				i++
+			}
+
+			entries = append(entries, bitmap<<1|1)
+			next += 8 * relrBitmapWords
+		}
+	}
+
+	return entries
+}
+
+// Serializes .relr.dyn, the places of the relocations hold their addends
+func (linker *Linker) fillRelr() {
+	relr := linker.Dynamic.Relr
+	if relr == nil {
+		return
+	}
+
+	offset := 0
+	for _, section := range relr.Sections {
+		for _, entry := range encodeRelr(linker.GetSectionVirtAddress(section), relr.Offsets[section]) {
+			binary.LittleEndian.PutUint64(relr.Section.Data[offset:], entry)
+			offset += 8
+		}
+	}
+}
+
+// The libraries that define GLIBC_ABI_DT_RELR, glibc only loads outputs with DT_RELR if they
+// need this version
+func (linker *Linker) relrVersionProviders() []*SharedLibrary {
+	providers := []*SharedLibrary{}
+	if linker.Dynamic.Relr == nil {
+		return providers
+	}
+
+	for _, library := range linker.SharedLibraries {
+		if helpers.Find[string](linker.Needed, library.SOName) != -1 &&
+			helpers.Find[string](library.Elf.VersionDefinitions, GlibcRelrVersion) != -1 {
+			providers = append(providers, library)
+		}
+	}
+
+	return providers
+}
@@ -0,0 +1,122 @@
+package linker
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+// Decodes .relr.dyn like the dynamic loader does
+func decodeRelr(entries []uint64) []uint64 {
+	addresses := []uint64{}
+	where := uint64(0)
+	for _, entry := range entries {
+		if entry&1 == 0 {
+			addresses = append(addresses, entry)
+			where = entry + 8
+			continue
+		}
+
+		for bit := uint64(0); entry>>(bit+1) != 0; bit++ {
+			if entry>>(bit+1)&1 != 0 {
+				addresses = append(addresses, where+8*bit)
+			}
+		}
+		where += 8 * relrBitmapWords
+	}
+
+	return addresses
+}
+
+func TestEncodeRelr(t *testing.T) {
+	offsets := []uint64{0, 8, 24, 8 * 63, 8 * 64, 8 * 200, 8 * 201}
+	entries := encodeRelr(0x1000, offsets)
+	assert.Truef(t, len(entries) == 5, "expected 5 entries got=%x", entries)
+
+	expected := []uint64{}
+	for _, offset := range offsets {
+		expected = append(expected, 0x1000+offset)
+	}
+	assert.Truef(t, reflect.DeepEqual(decodeRelr(entries), expected), "wrong relocations got=%x", decodeRelr(entries))
+}
+
+func TestPackRelativeRelocations(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_relr.o"},
+		ExecutableName: filepath.Join(dir, "a.out"),
+		PIE:            true,
+	}
+
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	relative := []uint64{}
+	for _, relocation := range l.DynamicRelocations {
+		if relocation.Type == elf.R_X86_64_RELATIVE && relocation.Offset%8 == 0 {
+			relative = append(relative, l.GetSectionVirtAddress(relocation.Section)+relocation.Offset)
+		}
+	}
+	assert.Truef(t, len(relative) == 71, "expected 71 aligned relative relocations got=%d", len(relative))
+
+	inputs.PackRelativeRelocs = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	relr := l.Dynamic.Relr
+	assert.Truef(t, relr != nil, ".relr.dyn should be emitted")
+	assert.Truef(t, len(l.DynamicRelocations) == 1, "the unaligned pointer stays in .rela.dyn")
+
+	entries := []uint64{}
+	for offset := 0; offset < len(relr.Section.Data); offset += 8 {
+		entries = append(entries, binary.LittleEndian.Uint64(relr.Section.Data[offset:]))
+	}
+	assert.Truef(t, len(entries) == 4, "far, the table and two bitmaps got=%x", entries)
+
+	// the places of the pointers, which hold the addends
+	packed := decodeRelr(entries)
+	far, _ := l.resolveSymbol("far")
+	table, _ := l.resolveSymbol("table")
+	expected := []uint64{l.GetSymbolVirtAddress(far)}
+	for idx := uint64(0); idx < 70; idx++ {
+		expected = append(expected, l.GetSymbolVirtAddress(table)+8*idx)
+	}
+	assert.Truef(t, reflect.DeepEqual(packed, expected), "wrong places got=%x", packed)
+
+	tags := make(map[int64]uint64)
+	for _, entry := range l.Dynamic.Entries {
+		tags[entry.Tag] = entry.Value
+	}
+	assert.Truef(t, tags[elf.DT_RELR] == relr.Section.SectionEntry.ShAddr, "wrong DT_RELR")
+	assert.Truef(t, tags[elf.DT_RELRSZ] == 8*4, "wrong DT_RELRSZ")
+	assert.Truef(t, tags[elf.DT_RELRENT] == 8, "wrong DT_RELRENT")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 7, "wrong exit code: %v", err)
+}
+
+func TestRelrVersionDependency(t *testing.T) {
+	l, err := Link(LinkerInputs{
+		Filenames:          []string{"../../data/sample_relocatable_relr.o", "../../data/sample_shared_lib_relr.so"},
+		ExecutableName:     filepath.Join(t.TempDir(), "a.out"),
+		PIE:                true,
+		PackRelativeRelocs: true,
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the library is not used, but it is needed and defines the version
+	versions := l.Dynamic.Versions
+	assert.Truef(t, versions != nil && len(versions.Needed) == 1, "a version should be needed")
+	assert.Truef(t, versions.Needed[0].SOName == "libc.so.6" && reflect.DeepEqual(versions.Needed[0].Versions, []string{GlibcRelrVersion}),
+		"%s should be needed from libc.so.6", GlibcRelrVersion)
+}
@@ -0,0 +1,64 @@
+package linker
+
+import (
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/helpers"
+)
+
+// Writable sections that are only written by the dynamic loader, they are made read-only once
+// the relocations are applied
+var relroSections = []string{
+	".init_array", ".fini_array", ".data.rel.ro", ".data.rel.ro.local", ".dynamic", ".got", ".bss.rel.ro",
+}
+
+// The TLS template is part of RELRO too, and so is .got.plt when the symbols are bound at load
+// time with -z now
+func (linker *Linker) isRelroSection(section *elf.Section) bool {
+	entry := section.SectionEntry
+	if linker.LinkerInputs.NoRelro || !isLoaded(entry) || !entry.IsWritable() {
+		return false
+	}
+
+	if section.Name == ".got.plt" {
+		return linker.LinkerInputs.BindNow
+	}
+
+	return entry.IsTLS() || helpers.Find[string](relroSections, section.Name) != -1
+}
+
+// The RELRO sections are at the start of the writable segment, the segment goes on at the next
+// page so that the dynamic loader can protect them without the data that follows. .tbss takes
+// no address space, the layout starts that page after the sections before it.
+func (linker *Linker) relroSegment() (elf.ELF64Phdr, bool) {
+	var first *elf.Section
+	end := uint64(0)
+	for _, section := range linker.Executable.Sections {
+		if !linker.isRelroSection(section) {
+			continue
+		}
+
+		if first == nil {
+			first = section
+			end = section.SectionEntry.ShAddr
+		}
+		if !isTBSS(section.SectionEntry) {
+			end = max(end, section.SectionEntry.ShAddr+section.SectionEntry.ShSize)
+		}
+	}
+
+	if first == nil {
+		return elf.ELF64Phdr{}, false
+	}
+
+	size := alignUp(end, pageSize) - first.SectionEntry.ShAddr
+	return elf.ELF64Phdr{
+		Type:   elf.PT_GNU_RELRO,
+		Flags:  elf.PF_R,
+		Offset: first.SectionEntry.ShOff,
+		Vaddr:  first.SectionEntry.ShAddr,
+		Paddr:  first.SectionEntry.ShAddr,
+		FileSz: size,
+		MemSz:  size,
+		Align:  1,
+	}, true
+}
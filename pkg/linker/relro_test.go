@@ -0,0 +1,151 @@
+package linker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func relroHeader(l *Linker) *elf.ELF64Phdr {
+	for idx, phdr := range l.Executable.PhdrEntries {
+		if phdr.Type == elf.PT_GNU_RELRO {
+			return &l.Executable.PhdrEntries[idx]
+		}
+	}
+
+	return nil
+}
+
+func inSegment(phdr *elf.ELF64Phdr, section *elf.Section) bool {
+	return section.SectionEntry.ShAddr >= phdr.Vaddr && section.SectionEntry.ShAddr+section.SectionEntry.ShSize <= phdr.Vaddr+phdr.MemSz
+}
+
+func TestRelroSegment(t *testing.T) {
+	dir := t.TempDir()
+	inputs := LinkerInputs{
+		Filenames: []string{
+			"../../data/sample_relocatable_dynmain.o",
+			"../../data/sample_shared_lib.so",
+		},
+		ExecutableName: filepath.Join(dir, "a.out"),
+	}
+
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, int(l.Executable.Header.PhNum) == len(l.Executable.PhdrEntries), "PhNum does not match the program headers")
+
+	relro := relroHeader(l)
+	assert.Truef(t, relro != nil, "PT_GNU_RELRO should be emitted")
+	assert.Truef(t, (relro.Vaddr+relro.MemSz)%pageSize == 0, "the end of RELRO should be page aligned")
+
+	sections := l.Executable.MappedSections
+	assert.Truef(t, inSegment(relro, sections[".dynamic"]) && inSegment(relro, sections[".got"]), ".dynamic and .got should be read-only")
+	assert.Truef(t, !inSegment(relro, sections[".got.plt"]), ".got.plt is written by the lazy binding")
+	assert.Truef(t, sections[".data"].SectionEntry.ShAddr >= relro.Vaddr+relro.MemSz, ".data should follow RELRO on a new page")
+
+	// the RELRO sections start the writable segment
+	for _, phdr := range l.Executable.PhdrEntries {
+		if phdr.Type == elf.PT_LOAD && phdr.Flags&elf.PF_W != 0 {
+			assert.Truef(t, phdr.Vaddr == relro.Vaddr, "RELRO should be at the start of the writable segment")
+		}
+	}
+
+	inputs.BindNow = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	relro = relroHeader(l)
+	assert.Truef(t, relro != nil && inSegment(relro, l.Executable.MappedSections[".got.plt"]), ".got.plt should be read-only with -z now")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err == nil {
+		library, err := os.ReadFile("../../data/sample_shared_lib.so")
+		assert.Truef(t, err == nil, "%v", err)
+		assert.Truef(t, os.WriteFile(filepath.Join(dir, "libsample.so.1"), library, 0755) == nil, "writing the library failed")
+
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+		err = cmd.Run()
+		assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 6+6+10, "wrong exit code: %v", err)
+	}
+
+	inputs.NoRelro = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, relroHeader(l) == nil, "PT_GNU_RELRO should not be emitted with -z norelro")
+}
+
+func TestRelroTBSS(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Link(LinkerInputs{
+		Filenames: []string{
+			"../../data/sample_relocatable_relro_tbss.o",
+			"../../data/sample_shared_lib_imports.so",
+		},
+		ExecutableName: filepath.Join(dir, "a.out"),
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the 64KiB of .tbss are overlapped by the sections that follow it
+	relro := relroHeader(l)
+	sections := l.Executable.MappedSections
+	assert.Truef(t, relro != nil && inSegment(relro, sections[".dynamic"]), ".dynamic should be read-only")
+	assert.Truef(t, relro.MemSz == pageSize, "RELRO should not cover .tbss, got size=%#x", relro.MemSz)
+	assert.Truef(t, sections[".data"].SectionEntry.ShAddr >= relro.Vaddr+relro.MemSz, ".data should follow RELRO")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile("../../data/sample_shared_lib_imports.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libimports.so"), library, 0755) == nil, "writing the library failed")
+
+	// the program writes a global of .data
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 1+4+3+2, "wrong exit code: %v", err)
+}
+
+func TestInitArray(t *testing.T) {
+	dir := t.TempDir()
+	library := filepath.Join(dir, "libctor.so")
+
+	l, err := Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_libctor.o"},
+		ExecutableName: library,
+		Shared:         true,
+		SOName:         "libctor.so",
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	initArray := l.Executable.MappedSections[".init_array"]
+	assert.Truef(t, initArray != nil, ".init_array should be merged")
+	assert.Truef(t, inSegment(relroHeader(l), initArray), ".init_array should be read-only")
+
+	tags := make(map[int64]uint64)
+	for _, entry := range l.Dynamic.Entries {
+		tags[entry.Tag] = entry.Value
+	}
+	assert.Truef(t, tags[elf.DT_INIT_ARRAY] == initArray.SectionEntry.ShAddr, "wrong DT_INIT_ARRAY")
+	assert.Truef(t, tags[elf.DT_INIT_ARRAYSZ] == 8, "wrong DT_INIT_ARRAYSZ")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	_, err = Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_ctor_main.o", library},
+		ExecutableName: filepath.Join(dir, "a.out"),
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the constructor of the library runs before _start
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 9, "wrong exit code: %v", err)
+}
@@ -0,0 +1,152 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/helpers"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+var StaticLinkSharedLibraryErr = errors.New("Attempted static link of a shared object")
+
+// A shared object given as input, its code is not copied in the output, the undefined
+// references that it satisfies are bound at runtime by the dynamic loader
+type SharedLibrary struct {
+	Elf *elf.ELF64
+	// name recorded in DT_NEEDED, the file name if the library has no DT_SONAME
+	SOName string
+	// a symbol of the library satisfied a reference of the inputs, with --as-needed the unused
+	// libraries are not recorded in DT_NEEDED
+	Used bool
+
+	exports map[string]*elf.Symbol
+	// symbols that the library expects another module to define
+	references map[string]struct{}
+}
+
+type SharedSymbol struct {
+	Symbol  *elf.Symbol
+	Library *SharedLibrary
+}
+
+func (linker *Linker) addSharedLibrary(library *elf.ELF64) {
+	shared := &SharedLibrary{
+		Elf:        library,
+		SOName:     library.SOName,
+		exports:    make(map[string]*elf.Symbol),
+		references: make(map[string]struct{}),
+	}
+
+	if shared.SOName == "" {
+		shared.SOName = filepath.Base(library.Filename)
+	}
+
+	for _, symbol := range library.DynamicSymbols {
+		base := symbol.BaseSymbol
+		binding := base.GetBinding()
+
+		if base.StShNdx == elf.SHN_UNDEF && symbol.Name != "" {
+			shared.references[symbol.Name] = struct{}{}
+			continue
+		}
+
+		if base.StShNdx == elf.SHN_UNDEF || symbol.Name == "" ||
+			(binding != elf.STB_GLOBAL && binding != elf.STB_WEAK) ||
+			helpers.Find[elf.STT]([]elf.STT{elf.STT_NOTYPE, elf.STT_FUNC, elf.STT_OBJECT, elf.STT_TLS, elf.STT_GNU_IFUNC}, base.GetType()) == -1 {
+			continue
+		}
+
+		// references with an explicit version bind to any version, the unversioned ones only
+		// to the default version of the symbol
+		if symbol.Version != "" {
+			shared.exports[symbol.Name+"@"+symbol.Version] = symbol
+		}
+		if !symbol.HiddenVersion {
+			shared.exports[symbol.Name] = symbol
+		}
+	}
+
+	log.Debugf("Shared library %s exports %d symbols", shared.SOName, len(shared.exports))
+	linker.SharedLibraries = append(linker.SharedLibraries, shared)
+}
+
+// Binds the references that no relocatable input defines to the first library that exports them
+func (linker *Linker) resolveSharedSymbols() {
+	for name, router := range linker.Symbols {
+		if router.DefinedSymbol != nil {
+			continue
+		}
+
+		for _, library := range linker.SharedLibraries {
+			if symbol, found := library.exports[name]; found {
+				router.SharedSymbol = &SharedSymbol{Symbol: symbol, Library: library}
+				library.Used = true
+				break
+			}
+		}
+	}
+
+	linker.Needed = []string{}
+	for _, library := range linker.SharedLibraries {
+		if (library.Used || !linker.LinkerInputs.AsNeeded) && helpers.Find[string](linker.Needed, library.SOName) == -1 {
+			linker.Needed = append(linker.Needed, library.SOName)
+		}
+	}
+}
+
+// Returns true if nothing defines the symbol, weak references are allowed to stay undefined
+func (linker *Linker) isUndefined(name string) bool {
+	router, found := linker.Symbols[name]
+	if !found {
+		return true
+	}
+
+	return router.DefinedSymbol == nil && router.SharedSymbol == nil && router.SymbolType != SYM_WEAK
+}
+
+// Returns true if only weak references name the symbol and nothing defines it, its address is 0
+func (linker *Linker) isUndefinedWeak(name string) bool {
+	router, found := linker.Symbols[name]
+	return found && router.DefinedSymbol == nil && router.SharedSymbol == nil && router.SymbolType == SYM_WEAK
+}
+
+// Executables cannot keep undefined references, shared objects leave them to the dynamic loader
+// unless -z defs is given
+func (linker *Linker) checkUndefinedSymbols() error {
+	if linker.LinkerInputs.Shared && !linker.LinkerInputs.NoUndefined {
+		return nil
+	}
+
+	undefined := []string{}
+	for _, section := range linker.Executable.Sections {
+		for i := 0; i < len(section.Relocations); i++ {
+			relocation := section.Relocations[i]
+
+			switch relocation.GetType() {
+			case elf.R_X86_64_TLSGD, elf.R_X86_64_TLSLD:
+				// the call to __tls_get_addr does not survive the relaxation, shared objects
+				// keep the General and Local Dynamic sequences
+				if !linker.LinkerInputs.Shared {
+					i = linker.skipTLSGetAddr(section, i)
+				}
+			}
+
+			if relocation.SymbolName == "" || !linker.isUndefined(relocation.SymbolName) ||
+				helpers.Find[string](undefined, relocation.SymbolName) != -1 {
+				continue
+			}
+
+			undefined = append(undefined, relocation.SymbolName)
+		}
+	}
+
+	if len(undefined) != 0 {
+		return fmt.Errorf("%w: %s", UndefinedSymbolErr, strings.Join(undefined, ", "))
+	}
+
+	return nil
+}
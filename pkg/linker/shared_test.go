@@ -0,0 +1,103 @@
+package linker
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedLibrarySymbolResolution(t *testing.T) {
+	l := NewLinker(LinkerInputs{
+		Filenames:        []string{"../../data/sample_relocatable_uselib.o"},
+		DynamicLibraries: []string{"../../data/sample_shared_lib_other.so", "../../data/sample_shared_lib.so"},
+		AsNeeded:         true,
+	})
+
+	for _, inputFile := range append(l.LinkerInputs.Filenames, l.LinkerInputs.DynamicLibraries...) {
+		err := l.NewFile(inputFile)
+		assert.Truef(t, err == nil, "loading %s failed: %v", inputFile, err)
+	}
+
+	assert.Truef(t, len(l.InputObjects) == 1 && len(l.SharedLibraries) == 2, "shared libraries should not be relocatable inputs")
+
+	l.resolveSharedSymbols()
+
+	for _, name := range []string{"lib_func", "lib_var"} {
+		router := l.Symbols[name]
+		assert.Truef(t, router.SharedSymbol != nil && router.SharedSymbol.Library.SOName == "libsample.so.1",
+			"%s should be resolved by libsample.so.1", name)
+	}
+
+	// the default version is the one that binds unversioned references
+	assert.Truef(t, l.Symbols["lib_func"].SharedSymbol.Symbol.Version == "LIB_2.0", "lib_func should bind to lib_func@@LIB_2.0")
+
+	assert.Truef(t, !l.SharedLibraries[0].Used, "the file name of a library without soname is used")
+	assert.Truef(t, reflect.DeepEqual(l.Needed, []string{"libsample.so.1"}), "only used libraries are needed got=%v", l.Needed)
+	assert.Truef(t, l.checkUndefinedSymbols() == nil, "all references are resolved")
+}
+
+func TestSharedLibraryUndefinedSymbols(t *testing.T) {
+	_, err := Link(LinkerInputs{
+		Filenames:        []string{"../../data/sample_relocatable_uselib_missing.o"},
+		DynamicLibraries: []string{"../../data/sample_shared_lib.so"},
+		ExecutableName:   filepath.Join(t.TempDir(), "a.out"),
+	})
+
+	assert.Truef(t, errors.Is(err, UndefinedSymbolErr), "undefined reference not reported: %v", err)
+	assert.Truef(t, strings.Contains(err.Error(), "not_in_lib"), "not_in_lib should be reported: %v", err)
+	assert.Truef(t, !strings.Contains(err.Error(), "lib_func"), "lib_func is exported by the library: %v", err)
+	assert.Truef(t, !strings.Contains(err.Error(), "weak_ref"), "weak references can stay undefined: %v", err)
+}
+
+func TestAsNeeded(t *testing.T) {
+	inputs := LinkerInputs{
+		Filenames:        []string{"../../data/sample_relocatable_uselib.o"},
+		DynamicLibraries: []string{"../../data/sample_shared_lib_other.so", "../../data/sample_shared_lib.so"},
+		ExecutableName:   filepath.Join(t.TempDir(), "a.out"),
+	}
+
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, reflect.DeepEqual(l.Needed, []string{"sample_shared_lib_other.so", "libsample.so.1"}),
+		"all the libraries are needed by default got=%v", l.Needed)
+
+	inputs.AsNeeded = true
+	l, err = Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	assert.Truef(t, reflect.DeepEqual(l.Needed, []string{"libsample.so.1"}), "only used libraries are needed got=%v", l.Needed)
+}
+
+func TestSharedObjectUndefinedSymbols(t *testing.T) {
+	inputs := LinkerInputs{
+		Filenames:        []string{"../../data/sample_relocatable_uselib_missing.o"},
+		DynamicLibraries: []string{"../../data/sample_shared_lib.so"},
+		ExecutableName:   filepath.Join(t.TempDir(), "libmissing.so"),
+		Shared:           true,
+	}
+
+	_, err := Link(inputs)
+	assert.Truef(t, err == nil, "shared objects can keep undefined references: %v", err)
+
+	inputs.NoUndefined = true
+	_, err = Link(inputs)
+	assert.Truef(t, errors.Is(err, UndefinedSymbolErr), "undefined reference not reported with -z defs: %v", err)
+	assert.Truef(t, err != nil && strings.Contains(err.Error(), "not_in_lib"), "not_in_lib should be reported: %v", err)
+}
+
+func TestSharedObjectUndefinedTLSGetAddr(t *testing.T) {
+	inputs := LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_tls.o"},
+		ExecutableName: filepath.Join(t.TempDir(), "libtls.so"),
+		Shared:         true,
+		NoUndefined:    true,
+	}
+
+	// the General and Local Dynamic sequences are not relaxed, their calls stay
+	_, err := Link(inputs)
+	assert.Truef(t, errors.Is(err, UndefinedSymbolErr), "undefined reference not reported with -z defs: %v", err)
+	assert.Truef(t, err != nil && strings.Contains(err.Error(), "__tls_get_addr"), "__tls_get_addr should be reported: %v", err)
+}
@@ -0,0 +1,44 @@
+package linker
+
+import (
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+// Objects ask for an executable stack with an executable .note.GNU-stack section, the ones
+// without the section are assumed to need one as well
+func needsExecStack(objFile *elf.ELF64) (bool, string) {
+	for _, section := range objFile.Sections {
+		if section.Name == ".note.GNU-stack" {
+			return section.SectionEntry.ShFlags&elf.SHF_EXECINSTR != 0, "its .note.GNU-stack section is executable"
+		}
+	}
+
+	return true, "it has no .note.GNU-stack section"
+}
+
+// The stack is executable if an input needs it, unless -z noexecstack is given. The size of
+// the segment is the size of the stack of the main thread, 0 keeps the default.
+func (linker *Linker) stackSegment() elf.ELF64Phdr {
+	execStack := linker.LinkerInputs.ExecStack
+	if !execStack && !linker.LinkerInputs.NoExecStack {
+		for _, objFile := range linker.InputObjects {
+			if needed, reason := needsExecStack(objFile); needed {
+				log.Warnf("%s requires an executable stack because %s", objFile.Filename, reason)
+				execStack = true
+			}
+		}
+	}
+
+	flags := uint32(elf.PF_R | elf.PF_W)
+	if execStack {
+		flags |= elf.PF_X
+	}
+
+	return elf.ELF64Phdr{
+		Type:  elf.PT_GNU_STACK,
+		Flags: flags,
+		MemSz: linker.LinkerInputs.StackSize,
+		Align: 16,
+	}
+}
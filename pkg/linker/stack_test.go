@@ -0,0 +1,51 @@
+package linker
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackSegment(t *testing.T) {
+	objects := []string{
+		"../../data/sample_relocatable_symbols.o",
+		"../../data/sample_relocatable_symbols_defs.o",
+	}
+
+	for _, test := range []struct {
+		name      string
+		inputs    LinkerInputs
+		execStack bool
+	}{
+		{"non executable notes", LinkerInputs{Filenames: objects}, false},
+		{"executable note", LinkerInputs{Filenames: []string{"../../data/sample_relocatable_execstack.o"}}, true},
+		{"missing note", LinkerInputs{Filenames: append(objects, "../../data/sample_relocatable_nostack.o")}, true},
+		{"-z execstack", LinkerInputs{Filenames: objects, ExecStack: true}, true},
+		{"-z noexecstack", LinkerInputs{Filenames: []string{"../../data/sample_relocatable_execstack.o"}, NoExecStack: true}, false},
+	} {
+		test.inputs.ExecutableName = filepath.Join(t.TempDir(), "a.out")
+		l, err := Link(test.inputs)
+		assert.Truef(t, err == nil, "%s: link failed: %v", test.name, err)
+
+		var stack *elf.ELF64Phdr
+		for idx, phdr := range l.Executable.PhdrEntries {
+			if phdr.Type == elf.PT_GNU_STACK {
+				stack = &l.Executable.PhdrEntries[idx]
+			}
+		}
+		assert.Truef(t, stack != nil, "%s: PT_GNU_STACK should be emitted", test.name)
+		assert.Truef(t, stack.Flags&(elf.PF_R|elf.PF_W) == elf.PF_R|elf.PF_W, "%s: the stack should be writable", test.name)
+		assert.Truef(t, (stack.Flags&elf.PF_X != 0) == test.execStack, "%s: wrong stack permissions got=%x", test.name, stack.Flags)
+		assert.Truef(t, stack.MemSz == 0, "%s: the default stack size should be kept", test.name)
+	}
+
+	l, err := Link(LinkerInputs{Filenames: objects, ExecutableName: filepath.Join(t.TempDir(), "a.out"), StackSize: 0x800000})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+	for _, phdr := range l.Executable.PhdrEntries {
+		if phdr.Type == elf.PT_GNU_STACK {
+			assert.Truef(t, phdr.MemSz == 0x800000, "wrong stack size got=%x", phdr.MemSz)
+		}
+	}
+}
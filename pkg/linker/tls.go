@@ -0,0 +1,481 @@
+package linker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/andreistan26/golink/pkg/elf"
+)
+
+var (
+	UnsupportedTLSSequenceErr = errors.New("Unsupported TLS code sequence.")
+	NotPICErr                 = errors.New("Relocation can not be used when making a shared object")
+	NoTLSSegmentErr           = errors.New("Thread-local access without a TLS segment")
+)
+
+// TLSTemplate is the initialization image of a thread's TLS block, built from .tdata
+// followed by .tbss. It is described to the C runtime by the PT_TLS program header.
+type TLSTemplate struct {
+	Vaddr  uint64
+	Offset uint64
+	FileSz uint64
+	MemSz  uint64
+	Align  uint64
+}
+
+// Returns the TLS sections in the order they were laid out by SortSections
+func (linker *Linker) tlsSections() []*elf.Section {
+	sections := []*elf.Section{}
+	for _, section := range linker.Executable.Sections {
+		if section.SectionEntry.IsTLS() {
+			sections = append(sections, section)
+		}
+	}
+
+	return sections
+}
+
+// Builds the TLS template and the PT_TLS header, this needs to be called after the
+// sections have their final offsets
+func (linker *Linker) fillTLSSegment() {
+	sections := linker.tlsSections()
+	if len(sections) == 0 {
+		return
+	}
+
+	first := sections[0]
+	template := &TLSTemplate{
+		Vaddr:  linker.GetSectionVirtAddress(first),
+		Offset: first.SectionEntry.ShOff,
+		Align:  1,
+	}
+
+	for _, section := range sections {
+		end := linker.GetSectionVirtAddress(section) + section.SectionEntry.ShSize - template.Vaddr
+		if section.SectionEntry.ShType != elf.SHT_NOBITS {
+			template.FileSz = end
+		}
+		template.MemSz = end
+
+		if section.SectionEntry.ShAddrAlign > template.Align {
+			template.Align = section.SectionEntry.ShAddrAlign
+		}
+	}
+
+	// The thread pointer points right after the block, so the size has to keep
+	// the alignment of the block for the offsets to be computable at link time
+	template.MemSz = alignUp(template.MemSz, template.Align)
+	linker.TLS = template
+
+	if linker.tlsModuleBase != nil {
+		// DTPOFF is relative to the module base, in an executable the Local Dynamic sequences
+		// are relaxed to Local Exec where DTPOFF is relative to the thread pointer instead
+		base := template.Vaddr
+		if !linker.LinkerInputs.Shared {
+			base += template.MemSz
+		}
+
+		section := linker.Executable.Sections[linker.tlsModuleBase.BaseSymbol.StShNdx]
+		linker.tlsModuleBase.BaseSymbol.StValue = base - linker.GetSectionVirtAddress(section)
+	}
+
+	linker.Executable.PhdrEntries = append(linker.Executable.PhdrEntries, elf.ELF64Phdr{
+		Type:   elf.PT_TLS,
+		Flags:  elf.PF_R,
+		Offset: template.Offset,
+		Vaddr:  template.Vaddr,
+		Paddr:  template.Vaddr,
+		FileSz: template.FileSz,
+		MemSz:  template.MemSz,
+		Align:  template.Align,
+	})
+}
+
+// x86-64 uses TLS variant II, the block of the executable ends at the thread pointer
+// so every variable is at a negative offset from %fs:0
+func (linker *Linker) tpOffset(relocation *elf.Relocation, symAddr uint64) (uint64, error) {
+	if linker.TLS == nil {
+		return 0, fmt.Errorf("%w: %s is not a thread-local variable of the output", NoTLSSegmentErr, relocation.SymbolName)
+	}
+
+	return symAddr - (linker.TLS.Vaddr + linker.TLS.MemSz), nil
+}
+
+func isTLSRelocation(relType uint32) bool {
+	switch relType {
+	case elf.R_X86_64_TLSGD, elf.R_X86_64_TLSLD, elf.R_X86_64_DTPOFF32, elf.R_X86_64_DTPOFF64,
+		elf.R_X86_64_GOTTPOFF, elf.R_X86_64_TPOFF32, elf.R_X86_64_TPOFF64,
+		elf.R_X86_64_GOTPC32_TLSDESC, elf.R_X86_64_TLSDESC_CALL:
+		return true
+	}
+
+	return false
+}
+
+func tlsGOTEntryKind(relType uint32) GOTEntryKind {
+	switch relType {
+	case elf.R_X86_64_TLSLD:
+		return GOT_TLS_LD
+	case elf.R_X86_64_GOTTPOFF:
+		return GOT_TLS_IE
+	case elf.R_X86_64_GOTPC32_TLSDESC:
+		return GOT_TLS_DESC
+	}
+
+	return GOT_TLS_GD
+}
+
+// The TLS block of a shared object is only placed by the dynamic loader, so the accesses
+// go through GOT entries that are filled by dynamic relocations
+func (linker *Linker) scanTLSRelocation(relocation *elf.Relocation) error {
+	name := relocation.SymbolName
+	preemptible := linker.isPreemptible(name)
+
+	switch relocation.GetType() {
+	case elf.R_X86_64_TLSGD:
+		entry, isNew := linker.got().Allocate(GOT_TLS_GD, name)
+		if !isNew {
+			break
+		}
+
+		if preemptible {
+			linker.addDynamicRelocation(&DynamicRelocation{
+				Section: linker.GOT.Section, Offset: entry.Offset, Type: elf.R_X86_64_DTPMOD64, SymbolName: name,
+			})
+			linker.addDynamicRelocation(&DynamicRelocation{
+				Section: linker.GOT.Section, Offset: entry.Offset + 8, Type: elf.R_X86_64_DTPOFF64, SymbolName: name,
+			})
+		} else {
+			// the offset in the block is written by fillGOT, only the module id is left for the loader
+			linker.addDynamicRelocation(&DynamicRelocation{
+				Section: linker.GOT.Section, Offset: entry.Offset, Type: elf.R_X86_64_DTPMOD64,
+			})
+		}
+	case elf.R_X86_64_TLSLD:
+		entry, isNew := linker.got().Allocate(GOT_TLS_LD, "")
+		if isNew {
+			linker.addDynamicRelocation(&DynamicRelocation{
+				Section: linker.GOT.Section, Offset: entry.Offset, Type: elf.R_X86_64_DTPMOD64,
+			})
+		}
+	case elf.R_X86_64_GOTTPOFF:
+		// the module has to be loaded with the executable for its block to be at a fixed offset from the
+		// thread pointer, it can not be dlopen-ed
+		linker.DynamicFlags |= elf.DF_STATIC_TLS
+
+		entry, isNew := linker.got().Allocate(GOT_TLS_IE, name)
+		if isNew {
+			linker.addDynamicRelocation(linker.tlsDynamicRelocation(entry, elf.R_X86_64_TPOFF64, preemptible))
+		}
+	case elf.R_X86_64_GOTPC32_TLSDESC:
+		entry, isNew := linker.got().Allocate(GOT_TLS_DESC, name)
+		if isNew {
+			linker.addDynamicRelocation(linker.tlsDynamicRelocation(entry, elf.R_X86_64_TLSDESC, preemptible))
+		}
+	case elf.R_X86_64_DTPOFF32, elf.R_X86_64_DTPOFF64:
+		if preemptible {
+			return fmt.Errorf("%w: DTPOFF against %s", UndefinedSymbolErr, name)
+		}
+	case elf.R_X86_64_TPOFF32, elf.R_X86_64_TPOFF64:
+		return fmt.Errorf("%w: Local Exec TLS access to %s, recompile with -fPIC", NotPICErr, name)
+	}
+
+	return nil
+}
+
+// The offset of the variables of a shared library from the thread pointer is only known at
+// runtime, an executable relaxes the GD and TLSDESC accesses to them to Initial Exec, which
+// loads the offset from a GOT entry filled by R_X86_64_TPOFF64. The library has to be loaded
+// with the executable for its block to be at a fixed offset.
+func (linker *Linker) scanImportedTLSRelocation(relocation *elf.Relocation) error {
+	name := relocation.SymbolName
+
+	switch relocation.GetType() {
+	case elf.R_X86_64_TLSGD, elf.R_X86_64_GOTPC32_TLSDESC, elf.R_X86_64_GOTTPOFF:
+		linker.DynamicFlags |= elf.DF_STATIC_TLS
+
+		entry, isNew := linker.got().Allocate(GOT_TLS_IE, name)
+		if isNew {
+			linker.addDynamicRelocation(&DynamicRelocation{
+				Section: linker.GOT.Section, Offset: entry.Offset, Type: elf.R_X86_64_TPOFF64, SymbolName: name,
+			})
+		}
+	case elf.R_X86_64_TLSDESC_CALL:
+		// relaxed with the load of the descriptor
+	default:
+		return fmt.Errorf("%w: TLS relocation %d against %s", ImportedSymbolRelocationErr, relocation.GetType(), name)
+	}
+
+	return nil
+}
+
+func (linker *Linker) isImportedTLS(relocation *elf.Relocation) bool {
+	switch relocation.GetType() {
+	case elf.R_X86_64_TLSGD, elf.R_X86_64_GOTPC32_TLSDESC, elf.R_X86_64_GOTTPOFF:
+		return relocation.SymbolName != "" && !isSectionRelocation(relocation) && linker.isImported(relocation.SymbolName)
+	}
+
+	return false
+}
+
+// Points the Initial Exec sequences of an executable to the GOT entry of the imported variable
+func (linker *Linker) applyImportedTLSRelocation(section *elf.Section, relocation *elf.Relocation) error {
+	entry := linker.GOT.Find(GOT_TLS_IE, relocation.SymbolName)
+	if entry == nil {
+		return fmt.Errorf("No GOT entry was allocated for the TLS relocation against %s", relocation.SymbolName)
+	}
+
+	GOT := linker.GetSectionVirtAddress(linker.GOT.Section) + entry.Offset
+	P := linker.GetSectionVirtAddress(section) + relocation.Offset
+	V := GOT + relocation.Addend - P
+
+	switch relocation.GetType() {
+	case elf.R_X86_64_TLSGD:
+		// the displacement is 8 bytes further in the rewritten sequence
+		return relaxTLSGDToIE(section.Data, relocation.Offset, V-8)
+	case elf.R_X86_64_GOTPC32_TLSDESC:
+		return relaxTLSDescToIE(section.Data, relocation.Offset, V)
+	}
+
+	binary.LittleEndian.PutUint32(section.Data[relocation.Offset:], uint32(V))
+	return nil
+}
+
+// A relocation against the symbol when it is preemptible, otherwise one relative to this
+// module with the offset of the variable as addend
+func (linker *Linker) tlsDynamicRelocation(entry *GOTEntry, relType uint32, preemptible bool) *DynamicRelocation {
+	relocation := &DynamicRelocation{
+		Section: linker.GOT.Section,
+		Offset:  entry.Offset,
+		Type:    relType,
+	}
+
+	if preemptible {
+		relocation.SymbolName = entry.SymbolName
+	} else {
+		relocation.AddendSymbol = entry.SymbolName
+	}
+
+	return relocation
+}
+
+func (linker *Linker) applyDynamicTLSRelocation(section *elf.Section, relocation *elf.Relocation) error {
+	A := relocation.Addend
+	P := linker.GetSectionVirtAddress(section) + relocation.Offset
+
+	switch relocation.GetType() {
+	case elf.R_X86_64_TLSDESC_CALL:
+		// the call goes through the descriptor resolved by the loader
+		return nil
+	case elf.R_X86_64_DTPOFF32, elf.R_X86_64_DTPOFF64:
+		symbol, err := linker.resolveSymbol(relocation.SymbolName)
+		if err != nil {
+			return err
+		}
+
+		V := linker.GetSymbolVirtAddress(symbol) - linker.TLS.Vaddr + A
+		if relocation.GetType() == elf.R_X86_64_DTPOFF32 {
+			binary.LittleEndian.PutUint32(section.Data[relocation.Offset:], uint32(V))
+		} else {
+			binary.LittleEndian.PutUint64(section.Data[relocation.Offset:], V)
+		}
+		return nil
+	}
+
+	name := relocation.SymbolName
+	if relocation.GetType() == elf.R_X86_64_TLSLD {
+		name = ""
+	}
+
+	entry := linker.GOT.Find(tlsGOTEntryKind(relocation.GetType()), name)
+	if entry == nil {
+		return fmt.Errorf("No GOT entry was allocated for the TLS relocation against %s", relocation.SymbolName)
+	}
+
+	V := linker.GetSectionVirtAddress(linker.GOT.Section) + entry.Offset + A - P
+	binary.LittleEndian.PutUint32(section.Data[relocation.Offset:], uint32(V))
+
+	return nil
+}
+
+// The relocation of the call to __tls_get_addr that follows a relaxed GD or LD sequence
+// points into the rewritten instructions, so it must not be applied
+func (linker *Linker) skipTLSGetAddr(section *elf.Section, ndx int) int {
+	if ndx+1 < len(section.Relocations) && section.Relocations[ndx+1].SymbolName == "__tls_get_addr" {
+		return ndx + 1
+	}
+
+	return ndx
+}
+
+// Relaxes a General Dynamic sequence to Local Exec
+//
+//	66 48 8d 3d XX XX XX XX    data16 lea x@tlsgd(%rip), %rdi
+//	66 66 48 e8 XX XX XX XX    data16 data16 rex64 call __tls_get_addr@plt
+//
+// becomes
+//
+//	64 48 8b 04 25 00 00 00 00 mov %fs:0, %rax
+//	48 8d 80 XX XX XX XX       lea x@tpoff(%rax), %rax
+func relaxTLSGDToLE(data []byte, offset uint64, tpoff uint64) error {
+	if offset < 4 || uint64(len(data)) < offset+12 ||
+		data[offset-4] != 0x66 || data[offset-3] != 0x48 || data[offset-2] != 0x8d || data[offset-1] != 0x3d ||
+		data[offset+4] != 0x66 || data[offset+5] != 0x66 || data[offset+6] != 0x48 || data[offset+7] != 0xe8 {
+		return fmt.Errorf("%w: TLSGD at 0x%x", UnsupportedTLSSequenceErr, offset)
+	}
+
+	copy(data[offset-4:], []byte{
+		0x64, 0x48, 0x8b, 0x04, 0x25, 0x00, 0x00, 0x00, 0x00,
+		0x48, 0x8d, 0x80,
+	})
+	binary.LittleEndian.PutUint32(data[offset+8:], uint32(tpoff))
+
+	return nil
+}
+
+// Relaxes a General Dynamic sequence to Initial Exec
+//
+//	66 48 8d 3d XX XX XX XX    data16 lea x@tlsgd(%rip), %rdi
+//	66 66 48 e8 XX XX XX XX    data16 data16 rex64 call __tls_get_addr@plt
+//
+// becomes
+//
+//	64 48 8b 04 25 00 00 00 00 mov %fs:0, %rax
+//	48 03 05 XX XX XX XX       add x@gottpoff(%rip), %rax
+func relaxTLSGDToIE(data []byte, offset uint64, gotOffset uint64) error {
+	if err := relaxTLSGDToLE(data, offset, gotOffset); err != nil {
+		return err
+	}
+
+	data[offset+6] = 0x03
+	data[offset+7] = 0x05
+
+	return nil
+}
+
+// Relaxes a Local Dynamic sequence to Local Exec, the variables are then accessed
+// with their DTPOFF relocations relative to %rax which now holds the thread pointer
+//
+//	48 8d 3d XX XX XX XX       lea x@tlsld(%rip), %rdi
+//	e8 XX XX XX XX             call __tls_get_addr@plt
+//
+// becomes
+//
+//	66 66 66 64 48 8b 04 25 00 00 00 00 data16 data16 data16 mov %fs:0, %rax
+func relaxTLSLDToLE(data []byte, offset uint64) error {
+	if offset < 3 || uint64(len(data)) < offset+9 ||
+		data[offset-3] != 0x48 || data[offset-2] != 0x8d || data[offset-1] != 0x3d || data[offset+4] != 0xe8 {
+		return fmt.Errorf("%w: TLSLD at 0x%x", UnsupportedTLSSequenceErr, offset)
+	}
+
+	copy(data[offset-3:], []byte{
+		0x66, 0x66, 0x66, 0x64, 0x48, 0x8b, 0x04, 0x25, 0x00, 0x00, 0x00, 0x00,
+	})
+
+	return nil
+}
+
+// Relaxes an Initial Exec load of the TP offset from the GOT to an immediate
+//
+//	mov x@gottpoff(%rip), %reg  ->  mov $x@tpoff, %reg
+//	add x@gottpoff(%rip), %reg  ->  add $x@tpoff, %reg
+func relaxGOTTPOFFToLE(data []byte, offset uint64, tpoff uint64) error {
+	if offset < 3 || uint64(len(data)) < offset+4 {
+		return fmt.Errorf("%w: GOTTPOFF at 0x%x", UnsupportedTLSSequenceErr, offset)
+	}
+
+	prefix, opcode, modrm := &data[offset-3], &data[offset-2], &data[offset-1]
+	reg := (*modrm >> 3) & 7
+
+	// only %rip relative addressing can be relaxed
+	if (*prefix != 0x48 && *prefix != 0x4c) || *modrm&0xc7 != 0x05 {
+		return fmt.Errorf("%w: GOTTPOFF at 0x%x", UnsupportedTLSSequenceErr, offset)
+	}
+
+	switch *opcode {
+	case 0x8b:
+		if *prefix == 0x4c {
+			*prefix = 0x49
+		}
+		*opcode = 0xc7
+		*modrm = 0xc0 | reg
+	case 0x03:
+		if *prefix == 0x4c {
+			*prefix = 0x49
+		}
+		*opcode = 0x81
+		*modrm = 0xc0 | reg
+	default:
+		return fmt.Errorf("%w: GOTTPOFF at 0x%x", UnsupportedTLSSequenceErr, offset)
+	}
+
+	binary.LittleEndian.PutUint32(data[offset:], uint32(tpoff))
+	return nil
+}
+
+// Relaxes the load of a TLS descriptor address to Local Exec
+//
+//	48 8d 05 XX XX XX XX       lea x@tlsdesc(%rip), %rax
+//
+// becomes
+//
+//	48 c7 c0 XX XX XX XX       mov $x@tpoff, %rax
+func relaxTLSDescToLE(data []byte, offset uint64, tpoff uint64) error {
+	if offset < 3 || uint64(len(data)) < offset+4 ||
+		(data[offset-3] != 0x48 && data[offset-3] != 0x4c) || data[offset-2] != 0x8d || data[offset-1]&0xc7 != 0x05 {
+		return fmt.Errorf("%w: GOTPC32_TLSDESC at 0x%x", UnsupportedTLSSequenceErr, offset)
+	}
+
+	data[offset-3] = 0x48 | ((data[offset-3] >> 2) & 1)
+	data[offset-2] = 0xc7
+	data[offset-1] = 0xc0 | ((data[offset-1] >> 3) & 7)
+	binary.LittleEndian.PutUint32(data[offset:], uint32(tpoff))
+
+	return nil
+}
+
+// Relaxes the load of a TLS descriptor address to a load of the TP offset from the GOT
+//
+//	48 8d 05 XX XX XX XX       lea x@tlsdesc(%rip), %rax
+//
+// becomes
+//
+//	48 8b 05 XX XX XX XX       mov x@gottpoff(%rip), %rax
+func relaxTLSDescToIE(data []byte, offset uint64, gotOffset uint64) error {
+	if offset < 3 || uint64(len(data)) < offset+4 ||
+		(data[offset-3] != 0x48 && data[offset-3] != 0x4c) || data[offset-2] != 0x8d || data[offset-1]&0xc7 != 0x05 {
+		return fmt.Errorf("%w: GOTPC32_TLSDESC at 0x%x", UnsupportedTLSSequenceErr, offset)
+	}
+
+	data[offset-2] = 0x8b
+	binary.LittleEndian.PutUint32(data[offset:], uint32(gotOffset))
+
+	return nil
+}
+
+// The call through the descriptor is no longer needed once the offset is known
+//
+//	ff 10                      call *x@tlscall(%rax)
+//
+// becomes
+//
+//	66 90                      xchg %ax, %ax
+func relaxTLSDescCall(data []byte, offset uint64) error {
+	if uint64(len(data)) < offset+2 || data[offset] != 0xff || data[offset+1] != 0x10 {
+		return fmt.Errorf("%w: TLSDESC_CALL at 0x%x", UnsupportedTLSSequenceErr, offset)
+	}
+
+	data[offset] = 0x66
+	data[offset+1] = 0x90
+
+	return nil
+}
+
+func alignUp(value, align uint64) uint64 {
+	if align <= 1 {
+		return value
+	}
+
+	return (value + align - 1) &^ (align - 1)
+}
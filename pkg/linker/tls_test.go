@@ -0,0 +1,200 @@
+package linker
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSTemplate(t *testing.T) {
+	filenames := []string{
+		"../../data/sample_relocatable_tls.o",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(t.TempDir(), "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	var tlsPhdr *elf.ELF64Phdr
+	for idx := range l.Executable.PhdrEntries {
+		if l.Executable.PhdrEntries[idx].Type == elf.PT_TLS {
+			tlsPhdr = &l.Executable.PhdrEntries[idx]
+		}
+	}
+
+	assert.Truef(t, tlsPhdr != nil, "no PT_TLS program header")
+	assert.Truef(t, int(l.Executable.Header.PhNum) == len(l.Executable.PhdrEntries), "PhNum does not match the program headers")
+
+	tdata := l.Executable.MappedSections[".tdata"]
+	tbss := l.Executable.MappedSections[".tbss"]
+	assert.Truef(t, tlsPhdr.Vaddr == l.GetSectionVirtAddress(tdata), "PT_TLS should start at .tdata")
+	assert.Truef(t, tlsPhdr.FileSz == tdata.SectionEntry.ShSize, "PT_TLS file size should cover .tdata, got=%d", tlsPhdr.FileSz)
+	assert.Truef(t, tlsPhdr.MemSz >= tdata.SectionEntry.ShSize+tbss.SectionEntry.ShSize, "PT_TLS memory size should cover .tbss")
+	assert.Truef(t, tlsPhdr.MemSz%tlsPhdr.Align == 0, "PT_TLS memory size should be aligned")
+}
+
+func TestTLSGDRelaxation(t *testing.T) {
+	filenames := []string{
+		"../../data/sample_relocatable_tls.o",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(t.TempDir(), "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	text := l.Executable.MappedSections[".text"]
+	for _, relocation := range text.Relocations {
+		if relocation.GetType() != elf.R_X86_64_TLSGD {
+			continue
+		}
+
+		sequence := text.Data[relocation.Offset-4 : relocation.Offset+12]
+		assert.Truef(t, reflect.DeepEqual(sequence[:12], []byte{
+			0x64, 0x48, 0x8b, 0x04, 0x25, 0x00, 0x00, 0x00, 0x00, 0x48, 0x8d, 0x80,
+		}), "GD sequence for %s was not relaxed: %x", relocation.SymbolName, sequence)
+
+		S := l.GetSymbolVirtAddress(l.Symbols[relocation.SymbolName].DefinedSymbol.Symbol)
+		tpoff := binary.LittleEndian.Uint32(sequence[12:])
+		assert.Truef(t, tpoff == uint32(S-(l.TLS.Vaddr+l.TLS.MemSz)),
+			"wrong TP offset for %s got=%x", relocation.SymbolName, tpoff)
+		assert.Truef(t, int32(tpoff) < 0, "TP offset of %s should be negative", relocation.SymbolName)
+	}
+}
+
+func TestGOTTPOFFRelaxation(t *testing.T) {
+	// mov x@gottpoff(%rip), %rax; add x@gottpoff(%rip), %r12; mov x@gottpoff(%rip), %r9
+	data := []byte{
+		0x48, 0x8b, 0x05, 0x00, 0x00, 0x00, 0x00,
+		0x4c, 0x03, 0x25, 0x00, 0x00, 0x00, 0x00,
+		0x4c, 0x8b, 0x0d, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	for _, offset := range []uint64{3, 10, 17} {
+		assert.Nil(t, relaxGOTTPOFFToLE(data, offset, 0xfffffff0))
+	}
+
+	assert.Truef(t, reflect.DeepEqual(data, []byte{
+		0x48, 0xc7, 0xc0, 0xf0, 0xff, 0xff, 0xff, // mov $-0x10, %rax
+		0x49, 0x81, 0xc4, 0xf0, 0xff, 0xff, 0xff, // add $-0x10, %r12
+		0x49, 0xc7, 0xc1, 0xf0, 0xff, 0xff, 0xff, // mov $-0x10, %r9
+	}), "GOTTPOFF relaxation got=%x", data)
+
+	assert.NotNil(t, relaxGOTTPOFFToLE([]byte{0x48, 0x33, 0x05, 0, 0, 0, 0}, 3, 0), "xor can not be relaxed")
+}
+
+func TestTLSSharedObject(t *testing.T) {
+	filenames := []string{
+		"../../data/sample_relocatable_tls_desc.o",
+		"../../data/sample_relocatable_tls_ie.o",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(t.TempDir(), "a.so"), Shared: true})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	assert.Truef(t, l.DynamicFlags&elf.DF_STATIC_TLS != 0, "IE access should set DF_STATIC_TLS")
+
+	// the entries of the undefined tls_c and of the exported tls_a and tls_e reference the symbol,
+	// the ones of _TLS_MODULE_BASE_ are relative to the module
+	refRelocations := map[GOTEntryKind]map[string]uint32{
+		GOT_TLS_DESC: {"_TLS_MODULE_BASE_": elf.R_X86_64_TLSDESC, "tls_a": elf.R_X86_64_TLSDESC, "tls_c": elf.R_X86_64_TLSDESC},
+		GOT_TLS_IE:   {"tls_e": elf.R_X86_64_TPOFF64, "tls_c": elf.R_X86_64_TPOFF64},
+	}
+
+	assert.Truef(t, len(l.DynamicRelocations) == 5, "wrong dynamic relocation count got=%d", len(l.DynamicRelocations))
+	assert.Truef(t, len(l.Executable.MappedSections[".rela.dyn"].Data) == 5*0x18, "wrong .rela.dyn size")
+
+	for kind, symbols := range refRelocations {
+		for name, relType := range symbols {
+			entry := l.GOT.Find(kind, name)
+			assert.Truef(t, entry != nil, "no GOT entry for %s", name)
+
+			found := false
+			for _, relocation := range l.DynamicRelocations {
+				if relocation.Offset != entry.Offset {
+					continue
+				}
+
+				found = true
+				assert.Truef(t, relocation.Type == relType, "wrong relocation type for %s", name)
+				if name != "_TLS_MODULE_BASE_" {
+					assert.Truef(t, relocation.SymbolName == name, "%s is preemptible", name)
+				} else {
+					assert.Truef(t, relocation.SymbolName == "" && relocation.AddendSymbol == name, "%s is not preemptible", name)
+				}
+			}
+			assert.Truef(t, found, "no dynamic relocation for the GOT entry of %s", name)
+		}
+	}
+
+	text := l.Executable.MappedSections[".text"]
+	for _, relocation := range text.Relocations {
+		switch relocation.GetType() {
+		case elf.R_X86_64_GOTPC32_TLSDESC, elf.R_X86_64_GOTTPOFF:
+			entry := l.GOT.Find(tlsGOTEntryKind(relocation.GetType()), relocation.SymbolName)
+			P := l.GetSectionVirtAddress(text) + relocation.Offset
+			V := binary.LittleEndian.Uint32(text.Data[relocation.Offset:])
+			assert.Truef(t, V == uint32(l.GetSectionVirtAddress(l.GOT.Section)+entry.Offset+relocation.Addend-P),
+				"wrong GOT displacement for %s", relocation.SymbolName)
+		case elf.R_X86_64_DTPOFF32:
+			S := l.GetSymbolVirtAddress(l.Symbols[relocation.SymbolName].DefinedSymbol.Symbol)
+			V := binary.LittleEndian.Uint32(text.Data[relocation.Offset:])
+			assert.Truef(t, V == uint32(S-l.TLS.Vaddr+relocation.Addend), "wrong DTPOFF for %s", relocation.SymbolName)
+		}
+	}
+}
+
+func TestTLSSharedObjectLocalExec(t *testing.T) {
+	l := NewLinker(LinkerInputs{Shared: true})
+
+	err := l.scanTLSRelocation(&elf.Relocation{Info: elf.R_X86_64_TPOFF32, SymbolName: "tls_a"})
+	assert.ErrorIs(t, err, NotPICErr)
+}
+
+func TestTLSImportedVariable(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_tls_imported.o",
+		"../../data/sample_shared_lib_imports.so",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the GD, TLSDESC and IE accesses to lib_tls share an Initial Exec entry filled by the loader
+	assert.Truef(t, l.TLS == nil, "the executable has no TLS block of its own")
+	assert.Truef(t, l.DynamicFlags&elf.DF_STATIC_TLS != 0, "IE access should set DF_STATIC_TLS")
+	entry := l.GOT.Find(GOT_TLS_IE, "lib_tls")
+	assert.Truef(t, entry != nil && len(l.GOT.Entries) == 1, "lib_tls should have a single IE entry")
+	tpoff := 0
+	for _, relocation := range l.DynamicRelocations {
+		if relocation.Type == elf.R_X86_64_TPOFF64 {
+			tpoff++
+			assert.Truef(t, relocation.SymbolName == "lib_tls" && relocation.Offset == entry.Offset, "wrong TPOFF64 relocation")
+		}
+	}
+	assert.Truef(t, tpoff == 1, "lib_tls should have a TPOFF64 relocation got=%d", tpoff)
+
+	// a Local Exec access needs a variable of the output
+	l = NewLinker(LinkerInputs{})
+	_, err = l.tpOffset(&elf.Relocation{Info: elf.R_X86_64_TPOFF32, SymbolName: "lib_tls"}, 0)
+	assert.ErrorIs(t, err, NoTLSSegmentErr)
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile("../../data/sample_shared_lib_imports.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libimports.so"), library, 0755) == nil, "writing the library failed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+
+	// three reads of the initial value, then the library reads the one stored by the executable
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 7*3+10, "wrong exit code: %v", err)
+}
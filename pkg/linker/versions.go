@@ -0,0 +1,360 @@
+package linker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/elf"
+)
+
+var UnmatchedVersionPatternErr = errors.New("Version script pattern matches no definition")
+
+// The versions of the dynamic symbols. .gnu.version holds the version index of each dynamic
+// symbol, .gnu.version_d lists the versions defined by the output and .gnu.version_r the
+// versions needed from each library, so that the dynamic loader binds the references to the
+// definitions they were linked against.
+type SymbolVersions struct {
+	VerSym  *elf.Section
+	VerDef  *elf.Section
+	VerNeed *elf.Section
+	// versions of the version script, their index follows the one of the base version
+	Defined []string
+	Needed  []*VersionNeed
+}
+
+// Versions needed from a library, in the order they were first referenced
+type VersionNeed struct {
+	SOName   string
+	Versions []string
+	// version index of each version name
+	indices map[string]uint16
+}
+
+// Definitions named foo@@VER are the default version of foo, they satisfy the unversioned
+// references. The ones named foo@VER keep their name, they are only bound by references with
+// the same version.
+func setDefinitionVersion(symbol *elf.Symbol) {
+	if symbol.BaseSymbol.StShNdx == elf.SHN_UNDEF {
+		return
+	}
+
+	if name, version, found := strings.Cut(symbol.Name, "@@"); found {
+		symbol.Name = name
+		symbol.Version = version
+	} else if _, version, found := strings.Cut(symbol.Name, "@"); found {
+		symbol.Version = version
+		symbol.HiddenVersion = true
+	}
+}
+
+// The name of a dynamic symbol without its version
+func unversionedName(name string) string {
+	base, _, _ := strings.Cut(name, "@")
+	return base
+}
+
+// The library and the version that an imported symbol is bound to
+func (linker *Linker) importedVersion(name string) (*SharedSymbol, bool) {
+	router, found := linker.Symbols[name]
+	if !found || router.DefinedSymbol != nil || router.SharedSymbol == nil || router.SharedSymbol.Symbol.Version == "" {
+		return nil, false
+	}
+
+	return router.SharedSymbol, true
+}
+
+// Localizes the definitions that the version script does not export and versions the others
+// with the node that exports them. The definitions versioned by their name have to use a
+// version of the script.
+func (linker *Linker) applyVersionScript() error {
+	if linker.LinkerInputs.VersionScript == "" {
+		return nil
+	}
+
+	script, err := ReadVersionScript(linker.LinkerInputs.VersionScript)
+	if err != nil {
+		return err
+	}
+	linker.VersionScript = script
+
+	names := make([]string, 0, len(linker.Symbols))
+	for name := range linker.Symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		router := linker.Symbols[name]
+		if router.DefinedSymbol == nil || router.DefinedSymbol.Elf == nil ||
+			router.DefinedSymbol.Symbol.BaseSymbol.GetBinding() == elf.STB_LOCAL {
+			continue
+		}
+
+		symbol := router.DefinedSymbol.Symbol
+		if symbol.Version != "" {
+			if script.findNode(symbol.Version) == nil {
+				return fmt.Errorf("%w: %s of %s", UndefinedVersionErr, symbol.Version, name)
+			}
+			continue
+		}
+
+		node, global, found := script.assign(name)
+		switch {
+		case !found:
+			continue
+		case !global:
+			// the definition is not exported and is local in the symbol table too
+			router.Local = true
+			symbol.BaseSymbol.SetBinding(elf.STB_LOCAL)
+		default:
+			symbol.Version = node.Name
+		}
+	}
+
+	if linker.LinkerInputs.NoUndefinedVersion {
+		for _, node := range script.Nodes {
+			for _, pattern := range node.Global {
+				if !pattern.matched {
+					return fmt.Errorf("%w: %s in %s", UnmatchedVersionPatternErr, pattern.Pattern, node.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Assigns the version indices and creates .gnu.version, .gnu.version_d and .gnu.version_r,
+// the names are added to .dynstr
+func (linker *Linker) createVersionSections() {
+	versions := &SymbolVersions{}
+	if linker.VersionScript != nil {
+		versions.Defined = linker.VersionScript.versionNames()
+	}
+	nextIndex := uint16(elf.VER_NDX_GLOBAL + 1 + len(versions.Defined))
+
+	addNeed := func(soname string, version string) {
+		var need *VersionNeed
+		for _, candidate := range versions.Needed {
+			if candidate.SOName == soname {
+				need = candidate
+			}
+		}
+		if need == nil {
+			need = &VersionNeed{SOName: soname, indices: make(map[string]uint16)}
+			versions.Needed = append(versions.Needed, need)
+		}
+
+		if _, found := need.indices[version]; !found {
+			need.Versions = append(need.Versions, version)
+			need.indices[version] = nextIndex
+			nextIndex++
+		}
+	}
+
+	for _, name := range linker.DynamicSymbols {
+		if shared, found := linker.importedVersion(name); found {
+			addNeed(shared.Library.SOName, shared.Symbol.Version)
+		}
+	}
+
+	for _, library := range linker.relrVersionProviders() {
+		addNeed(library.SOName, GlibcRelrVersion)
+	}
+
+	if len(versions.Needed) == 0 && len(versions.Defined) == 0 {
+		return
+	}
+
+	dynamic := linker.Dynamic
+	versions.VerSym = linker.addSyntheticSection(".gnu.version", elf.SHT_GNU_versym, elf.SHF_ALLOC, 2, 2)
+	versions.VerSym.Data = make([]byte, 2*(len(linker.DynamicSymbols)+1))
+	versions.VerSym.SectionEntry.ShSize = uint64(len(versions.VerSym.Data))
+	dynamic.addEntry(elf.DT_VERSYM, 0)
+
+	if len(versions.Defined) != 0 {
+		dynamic.addString(linker.baseVersionName())
+		for _, version := range versions.Defined {
+			dynamic.addString(version)
+		}
+
+		// the base version, then every version with its parent
+		size := 0x14 + 0x8
+		for _, version := range versions.Defined {
+			size += 0x14 + 0x8*len(linker.versionDefinitionNames(version))
+		}
+
+		versions.VerDef = linker.addSyntheticSection(".gnu.version_d", elf.SHT_GNU_verdef, elf.SHF_ALLOC, 8, 0)
+		versions.VerDef.Data = make([]byte, size)
+		versions.VerDef.SectionEntry.ShSize = uint64(size)
+		versions.VerDef.SectionEntry.ShInfo = uint32(len(versions.Defined) + 1)
+
+		dynamic.addEntry(elf.DT_VERDEF, 0)
+		dynamic.addEntry(elf.DT_VERDEFNUM, uint64(len(versions.Defined)+1))
+	}
+
+	if len(versions.Needed) != 0 {
+		size := 0
+		for _, need := range versions.Needed {
+			dynamic.addString(need.SOName)
+			for _, version := range need.Versions {
+				dynamic.addString(version)
+			}
+			size += 0x10 + 0x10*len(need.Versions)
+		}
+
+		versions.VerNeed = linker.addSyntheticSection(".gnu.version_r", elf.SHT_GNU_verneed, elf.SHF_ALLOC, 8, 0)
+		versions.VerNeed.Data = make([]byte, size)
+		versions.VerNeed.SectionEntry.ShSize = uint64(size)
+		versions.VerNeed.SectionEntry.ShInfo = uint32(len(versions.Needed))
+
+		dynamic.addEntry(elf.DT_VERNEED, 0)
+		dynamic.addEntry(elf.DT_VERNEEDNUM, uint64(len(versions.Needed)))
+	}
+
+	dynamic.Versions = versions
+}
+
+// The base version is named after the output
+func (linker *Linker) baseVersionName() string {
+	if linker.LinkerInputs.SOName != "" {
+		return linker.LinkerInputs.SOName
+	}
+
+	return filepath.Base(linker.Executable.Filename)
+}
+
+// The names of a version definition, the version itself followed by its parent
+func (linker *Linker) versionDefinitionNames(version string) []string {
+	names := []string{version}
+	if parent := linker.VersionScript.findNode(version).Parent; parent != "" {
+		names = append(names, parent)
+	}
+
+	return names
+}
+
+// The .gnu.version index of a dynamic symbol. Definitions that are not versioned are global,
+// the hidden ones are not bound by unversioned references.
+func (linker *Linker) versionIndex(name string) uint16 {
+	versions := linker.Dynamic.Versions
+
+	if router := linker.Symbols[name]; router != nil && router.DefinedSymbol != nil {
+		symbol := router.DefinedSymbol.Symbol
+		for idx, version := range versions.Defined {
+			if version == symbol.Version {
+				index := uint16(elf.VER_NDX_GLOBAL + 1 + idx)
+				if symbol.HiddenVersion {
+					index |= elf.VERSYM_HIDDEN
+				}
+				return index
+			}
+		}
+
+		return elf.VER_NDX_GLOBAL
+	}
+
+	if shared, found := linker.importedVersion(name); found {
+		for _, need := range versions.Needed {
+			if need.SOName == shared.Library.SOName {
+				return need.indices[shared.Symbol.Version]
+			}
+		}
+	}
+
+	return elf.VER_NDX_GLOBAL
+}
+
+// Serializes the version sections
+func (linker *Linker) fillVersionSections() {
+	versions := linker.Dynamic.Versions
+	if versions == nil {
+		return
+	}
+
+	for idx, name := range linker.DynamicSymbols {
+		binary.LittleEndian.PutUint16(versions.VerSym.Data[2*(idx+1):], linker.versionIndex(name))
+	}
+
+	if versions.VerDef != nil {
+		linker.fillVersionDefinitions()
+	}
+
+	if versions.VerNeed != nil {
+		linker.fillVersionNeeds()
+	}
+}
+
+func (linker *Linker) fillVersionDefinitions() {
+	dynamic := linker.Dynamic
+	versions := dynamic.Versions
+
+	definitions := [][]string{{linker.baseVersionName()}}
+	for _, version := range versions.Defined {
+		definitions = append(definitions, linker.versionDefinitionNames(version))
+	}
+
+	offset := 0
+	for idx, names := range definitions {
+		entry := versions.VerDef.Data[offset:]
+		size := 0x14 + 0x8*len(names)
+
+		flags := uint16(0)
+		if idx == 0 {
+			flags = elf.VER_FLG_BASE
+		}
+
+		binary.LittleEndian.PutUint16(entry, 1)
+		binary.LittleEndian.PutUint16(entry[0x2:], flags)
+		binary.LittleEndian.PutUint16(entry[0x4:], uint16(elf.VER_NDX_GLOBAL+idx))
+		binary.LittleEndian.PutUint16(entry[0x6:], uint16(len(names)))
+		binary.LittleEndian.PutUint32(entry[0x8:], sysvHash(names[0]))
+		binary.LittleEndian.PutUint32(entry[0xc:], 0x14)
+		if idx != len(definitions)-1 {
+			binary.LittleEndian.PutUint32(entry[0x10:], uint32(size))
+		}
+
+		for nameIdx, name := range names {
+			aux := entry[0x14+0x8*nameIdx:]
+			binary.LittleEndian.PutUint32(aux, dynamic.strings[name])
+			if nameIdx != len(names)-1 {
+				binary.LittleEndian.PutUint32(aux[0x4:], 0x8)
+			}
+		}
+
+		offset += size
+	}
+}
+
+func (linker *Linker) fillVersionNeeds() {
+	dynamic := linker.Dynamic
+	versions := dynamic.Versions
+
+	offset := 0
+	for needIdx, need := range versions.Needed {
+		entry := versions.VerNeed.Data[offset:]
+		binary.LittleEndian.PutUint16(entry, 1)
+		binary.LittleEndian.PutUint16(entry[0x2:], uint16(len(need.Versions)))
+		binary.LittleEndian.PutUint32(entry[0x4:], dynamic.strings[need.SOName])
+		binary.LittleEndian.PutUint32(entry[0x8:], 0x10)
+		if needIdx != len(versions.Needed)-1 {
+			binary.LittleEndian.PutUint32(entry[0xc:], uint32(0x10+0x10*len(need.Versions)))
+		}
+
+		for versionIdx, version := range need.Versions {
+			aux := entry[0x10+0x10*versionIdx:]
+			binary.LittleEndian.PutUint32(aux, sysvHash(version))
+			binary.LittleEndian.PutUint16(aux[0x6:], need.indices[version])
+			binary.LittleEndian.PutUint32(aux[0x8:], dynamic.strings[version])
+			if versionIdx != len(need.Versions)-1 {
+				binary.LittleEndian.PutUint32(aux[0xc:], 0x10)
+			}
+		}
+
+		offset += 0x10 + 0x10*len(need.Versions)
+	}
+}
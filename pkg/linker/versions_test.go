@@ -0,0 +1,165 @@
+package linker
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionedReferences(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_uselib_versioned.o",
+		"../../data/sample_shared_lib.so",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// lib_func@LIB_1.0 is hidden, it is only bound by the explicit reference
+	old, _ := l.importedVersion("lib_func@LIB_1.0")
+	current, _ := l.importedVersion("lib_func")
+	assert.Truef(t, old != nil && old.Symbol.Version == "LIB_1.0" && old.Symbol.HiddenVersion, "wrong binding of lib_func@LIB_1.0")
+	assert.Truef(t, current != nil && current.Symbol.Version == "LIB_2.0", "wrong binding of lib_func")
+
+	versions := l.Dynamic.Versions
+	assert.Truef(t, versions != nil && len(versions.Needed) == 1, "libsample.so.1 versions should be needed")
+	need := versions.Needed[0]
+	assert.Truef(t, need.SOName == "libsample.so.1" && len(need.Versions) == 2, "wrong needed versions got=%v", need.Versions)
+
+	// both references have the same name in .dynsym, told apart by their version index
+	dynstr := l.Dynamic.DynStr.Data
+	for _, name := range []string{"lib_func@LIB_1.0", "lib_func"} {
+		idx := l.dynamicSymbolIndex(name)
+		nameOffset := binary.LittleEndian.Uint32(l.Dynamic.DynSym.Data[idx*0x18:])
+		assert.Truef(t, string(dynstr[nameOffset:nameOffset+9]) == "lib_func\x00", "wrong .dynsym name of %s", name)
+
+		shared, _ := l.importedVersion(name)
+		index := binary.LittleEndian.Uint16(versions.VerSym.Data[2*idx:])
+		assert.Truef(t, index == need.indices[shared.Symbol.Version], "wrong version index of %s got=%d", name, index)
+	}
+
+	verneed := versions.VerNeed.Data
+	assert.Truef(t, binary.LittleEndian.Uint16(verneed[0x2:]) == 2, "wrong vn_cnt")
+	assert.Truef(t, binary.LittleEndian.Uint32(verneed[0x10:]) == sysvHash(need.Versions[0]), "wrong vna_hash")
+
+	tags := make(map[int64]uint64)
+	for _, entry := range l.Dynamic.Entries {
+		tags[entry.Tag] = entry.Value
+	}
+	assert.Truef(t, tags[elf.DT_VERSYM] == versions.VerSym.SectionEntry.ShAddr, "wrong DT_VERSYM")
+	assert.Truef(t, tags[elf.DT_VERNEED] == versions.VerNeed.SectionEntry.ShAddr, "wrong DT_VERNEED")
+	assert.Truef(t, tags[elf.DT_VERNEEDNUM] == 1, "wrong DT_VERNEEDNUM")
+
+	if _, err := os.Stat(DefaultDynamicLinker); err != nil {
+		t.Skipf("%s not found", DefaultDynamicLinker)
+	}
+
+	library, err := os.ReadFile("../../data/sample_shared_lib.so")
+	assert.Truef(t, err == nil, "%v", err)
+	assert.Truef(t, os.WriteFile(filepath.Join(dir, "libsample.so.1"), library, 0755) == nil, "writing the library failed")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	err = cmd.Run()
+
+	// lib_func@LIB_1.0(4) returns 4, lib_func@@LIB_2.0(4) adds lib_var
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 4+4+3, "wrong exit code: %v", err)
+}
+
+func TestDefaultVersionDefinition(t *testing.T) {
+	dir := t.TempDir()
+	filenames := []string{
+		"../../data/sample_relocatable_versioned_main.o",
+		"../../data/sample_relocatable_versioned_def.o",
+	}
+
+	l, err := Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out")})
+	assert.Truef(t, err == nil, "helper@@HELPER_1 should define helper: %v", err)
+
+	helper, _ := l.resolveSymbol("helper")
+	assert.Truef(t, helper != nil && helper.Version == "HELPER_1", "helper should keep its version")
+
+	cmd := exec.Command(filepath.Join(dir, "a.out"))
+	err = cmd.Run()
+	assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 30, "wrong exit code: %v", err)
+
+	// an exported definition needs a version script that defines its version
+	_, err = Link(LinkerInputs{Filenames: filenames, ExecutableName: filepath.Join(dir, "a.out"), ExportDynamic: true})
+	assert.ErrorIs(t, err, UndefinedVersionErr)
+	_, err = Link(LinkerInputs{Filenames: filenames[1:], ExecutableName: filepath.Join(dir, "libhelper.so"), Shared: true})
+	assert.ErrorIs(t, err, UndefinedVersionErr)
+}
+
+func TestVersionScript(t *testing.T) {
+	dir := t.TempDir()
+	library := filepath.Join(dir, "libver.so")
+	inputs := LinkerInputs{
+		Filenames: []string{
+			"../../data/sample_relocatable_versioned_lib.o",
+			"../../data/sample_relocatable_versioned_lib_cxx.o",
+		},
+		ExecutableName: library,
+		Shared:         true,
+		SOName:         "libver.so",
+		VersionScript:  "../../data/sample_version_script.map",
+	}
+
+	l, err := Link(inputs)
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// local: * keeps everything else out of .dynsym
+	for _, name := range []string{"internal_helper", "ver_old_impl", "_ZN3api6hiddenEPKc"} {
+		assert.Truef(t, l.dynamicSymbolIndex(name) == 0 && l.Symbols[name].Local, "%s should be local", name)
+	}
+
+	versions := l.Dynamic.Versions
+	assert.Truef(t, len(versions.Defined) == 2 && versions.VerNeed == nil, "VER_1 and VER_2 should be defined")
+
+	indices := map[string]uint16{
+		"api_one":          2,
+		"_ZN3api6answerEi": 2,
+		"ver_func@VER_1":   2 | elf.VERSYM_HIDDEN,
+		"ver_func":         3,
+	}
+	for name, expected := range indices {
+		idx := l.dynamicSymbolIndex(name)
+		assert.Truef(t, idx != 0, "%s should be exported", name)
+		index := binary.LittleEndian.Uint16(versions.VerSym.Data[2*idx:])
+		assert.Truef(t, index == expected, "wrong version index of %s got=%x", name, index)
+	}
+
+	// the base version, VER_1, then VER_2 and its parent
+	verdef := versions.VerDef.Data
+	assert.Truef(t, binary.LittleEndian.Uint16(verdef[0x2:]) == elf.VER_FLG_BASE, "the first definition is the base version")
+	assert.Truef(t, binary.LittleEndian.Uint16(verdef[0x38+0x6:]) == 2, "VER_2 should name its parent")
+	assert.Truef(t, binary.LittleEndian.Uint32(verdef[0x38+0x8:]) == sysvHash("VER_2"), "wrong vd_hash")
+
+	// the output can be linked against, the references are bound to the versions it defines
+	_, err = Link(LinkerInputs{
+		Filenames:      []string{"../../data/sample_relocatable_use_versioned_lib.o", library},
+		ExecutableName: filepath.Join(dir, "a.out"),
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	if _, err := os.Stat(DefaultDynamicLinker); err == nil {
+		cmd := exec.Command(filepath.Join(dir, "a.out"))
+		cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+		err = cmd.Run()
+
+		// ver_func@@VER_2 returns 2, ver_func@VER_1 returns 1
+		assert.Truef(t, cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 2+1+10, "wrong exit code: %v", err)
+	}
+
+	script := filepath.Join(dir, "missing.map")
+	assert.Truef(t, os.WriteFile(script, []byte("VER_1 { global: api_one; missing; local: *; }; VER_2 {} VER_1;"), 0644) == nil, "writing the script failed")
+	inputs.VersionScript = script
+	inputs.NoUndefinedVersion = true
+	_, err = Link(inputs)
+	assert.ErrorIs(t, err, UnmatchedVersionPatternErr)
+}
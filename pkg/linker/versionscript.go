@@ -0,0 +1,354 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/andreistan26/golink/pkg/log"
+)
+
+var (
+	VersionScriptSyntaxErr = errors.New("Syntax error in version script")
+	UndefinedVersionErr    = errors.New("Version is not defined")
+)
+
+// A GNU version script, the nodes in the order they are defined. A node without a name only
+// chooses which symbols are exported, it does not version them.
+type VersionScript struct {
+	Nodes []*VersionNode
+}
+
+type VersionNode struct {
+	Name string
+	// version that this one inherits from, empty if none
+	Parent string
+	Global []*VersionPattern
+	Local  []*VersionPattern
+}
+
+type VersionPattern struct {
+	Pattern string
+	// quoted patterns are matched as is, the others may be globs
+	Exact bool
+	// the pattern is matched against the demangled name, extern "C++"
+	CXX bool
+
+	matched bool
+	// the names that could not be demangled, warned about once
+	warned map[string]struct{}
+}
+
+func (pattern *VersionPattern) isGlob() bool {
+	return !pattern.Exact && strings.ContainsAny(pattern.Pattern, "*?[")
+}
+
+func (pattern *VersionPattern) match(name string) bool {
+	if pattern.CXX {
+		demangled, ok := demangle(name)
+		if ok {
+			name = demangled
+		} else if _, found := pattern.warned[name]; strings.HasPrefix(name, "_Z") && !found {
+			if pattern.warned == nil {
+				pattern.warned = map[string]struct{}{}
+			}
+			pattern.warned[name] = struct{}{}
+			log.Warnf("extern \"C++\" pattern %s is matched against %s, it cannot be demangled", pattern.Pattern, name)
+		}
+	}
+
+	if !pattern.isGlob() {
+		return pattern.Pattern == name
+	}
+
+	matched, err := path.Match(pattern.Pattern, name)
+	return err == nil && matched
+}
+
+func ReadVersionScript(filename string) (*VersionScript, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseVersionScript(string(data))
+}
+
+func ParseVersionScript(data string) (*VersionScript, error) {
+	parser := &versionScriptParser{tokens: tokenizeVersionScript(data)}
+	script := &VersionScript{}
+
+	for !parser.done() {
+		node := &VersionNode{}
+		if parser.peek() != "{" {
+			node.Name = parser.next()
+		}
+
+		if err := parser.expect("{"); err != nil {
+			return nil, err
+		}
+
+		if err := parser.parseNodeBody(node); err != nil {
+			return nil, err
+		}
+
+		if parser.peek() != ";" {
+			node.Parent = parser.next()
+		}
+
+		if err := parser.expect(";"); err != nil {
+			return nil, err
+		}
+
+		script.Nodes = append(script.Nodes, node)
+	}
+
+	for _, node := range script.Nodes {
+		if node.Parent != "" && script.findNode(node.Parent) == nil {
+			return nil, fmt.Errorf("%w: %s inherits from %s", UndefinedVersionErr, node.Name, node.Parent)
+		}
+	}
+
+	return script, nil
+}
+
+func (script *VersionScript) findNode(name string) *VersionNode {
+	for _, node := range script.Nodes {
+		if node.Name == name {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// The named nodes are the versions defined by the output, in .gnu.version_d order
+func (script *VersionScript) versionNames() []string {
+	names := []string{}
+	for _, node := range script.Nodes {
+		if node.Name != "" {
+			names = append(names, node.Name)
+		}
+	}
+
+	return names
+}
+
+// Finds the node of a definition. Exact patterns have precedence over globs, a later node
+// has precedence over an earlier one for globs, and the catch-all "*" comes last.
+func (script *VersionScript) assign(name string) (node *VersionNode, global bool, found bool) {
+	for _, node := range script.Nodes {
+		for _, isGlobal := range []bool{true, false} {
+			for _, pattern := range node.patterns(isGlobal) {
+				if !pattern.isGlob() && pattern.match(name) {
+					pattern.matched = true
+					return node, isGlobal, true
+				}
+			}
+		}
+	}
+
+	for _, catchAll := range []bool{false, true} {
+		for idx := len(script.Nodes) - 1; idx >= 0; idx-- {
+			node := script.Nodes[idx]
+			for _, isGlobal := range []bool{true, false} {
+				for _, pattern := range node.patterns(isGlobal) {
+					if pattern.isGlob() && (pattern.Pattern == "*") == catchAll && pattern.match(name) {
+						pattern.matched = true
+						return node, isGlobal, true
+					}
+				}
+			}
+		}
+	}
+
+	return nil, false, false
+}
+
+func (node *VersionNode) patterns(global bool) []*VersionPattern {
+	if global {
+		return node.Global
+	}
+
+	return node.Local
+}
+
+type versionScriptParser struct {
+	tokens []versionScriptToken
+	pos    int
+}
+
+type versionScriptToken struct {
+	text   string
+	quoted bool
+}
+
+func (parser *versionScriptParser) done() bool {
+	return parser.pos >= len(parser.tokens)
+}
+
+func (parser *versionScriptParser) peek() string {
+	if parser.done() {
+		return ""
+	}
+
+	return parser.tokens[parser.pos].text
+}
+
+func (parser *versionScriptParser) next() string {
+	token := parser.peek()
+	parser.pos++
+	return token
+}
+
+func (parser *versionScriptParser) expect(token string) error {
+	if parser.done() {
+		return fmt.Errorf("%w: expected %q, found the end of the script", VersionScriptSyntaxErr, token)
+	}
+
+	if found := parser.next(); found != token {
+		return fmt.Errorf("%w: expected %q, found %q", VersionScriptSyntaxErr, token, found)
+	}
+
+	return nil
+}
+
+// Parses the patterns of a node up to its closing brace, the patterns are global until a
+// local: label is found
+func (parser *versionScriptParser) parseNodeBody(node *VersionNode) error {
+	global := true
+	for {
+		if parser.done() {
+			return fmt.Errorf("%w: missing \"}\"", VersionScriptSyntaxErr)
+		}
+
+		token := parser.tokens[parser.pos]
+		switch {
+		case token.text == "}" && !token.quoted:
+			parser.next()
+			return nil
+		case (token.text == "global" || token.text == "local") && !token.quoted && parser.peekAt(1) == ":":
+			global = token.text == "global"
+			parser.pos += 2
+		case token.text == "extern" && !token.quoted:
+			parser.next()
+			language := parser.next()
+			if language != "C++" && language != "C" {
+				return fmt.Errorf("%w: unsupported language %q", VersionScriptSyntaxErr, language)
+			}
+			if err := parser.expect("{"); err != nil {
+				return err
+			}
+			if err := parser.parsePatterns(node, global, language == "C++"); err != nil {
+				return err
+			}
+			if parser.peek() == ";" {
+				parser.next()
+			}
+		default:
+			if err := parser.addPattern(node, global, false); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// The patterns of an extern block, up to its closing brace
+func (parser *versionScriptParser) parsePatterns(node *VersionNode, global bool, cxx bool) error {
+	for {
+		if parser.done() {
+			return fmt.Errorf("%w: missing \"}\"", VersionScriptSyntaxErr)
+		}
+
+		if parser.peek() == "}" && !parser.tokens[parser.pos].quoted {
+			parser.next()
+			return nil
+		}
+
+		if err := parser.addPattern(node, global, cxx); err != nil {
+			return err
+		}
+	}
+}
+
+func (parser *versionScriptParser) addPattern(node *VersionNode, global bool, cxx bool) error {
+	token := parser.tokens[parser.pos]
+	parser.next()
+
+	if !token.quoted && strings.ContainsAny(token.text, "{};") {
+		return fmt.Errorf("%w: unexpected %q", VersionScriptSyntaxErr, token.text)
+	}
+
+	pattern := &VersionPattern{Pattern: token.text, Exact: token.quoted, CXX: cxx}
+	if global {
+		node.Global = append(node.Global, pattern)
+	} else {
+		node.Local = append(node.Local, pattern)
+	}
+
+	// the semicolon may be omitted before the closing brace
+	if parser.peek() == "}" {
+		return nil
+	}
+
+	return parser.expect(";")
+}
+
+func (parser *versionScriptParser) peekAt(offset int) string {
+	if parser.pos+offset >= len(parser.tokens) {
+		return ""
+	}
+
+	return parser.tokens[parser.pos+offset].text
+}
+
+// Splits the script in braces, semicolons, colons, quoted strings and names. Names may contain
+// "::" for the C++ patterns, comments are C style or start with #.
+func tokenizeVersionScript(data string) []versionScriptToken {
+	tokens := []versionScriptToken{}
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(data[i:], "/*"):
+			end := strings.Index(data[i+2:], "*/")
+			if end == -1 {
+				i = len(data)
+			} else {
+				i += end + 4
+			}
+		case c == '"':
+			end := strings.IndexByte(data[i+1:], '"')
+			if end == -1 {
+				end = len(data) - i - 1
+			}
+			tokens = append(tokens, versionScriptToken{text: data[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case c == '{' || c == '}' || c == ';' || (c == ':' && !strings.HasPrefix(data[i:], "::")):
+			tokens = append(tokens, versionScriptToken{text: string(c)})
+			i++
+		default:
+			start := i
+			for i < len(data) && !strings.ContainsRune(" \t\n\r{};\"", rune(data[i])) {
+				if data[i] == ':' {
+					if !strings.HasPrefix(data[i:], "::") {
+						break
+					}
+					i++
+				}
+				i++
+			}
+			tokens = append(tokens, versionScriptToken{text: data[start:i]})
+		}
+	}
+
+	return tokens
+}
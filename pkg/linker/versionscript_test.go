@@ -0,0 +1,115 @@
+package linker
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/andreistan26/golink/pkg/elf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersionScript(t *testing.T) {
+	script, err := ReadVersionScript("../../data/sample_version_script.map")
+	assert.Truef(t, err == nil, "parsing failed: %v", err)
+	assert.Truef(t, len(script.Nodes) == 2, "wrong node count got=%d", len(script.Nodes))
+
+	first, second := script.Nodes[0], script.Nodes[1]
+	assert.Truef(t, first.Name == "VER_1" && first.Parent == "", "wrong first node %s", first.Name)
+	assert.Truef(t, second.Name == "VER_2" && second.Parent == "VER_1", "VER_2 should inherit from VER_1")
+
+	assert.Truef(t, len(first.Global) == 2 && first.Global[0].Pattern == "api_one", "wrong global patterns of VER_1")
+	cxx := first.Global[1]
+	assert.Truef(t, cxx.CXX && cxx.Exact && cxx.Pattern == "api::answer(int)", "wrong extern \"C++\" pattern")
+	assert.Truef(t, len(first.Local) == 1 && first.Local[0].isGlob(), "VER_1 should localize everything else")
+	assert.Truef(t, second.Global[0].isGlob(), "api_* is a glob")
+
+	// anonymous node, the semicolon before the brace is optional
+	script, err = ParseVersionScript("{ global: foo; bar }; ")
+	assert.Truef(t, err == nil && len(script.Nodes) == 1 && script.Nodes[0].Name == "", "anonymous node: %v", err)
+	assert.Truef(t, len(script.Nodes[0].Global) == 2, "foo and bar should be global")
+
+	_, err = ParseVersionScript("VER_1 { global: foo; ")
+	assert.ErrorIs(t, err, VersionScriptSyntaxErr)
+	_, err = ParseVersionScript("VER_2 { global: foo; } VER_1;")
+	assert.ErrorIs(t, err, UndefinedVersionErr)
+}
+
+func TestVersionScriptAssignment(t *testing.T) {
+	script, err := ParseVersionScript(`
+		V1 { global: exact; glob_*; local: *; };
+		V2 { global: glob_new*; extern "C++" { ns::*; std::vector*; }; };
+	`)
+	assert.Truef(t, err == nil, "parsing failed: %v", err)
+
+	cases := []struct {
+		name    string
+		version string
+		global  bool
+	}{
+		{"exact", "V1", true},
+		{"glob_old", "V1", true},
+		// a later node wins for globs
+		{"glob_new_one", "V2", true},
+		{"_ZN2ns3getEv", "V2", true},
+		{"_ZNSt6vectorIiSaIiEE9push_backERKi", "V2", true},
+		{"other", "V1", false},
+	}
+
+	for _, c := range cases {
+		node, global, found := script.assign(c.name)
+		assert.Truef(t, found && node.Name == c.version && global == c.global, "wrong assignment of %s", c.name)
+	}
+}
+
+func TestVersionScriptLocalBinding(t *testing.T) {
+	l, err := Link(LinkerInputs{
+		Filenames: []string{
+			"../../data/sample_relocatable_versioned_lib.o",
+			"../../data/sample_relocatable_versioned_lib_cxx.o",
+		},
+		ExecutableName: filepath.Join(t.TempDir(), "libver.so"),
+		Shared:         true,
+		SOName:         "libver.so",
+		VersionScript:  "../../data/sample_version_script.map",
+	})
+	assert.Truef(t, err == nil, "link failed: %v", err)
+
+	// the definitions matched by local: are demoted like ld does
+	for _, name := range []string{"internal_helper", "_ZN3api6hiddenEPKc"} {
+		binding := l.Symbols[name].DefinedSymbol.Symbol.BaseSymbol.GetBinding()
+		assert.Truef(t, binding == elf.STB_LOCAL, "%s should be STB_LOCAL got=%d", name, binding)
+	}
+	binding := l.Symbols["api_one"].DefinedSymbol.Symbol.BaseSymbol.GetBinding()
+	assert.Truef(t, binding == elf.STB_GLOBAL, "api_one should stay STB_GLOBAL got=%d", binding)
+}
+
+func TestDemangle(t *testing.T) {
+	names := map[string]string{
+		"_ZN3api6answerEi":          "api::answer(int)",
+		"_ZN3api6hiddenEPKc":        "api::hidden(char const*)",
+		"_Z3fooPKcS0_":              "foo(char const*, char const*)",
+		"_ZN2ns5Klass6methodERKS0_": "ns::Klass::method(ns::Klass const&)",
+		"_ZN2ns5KlassD1Ev":          "ns::Klass::~Klass()",
+		"_ZNK2ns5Klass3getEv":       "ns::Klass::get() const",
+		"_ZN1a1b1cEPNS_1dES2_":      "a::b::c(a::d*, a::d*)",
+		"_ZN2ns1xE":                 "ns::x",
+		// templates, with the substitutions of their arguments
+		"_ZNSt6vectorIiSaIiEE9push_backERKi":              "std::vector<int, std::allocator<int> >::push_back(int const&)",
+		"_ZNSt6vectorIiSaIiEE12emplace_backIJRiEEEvDpOT_": "void std::vector<int, std::allocator<int> >::emplace_back<int&>(int&)",
+		"_ZN2ns3maxILi3EEEiRAT__Ki":                       "int ns::max<3>(int const (&) [3])",
+		// operators
+		"_ZN2nsplERKNS_5KlassES2_":         "ns::operator+(ns::Klass const&, ns::Klass const&)",
+		"_ZNK2ns5KlassclEv":                "ns::Klass::operator()() const",
+		"_ZN2nsltIiEEbRKNS_5KlassIT_EES5_": "bool ns::operator< <int>(ns::Klass<int> const&, ns::Klass<int> const&)",
+	}
+
+	for mangled, expected := range names {
+		demangled, ok := demangle(mangled)
+		assert.Truef(t, ok && demangled == expected, "wrong demangling of %s got=%s", mangled, demangled)
+	}
+
+	_, ok := demangle("not_mangled")
+	assert.Falsef(t, ok, "C names are not demangled")
+	_, ok = demangle("_Z1fIXplT_Li1EEEvv")
+	assert.Falsef(t, ok, "arithmetic in template arguments is not supported")
+}